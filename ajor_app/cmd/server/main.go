@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/Gerard-007/ajor_app/internal/services"
 	"github.com/Gerard-007/ajor_app/pkg/jobs"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"github.com/Gerard-007/ajor_app/pkg/payment/fake"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
@@ -27,7 +30,56 @@ func main() {
 		log.Fatal(err)
 	}
 
-	pg := payment.NewFlutterwaveGateway()
+	// Convert amounts written before they were stored in kobo
+	if err := repository.MigrateMoneyFields(context.Background(), db); err != nil {
+		log.Fatal("Failed to migrate money fields:", err)
+	}
+	// Bring wallets that predate the ledger into it before they take postings
+	if err := repository.SeedOpeningBalances(context.Background(), db); err != nil {
+		log.Fatal("Failed to seed opening balances:", err)
+	}
+	if err := repository.EnsureIdempotencyIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create idempotency indexes:", err)
+	}
+	if err := repository.EnsurePenaltyIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create penalty indexes:", err)
+	}
+	if err := repository.EnsureCycleIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create cycle indexes:", err)
+	}
+	if err := repository.EnsureStandingOrderIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create standing order indexes:", err)
+	}
+	if err := repository.EnsureWebhookEventIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create webhook event indexes:", err)
+	}
+	if err := repository.EnsureTransactionIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create transaction indexes:", err)
+	}
+	if err := repository.EnsureReconciliationReportIndexes(context.Background(), db); err != nil {
+		log.Fatal("Failed to create reconciliation report indexes:", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8081"
+	}
+
+	// FAKE_PAYMENTS=true swaps the payment providers for an in-process fake
+	// for local development
+	var fakeGateway *fake.Gateway
+	var pg *payment.Registry
+	if os.Getenv("FAKE_PAYMENTS") == "true" {
+		webhookURL := os.Getenv("FAKE_PAYMENTS_WEBHOOK_URL")
+		if webhookURL == "" {
+			webhookURL = "http://localhost:" + port + "/webhook/flutterwave"
+		}
+		fakeGateway = fake.New("fake-secret", webhookURL)
+		pg = fakeGateway.Registry()
+		log.Printf("Payment providers: fake, sending webhooks to %s", webhookURL)
+	} else {
+		pg = payment.NewRegistryFromEnv()
+	}
 
 	server := gin.Default()
 
@@ -35,8 +87,8 @@ func main() {
 	server.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -47,9 +99,12 @@ func main() {
 	}
 
 	routes.InitRoutes(server, db, pg)
+	if fakeGateway != nil {
+		server.Any("/dev/fake-gateway/*path", gin.WrapH(http.StripPrefix("/dev/fake-gateway", fakeGateway.Handler())))
+	}
 
 	// Start cron job
-	c := cron.New()
+	c := cron.New(cron.WithChain(cron.Recover(cron.DefaultLogger)))
 	notifRepo := repository.NewNotificationRepository(db)
 	notifService := services.NewNotificationService(notifRepo)
 	_, err = c.AddFunc("0 0 * * *", func() { // Runs daily at midnight
@@ -60,13 +115,103 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	_, err = c.AddFunc("15 0 * * *", func() { // Runs daily, once the midnight deadlines have passed
+		if err := jobs.AdvanceCycleSchedules(db); err != nil {
+			log.Printf("Error advancing cycle schedules: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("30 0 * * *", func() { // Runs daily, just after the midnight deadlines
+		if err := jobs.RotateContributions(db, notifService); err != nil {
+			log.Printf("Error rotating contributions: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("45 0 * * *", func() { // Runs daily; only savings whose month has ended are settled
+		if err := jobs.SettleDailySavings(db, notifService); err != nil {
+			log.Printf("Error settling daily savings: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("0 7 * * *", func() { // Runs daily in the morning
+		if err := jobs.RunGoalAutoDebits(db, notifService); err != nil {
+			log.Printf("Error running savings goal auto-debits: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("5 * * * *", func() { // Runs hourly so failed auto-debits are retried
+		if err := jobs.RunStandingOrders(db, notifService); err != nil {
+			log.Printf("Error running contribution auto-debits: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("*/15 * * * *", func() {
+		if err := jobs.SyncPendingWithdrawals(db, pg, notifService); err != nil {
+			log.Printf("Error syncing pending withdrawals: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fundingTTL := services.DefaultPendingFundingTTL
+	if env := os.Getenv("PENDING_FUNDING_TTL"); env != "" {
+		fundingTTL, err = time.ParseDuration(env)
+		if err != nil || fundingTTL <= 0 {
+			log.Fatalf("Invalid PENDING_FUNDING_TTL %q: must be a positive duration such as 24h", env)
+		}
+	}
+	approvalTTL := services.DefaultPayoutApprovalTTL
+	if env := os.Getenv("PAYOUT_APPROVAL_TTL"); env != "" {
+		approvalTTL, err = time.ParseDuration(env)
+		if err != nil || approvalTTL <= 0 {
+			log.Fatalf("Invalid PAYOUT_APPROVAL_TTL %q: must be a positive duration such as 72h", env)
+		}
+	}
+	_, err = c.AddFunc("*/15 * * * *", func() {
+		if err := jobs.SweepStaleTransactions(db, pg, notifService, fundingTTL, approvalTTL); err != nil {
+			log.Printf("Error sweeping stale transactions: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("* * * * *", func() { // Runs every minute so failed webhooks are retried promptly
+		if err := jobs.ProcessWebhookEvents(db, pg, notifService); err != nil {
+			log.Printf("Error processing webhook events: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("0 * * * *", func() {
+		if err := jobs.ReconcileLedger(db); err != nil {
+			log.Printf("Error reconciling ledger: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = c.AddFunc("30 2 * * *", func() { // Runs daily once the gateways have settled the previous day
+		if err := jobs.ReconcileSettlements(db, pg, notifService); err != nil {
+			log.Printf("Error reconciling gateway settlements: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	c.Start()
 	defer c.Stop()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
 	log.Printf("Starting server on port %s", port)
 	server.Run(":" + port)
 }
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
 	"github.com/Gerard-007/ajor_app/internal/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -24,26 +27,36 @@ func ApprovePayoutHandler(db *mongo.Database, notifService *services.Notificatio
 			return
 		}
 		var request struct {
-			Approve bool `json:"approve"`
+			Approve bool                   `json:"approve"`
+			Reason  string                 `json:"reason"`
+			Requeue models.RequeuePosition `json:"requeue"`
 		}
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
-		err = services.ApprovePayout(c.Request.Context(), db, notifService, approvalID, approverID, request.Approve)
+		vote, err := services.ApprovePayout(c.Request.Context(), db, notifService, approvalID, approverID, request.Approve, request.Reason, request.Requeue)
 		if err != nil {
+			if strings.Contains(err.Error(), "reason") || strings.Contains(err.Error(), "requeue") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "already processed") {
 				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 				return
 			}
+			if errors.Is(err, repository.ErrInsufficientFunds) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process approval"})
 			return
 		}
-		status := "rejected"
-		if request.Approve {
-			status = "approved"
+		message := fmt.Sprintf("Vote recorded; the payout has %d of %d approvals", vote.Approvals, vote.Threshold)
+		if vote.Outcome != models.ApprovalPending {
+			message = fmt.Sprintf("Payout %s successfully", vote.Outcome)
 		}
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Payout %s successfully", status)})
+		c.JSON(http.StatusOK, gin.H{"message": message, "vote": vote})
 	}
 }
 
@@ -61,4 +74,38 @@ func GetPendingApprovalsHandler(db *mongo.Database) gin.HandlerFunc {
 		}
 		c.JSON(http.StatusOK, approvals)
 	}
-}
\ No newline at end of file
+}
+
+func SetApprovalPolicyHandler(db *mongo.Database, notifService *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupAdminID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		var policy models.ApprovalPolicy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		err = services.SetApprovalPolicy(c.Request.Context(), db, notifService, contributionID, groupAdminID, policy)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "only group admin") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "treasurer") || strings.Contains(err.Error(), "threshold") || strings.Contains(err.Error(), "mode") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set approval policy"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Approval policy updated successfully"})
+	}
+}
@@ -31,14 +31,18 @@ func CreateCollectionHandler(db *mongo.Database, notifService *services.Notifica
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
-		collectorID, err := primitive.ObjectIDFromHex(request.CollectorID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collector ID"})
-			return
+		// Leaving out the collector schedules the next member in the payout order
+		var collectorID primitive.ObjectID
+		if request.CollectorID != "" {
+			collectorID, err = primitive.ObjectIDFromHex(request.CollectorID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collector ID"})
+				return
+			}
 		}
 		err = services.CreateCollection(c.Request.Context(), db, notifService, contributionID, collectorID, groupAdminID, request.CollectionDate)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "only group admin") || strings.Contains(err.Error(), "collector not in contribution") {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "only group admin") || strings.Contains(err.Error(), "collector not in contribution") || strings.Contains(err.Error(), "payout order") {
 				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 				return
 			}
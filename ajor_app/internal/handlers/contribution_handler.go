@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
 	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -120,6 +122,10 @@ func UpdateContributionHandler(db *mongo.Database) gin.HandlerFunc {
 				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 				return
 			}
+			if strings.Contains(err.Error(), "payout order") || strings.Contains(err.Error(), "type can't change") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update contribution"})
 			return
 		}
@@ -153,6 +159,8 @@ func JoinContributionHandler(db *mongo.Database, notifService *services.Notifica
 				c.JSON(http.StatusBadRequest, gin.H{"error": "You are already in the group"})
 			case strings.Contains(err.Error(), "not found"):
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Contribution not found"})
+			case strings.Contains(err.Error(), "can't be joined"):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			default:
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join group"})
 			}
@@ -205,7 +213,7 @@ func RecordContributionHandler(db *mongo.Database, notifService *services.Notifi
 			return
 		}
 		var request struct {
-			Amount        float64              `json:"amount"`
+			Amount        money.Money          `json:"amount"`
 			PaymentMethod models.PaymentMethod `json:"payment_method"`
 		}
 		if err := c.ShouldBindJSON(&request); err != nil {
@@ -214,10 +222,14 @@ func RecordContributionHandler(db *mongo.Database, notifService *services.Notifi
 		}
 		err = services.RecordContribution(c.Request.Context(), db, notifService, contributionID, userID, request.Amount, request.PaymentMethod)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "amount mismatch") || strings.Contains(err.Error(), "insufficient balance") {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "amount mismatch") || strings.Contains(err.Error(), "daily savings") || errors.Is(err, repository.ErrInsufficientFunds) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			if errors.Is(err, services.ErrCycleAlreadyPaid) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record contribution"})
 			return
 		}
@@ -239,10 +251,10 @@ func RecordPayoutHandler(db *mongo.Database, notifService *services.Notification
 		}
 		var request struct {
 			UserID        primitive.ObjectID   `json:"user_id"`
-			Amount        float64              `json:"amount"`
+			Amount        money.Money          `json:"amount"`
 			PaymentMethod models.PaymentMethod `json:"payment_method"`
 		}
-		if err := c.ShouldBindJSON(&request); err != nil {
+		if err := c.ShouldBindJSON(&request); err != nil || !request.Amount.IsPositive() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
@@ -252,6 +264,14 @@ func RecordPayoutHandler(db *mongo.Database, notifService *services.Notification
 				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 				return
 			}
+			if strings.Contains(err.Error(), "not eligible") || strings.Contains(err.Error(), "made by its rotation") || strings.Contains(err.Error(), "already has a payout") {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "amount must be") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payout"})
 			return
 		}
@@ -275,6 +295,31 @@ func GetAllContributionsHandler(db *mongo.Database) gin.HandlerFunc {
 	}
 }
 
+func GetContributionArrearsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		arrears, err := services.GetContributionArrears(c.Request.Context(), db, contributionID, userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get arrears"})
+			return
+		}
+		c.JSON(http.StatusOK, arrears)
+	}
+}
+
 func getAuthUserID(c *gin.Context) (primitive.ObjectID, error) {
 	userIDStr, exists := c.Get("userID")
 	if !exists {
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func GetCycleScheduleHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		windows, err := services.GetCycleSchedule(c.Request.Context(), db, contributionID, userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cycles"})
+			return
+		}
+		c.JSON(http.StatusOK, windows)
+	}
+}
+
+func GetCycleDetailHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		n, err := strconv.Atoi(c.Param("n"))
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle number"})
+			return
+		}
+		detail, err := services.GetCycleDetail(c.Request.Context(), db, contributionID, userID, n)
+		if err != nil {
+			if err.Error() == "cycle not found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cycle"})
+			return
+		}
+		c.JSON(http.StatusOK, detail)
+	}
+}
+
+func GetCycleStatusMatrixHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		matrix, err := services.GetCycleStatusMatrix(c.Request.Context(), db, contributionID, userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment status"})
+			return
+		}
+		c.JSON(http.StatusOK, matrix)
+	}
+}
+
+func WaiveMemberCycleHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupAdminID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		n, err := strconv.Atoi(c.Param("n"))
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle number"})
+			return
+		}
+		var request struct {
+			UserID primitive.ObjectID `json:"user_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		err = services.WaiveMemberCycle(c.Request.Context(), db, contributionID, groupAdminID, request.UserID, n)
+		if err != nil {
+			if errors.Is(err, repository.ErrMemberCycleSettled) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if err.Error() == "cycle not found" || strings.Contains(err.Error(), "not in contribution") || strings.Contains(err.Error(), "already settled") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "only group admin") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to waive contribution"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Contribution waived successfully"})
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func DelegateApprovalsHandler(db *mongo.Database, notifService *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delegatorID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		var request struct {
+			DelegateID     primitive.ObjectID `json:"delegate_id" binding:"required"`
+			ContributionID primitive.ObjectID `json:"contribution_id"`
+			StartsAt       time.Time          `json:"starts_at"`
+			EndsAt         time.Time          `json:"ends_at" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		delegation := &models.ApprovalDelegation{
+			DelegatorID:    delegatorID,
+			DelegateID:     request.DelegateID,
+			ContributionID: request.ContributionID,
+			StartsAt:       request.StartsAt,
+			EndsAt:         request.EndsAt,
+		}
+		err = services.DelegateApprovals(c.Request.Context(), db, notifService, delegation)
+		if err != nil {
+			if strings.Contains(err.Error(), "contribution not found") || strings.Contains(err.Error(), "only members") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "delegat") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delegate approvals"})
+			return
+		}
+		c.JSON(http.StatusCreated, delegation)
+	}
+}
+
+func GetApprovalDelegationsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		delegations, err := services.GetApprovalDelegations(c.Request.Context(), db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delegations"})
+			return
+		}
+		c.JSON(http.StatusOK, delegations)
+	}
+}
+
+func RevokeApprovalDelegationHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		delegatorID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		delegationID, err := primitive.ObjectIDFromHex(c.Param("delegation_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delegation ID"})
+			return
+		}
+		err = services.RevokeApprovalDelegation(c.Request.Context(), db, delegationID, delegatorID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke delegation"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Delegation revoked successfully"})
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateGoalHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		var goal models.SavingsGoal
+		if err := c.ShouldBindJSON(&goal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := services.CreateGoal(c.Request.Context(), db, userID, &goal); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Savings goal created successfully", "goal": goal})
+	}
+}
+
+func GetUserGoalsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		goals, err := services.GetUserGoals(c.Request.Context(), db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get savings goals"})
+			return
+		}
+		c.JSON(http.StatusOK, goals)
+	}
+}
+
+func GetGoalHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		goalID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal ID"})
+			return
+		}
+		goal, err := services.GetGoal(c.Request.Context(), db, goalID, userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get savings goal"})
+			return
+		}
+		c.JSON(http.StatusOK, goal)
+	}
+}
+
+func FundGoalHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		goalID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal ID"})
+			return
+		}
+		var request struct {
+			Amount money.Money `json:"amount"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		err = services.FundGoal(c.Request.Context(), db, goalID, userID, request.Amount)
+		if err != nil {
+			if strings.Contains(err.Error(), "savings goal not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, repository.ErrGoalClosed) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "amount") || errors.Is(err, repository.ErrInsufficientFunds) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fund savings goal"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Savings goal funded successfully"})
+	}
+}
+
+func WithdrawGoalHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		goalID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal ID"})
+			return
+		}
+		var request struct {
+			BreakEarly bool `json:"break_early"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+				return
+			}
+		}
+		amount, err := services.WithdrawGoal(c.Request.Context(), db, goalID, userID, request.BreakEarly)
+		if err != nil {
+			if strings.Contains(err.Error(), "savings goal not found") || strings.Contains(err.Error(), "unauthorized") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, repository.ErrGoalClosed) || errors.Is(err, services.ErrGoalLocked) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "broken early") || strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw savings goal"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Savings goal withdrawn successfully", "amount": amount})
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func ListReconciliationReportsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can view reconciliation reports"})
+			return
+		}
+		limit := services.DefaultReconciliationReportLimit
+		if raw := c.Query("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+			limit = parsed
+		}
+		reports, err := services.ListReconciliationReports(c.Request.Context(), db, limit)
+		if err != nil {
+			if strings.Contains(err.Error(), "limit must be") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list reconciliation reports"})
+			return
+		}
+		c.JSON(http.StatusOK, reports)
+	}
+}
+
+func GetReconciliationReportHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can view reconciliation reports"})
+			return
+		}
+		reportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reconciliation report ID"})
+			return
+		}
+		report, err := services.GetReconciliationReport(c.Request.Context(), db, reportID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reconciliation report"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// RunReconciliationHandler reconciles a past UTC day on demand, e.g. after
+// the nightly run failed or a discrepancy was resolved.
+func RunReconciliationHandler(db *mongo.Database, pg *payment.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can run reconciliation"})
+			return
+		}
+		var input struct {
+			Date string `json:"date" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		from, err := time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		to := from.Add(24 * time.Hour)
+		if to.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only days that have ended can be reconciled"})
+			return
+		}
+		report, err := services.ReconcileCharges(c.Request.Context(), db, pg, from, to)
+		if err != nil {
+			if strings.Contains(err.Error(), "gateway") {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
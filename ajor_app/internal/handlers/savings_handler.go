@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func AssignCollectorHandler(db *mongo.Database, notifService *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		saverID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		var request struct {
+			CollectorID primitive.ObjectID `json:"collector_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		err = services.AssignCollector(c.Request.Context(), db, notifService, contributionID, saverID, request.CollectorID)
+		if err != nil {
+			if strings.Contains(err.Error(), "collector") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "only the saver") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign collector"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Collector assigned successfully"})
+	}
+}
+
+func RecordDepositHandler(db *mongo.Database, notifService *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectorID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		var request struct {
+			Amount        money.Money          `json:"amount"`
+			PaymentMethod models.PaymentMethod `json:"payment_method"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		err = services.RecordDeposit(c.Request.Context(), db, notifService, contributionID, collectorID, request.Amount, request.PaymentMethod)
+		if err != nil {
+			if strings.Contains(err.Error(), "only the saver's collector") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "deposit") || errors.Is(err, repository.ErrInsufficientFunds) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record deposit"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Deposit recorded successfully"})
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func SetStandingOrderHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		var request struct {
+			Active     *bool `json:"active" binding:"required"`
+			MaxRetries *int  `json:"max_retries"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		maxRetries := services.DefaultStandingOrderRetries
+		if request.MaxRetries != nil {
+			maxRetries = *request.MaxRetries
+		}
+		order, err := services.SetStandingOrder(c.Request.Context(), db, contributionID, userID, *request.Active, maxRetries)
+		if err != nil {
+			if strings.Contains(err.Error(), "not in contribution") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "auto-debit") || strings.Contains(err.Error(), "retries") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update auto-debit"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Auto-debit updated successfully", "standing_order": order})
+	}
+}
+
+func GetStandingOrderHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		contributionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contribution ID"})
+			return
+		}
+		order, err := services.GetStandingOrder(c.Request.Context(), db, contributionID, userID)
+		if err != nil {
+			if strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get auto-debit"})
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
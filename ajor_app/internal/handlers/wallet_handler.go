@@ -8,6 +8,7 @@ import (
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
 	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -69,12 +70,16 @@ func FundWalletHandler(db *mongo.Database, pg payment.PaymentGateway) gin.Handle
 		}
 
 		var input struct {
-			Amount float64 `json:"amount" binding:"required,gt=0"`
+			Amount money.Money `json:"amount"`
 		}
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
 			return
 		}
+		if !input.Amount.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: amount must be greater than zero"})
+			return
+		}
 
 		err = services.FundWallet(c.Request.Context(), db, userID, input.Amount, pg)
 		if err != nil {
@@ -228,9 +233,9 @@ func SimulateFundWalletHandler(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 		var req struct {
-			Amount float64 `json:"amount"`
+			Amount money.Money `json:"amount"`
 		}
-		if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || !req.Amount.IsPositive() {
 			c.JSON(400, gin.H{"error": "Invalid amount"})
 			return
 		}
@@ -241,31 +246,22 @@ func SimulateFundWalletHandler(db *mongo.Database) gin.HandlerFunc {
 			c.JSON(404, gin.H{"error": "Wallet not found"})
 			return
 		}
-		// Insert transaction
-		tx := models.Transaction{
-			FromWallet:     wallet.ID,
+		tx := &models.Transaction{
 			ToWallet:       wallet.ID,
 			Amount:         req.Amount,
-			Type:           models.TransactionContribution,
+			Type:           models.TransactionWallet,
 			Date:           time.Now(),
 			PaymentMethod:  "manual",
-			Status:         models.StatusSuccess,
-		}
-		_, err = db.Collection("transactions").InsertOne(c, tx)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to insert transaction"})
-			return
 		}
-		// Update wallet balance
-		_, err = db.Collection("wallets").UpdateOne(c, bson.M{"_id": wallet.ID}, bson.M{"$inc": bson.M{"balance": req.Amount}})
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to update wallet balance"})
+		// Insert transaction and update wallet balance together
+		if err := services.ExecuteTransfer(c.Request.Context(), db, tx); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fund wallet"})
 			return
 		}
 		// Create notification for wallet funding
 		notification := &models.Notification{
 			UserID:    userID,
-			Message:   fmt.Sprintf("Your wallet was funded with ₦%.2f", req.Amount),
+			Message:   fmt.Sprintf("Your wallet was funded with ₦%s", req.Amount),
 			Type:      "info",
 			Read:      false,
 			CreatedAt: time.Now(),
@@ -276,4 +272,24 @@ func SimulateFundWalletHandler(db *mongo.Database) gin.HandlerFunc {
 		}
 		c.JSON(200, gin.H{"message": "Wallet funded (simulated)", "amount": req.Amount})
 	}
-}
\ No newline at end of file
+}
+func GetWalletReconciliationHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can reconcile wallets"})
+			return
+		}
+		walletID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet ID"})
+			return
+		}
+		result, err := services.ReconcileWallet(c.Request.Context(), db, walletID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func ListWebhookEventsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can view webhook events"})
+			return
+		}
+		limit := services.DefaultWebhookEventLimit
+		if raw := c.Query("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+			limit = parsed
+		}
+		events, err := services.ListWebhookEvents(c.Request.Context(), db, c.Query("status"), c.Query("provider"), limit)
+		if err != nil {
+			if strings.Contains(err.Error(), "invalid status") || strings.Contains(err.Error(), "limit must be") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhook events"})
+			return
+		}
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+func GetWebhookEventHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can view webhook events"})
+			return
+		}
+		eventID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook event ID"})
+			return
+		}
+		event, err := services.GetWebhookEvent(c.Request.Context(), db, eventID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook event"})
+			return
+		}
+		c.JSON(http.StatusOK, event)
+	}
+}
+
+// ReplayWebhookEventHandler retries a webhook event that ran out of retries,
+// e.g. after the bug that made it fail is fixed.
+func ReplayWebhookEventHandler(db *mongo.Database, pg *payment.Registry, notificationService *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, exists := c.Get("isAdmin")
+		if !exists || !isAdmin.(bool) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only system admins can replay webhook events"})
+			return
+		}
+		eventID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook event ID"})
+			return
+		}
+		event, err := services.ReplayWebhookEvent(c.Request.Context(), db, pg, notificationService, eventID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "only failed") {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay webhook event"})
+			return
+		}
+		c.JSON(http.StatusOK, event)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func ResolveBankAccountHandler(pg payment.PaymentGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		details, err := services.ResolveBankAccount(c.Request.Context(), pg, c.Query("bank_code"), c.Query("account_number"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"bank_code":      details.BankCode,
+			"account_number": details.AccountNumber,
+			"account_name":   details.AccountName,
+		})
+	}
+}
+
+func AddBankAccountHandler(db *mongo.Database, pg payment.PaymentGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		var request struct {
+			BankCode      string `json:"bank_code" binding:"required"`
+			AccountNumber string `json:"account_number" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		account, err := services.AddBankAccount(c.Request.Context(), db, pg, userID, request.BankCode, request.AccountNumber)
+		if err != nil {
+			if errors.Is(err, repository.ErrBankAccountExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Bank account added successfully", "bank_account": account})
+	}
+}
+
+func GetBankAccountsHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		accounts, err := services.GetBankAccounts(c.Request.Context(), db, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bank accounts"})
+			return
+		}
+		c.JSON(http.StatusOK, accounts)
+	}
+}
+
+func RemoveBankAccountHandler(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		accountID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bank account ID"})
+			return
+		}
+		if err := services.RemoveBankAccount(c.Request.Context(), db, userID, accountID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove bank account"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Bank account removed successfully"})
+	}
+}
+
+func WithdrawHandler(db *mongo.Database, pg payment.PaymentGateway) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getAuthUserID(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		var request struct {
+			Amount        money.Money        `json:"amount"`
+			BankAccountID primitive.ObjectID `json:"bank_account_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		transaction, err := services.Withdraw(c.Request.Context(), db, pg, userID, request.BankAccountID, request.Amount)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "amount") || errors.Is(err, repository.ErrInsufficientFunds) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if strings.Contains(err.Error(), "failed to initiate withdrawal") {
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Withdrawal initiated successfully", "transaction": transaction})
+	}
+}
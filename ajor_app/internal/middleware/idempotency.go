@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	IdempotencyKeyHeader   = "Idempotency-Key"
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyTTL is how long a finished request can be replayed.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLease is how long a key stays locked while its request is in
+	// flight, so a request that died mid-way doesn't block the key for a day.
+	idempotencyLease = 5 * time.Minute
+)
+
+// responseRecorder keeps a copy of everything the handler writes.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint identifies what a request asks for, so a key reused for a
+// different request can be told apart from a genuine retry.
+func requestFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotency makes a route safe to retry. A request carrying an
+// Idempotency-Key header runs once per user and key; retries with the same key
+// and body get the stored response back. Server errors are not stored, so the
+// client can retry them with the same key. It must run after AuthMiddleware.
+func Idempotency(db *mongo.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		userIDStr, exists := c.Get("userID")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(userIDStr.(string))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: requestFingerprint(c, body),
+			ExpiresAt:   time.Now().Add(idempotencyLease),
+		}
+		existing, err := repository.ReserveIdempotencyKey(c.Request.Context(), db, record)
+		if err != nil {
+			log.Printf("Failed to reserve idempotency key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if existing != nil {
+			replay(c, existing, record.Fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Store the outcome even if the client has gone away, since that is
+		// exactly when it will retry.
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := repository.ReleaseIdempotencyKey(ctx, db, record.ID); err != nil {
+				log.Printf("Failed to release idempotency key %s: %v", record.ID.Hex(), err)
+			}
+			return
+		}
+		if err := repository.CompleteIdempotencyKey(ctx, db, record.ID, status, recorder.body.Bytes(), time.Now().Add(idempotencyTTL)); err != nil {
+			log.Printf("Failed to store idempotent response %s: %v", record.ID.Hex(), err)
+		}
+	}
+}
+
+func replay(c *gin.Context, record *models.IdempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if record.Status != models.IdempotencyCompleted {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		return
+	}
+	c.Header(IdempotentReplayHeader, "true")
+	c.Data(record.ResponseStatus, "application/json; charset=utf-8", record.ResponseBody)
+	c.Abort()
+}
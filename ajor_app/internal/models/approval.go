@@ -12,14 +12,75 @@ const (
 	ApprovalPending  ApprovalStatus = "pending"
 	ApprovalApproved ApprovalStatus = "approved"
 	ApprovalRejected ApprovalStatus = "rejected"
+	// ApprovalCancelled approvals can no longer be acted on, e.g. because
+	// the payout or its group is gone. Reason says why.
+	ApprovalCancelled ApprovalStatus = "cancelled"
 )
 
+// RequeuePosition is where the recipient of a rejected payout is put back in
+// the group's rotation, if anywhere.
+type RequeuePosition string
+
+const (
+	RequeueNone  RequeuePosition = ""
+	RequeueFront RequeuePosition = "front"
+	RequeueBack  RequeuePosition = "back"
+)
+
+// ApprovalMode decides who must approve a group's payouts.
+type ApprovalMode string
+
+const (
+	// ApprovalModeAdmin leaves payouts to the group admin alone. It is the
+	// default.
+	ApprovalModeAdmin ApprovalMode = "admin"
+	// ApprovalModeTreasurers needs Threshold approvals from the group admin
+	// and the members elected as treasurers.
+	ApprovalModeTreasurers ApprovalMode = "treasurers"
+	// ApprovalModeMajority needs more than half the members to approve.
+	ApprovalModeMajority ApprovalMode = "majority"
+)
+
+// ApprovalPolicy is how a group's payouts are approved. Each payout gets an
+// approval for every approver the policy names when it is requested, and is
+// only paid once Threshold of them approve. The recipient never votes on
+// their own payout, except as the only approver.
+type ApprovalPolicy struct {
+	Mode       ApprovalMode         `json:"mode" bson:"mode"`
+	Treasurers []primitive.ObjectID `json:"treasurers,omitempty" bson:"treasurers,omitempty"`
+	Threshold  int                  `json:"threshold,omitempty" bson:"threshold,omitempty"`
+}
+
+// Approval is one approver's vote on a payout. The approvals sharing a
+// TransactionID are its approval set; Threshold of them must be approved
+// before the payout is made.
 type Approval struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	TransactionID  primitive.ObjectID `json:"transaction_id" bson:"transaction_id"`
 	ApproverID     primitive.ObjectID `json:"approver_id" bson:"approver_id"`
 	Status         ApprovalStatus     `json:"status" bson:"status"`
+	Reason         string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Threshold      int                `json:"threshold" bson:"threshold"`
 	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
 	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
-}
\ No newline at end of file
+	// DecidedBy is who voted: the approver, or someone they delegated to.
+	DecidedBy primitive.ObjectID `json:"decided_by,omitempty" bson:"decided_by,omitempty"`
+	// EscalatedAt is when the approval was escalated for not being acted on
+	// in time. It expires if it still isn't by the next deadline.
+	EscalatedAt time.Time `json:"escalated_at,omitempty" bson:"escalated_at,omitempty"`
+}
+
+// ApprovalDelegation lets DelegateID vote in DelegatorID's place on payouts
+// from StartsAt until EndsAt, on one group's payouts if ContributionID is
+// set, or else on all of them.
+type ApprovalDelegation struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	DelegatorID    primitive.ObjectID `json:"delegator_id" bson:"delegator_id"`
+	DelegateID     primitive.ObjectID `json:"delegate_id" bson:"delegate_id"`
+	ContributionID primitive.ObjectID `json:"contribution_id,omitempty" bson:"contribution_id,omitempty"`
+	StartsAt       time.Time          `json:"starts_at" bson:"starts_at"`
+	EndsAt         time.Time          `json:"ends_at" bson:"ends_at"`
+	RevokedAt      time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
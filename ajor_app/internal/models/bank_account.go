@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BankAccount is a beneficiary a user can withdraw their wallet to. The
+// account name is resolved with the payment gateway when it is added.
+type BankAccount struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	BankCode      string             `json:"bank_code" bson:"bank_code"`
+	AccountNumber string             `json:"account_number" bson:"account_number"`
+	AccountName   string             `json:"account_name" bson:"account_name"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -21,20 +22,73 @@ const (
 	TypeGroupContribution ContributionType = "group_contribution"
 )
 
+// PayoutOrderStrategy decides in which order members collect the pot.
+type PayoutOrderStrategy string
+
+const (
+	PayoutOrderJoin          PayoutOrderStrategy = "join_order"
+	PayoutOrderRandom        PayoutOrderStrategy = "random_draw"
+	PayoutOrderAdminAssigned PayoutOrderStrategy = "admin_assigned"
+	PayoutOrderBidding       PayoutOrderStrategy = "bidding"
+)
+
+type PayoutSlot struct {
+	Position int                `json:"position" bson:"position"`
+	MemberID primitive.ObjectID `json:"member_id" bson:"member_id"`
+	Username string             `json:"username,omitempty" bson:"username,omitempty"`
+	// Bid is what the member offered for this slot; it is kept back from
+	// their payout for the round's last collector.
+	Bid money.Money `json:"bid" bson:"bid"`
+}
+
+// PayoutSchedule is the collection order for one round of a group. For a
+// random draw, Seed is published so anyone can check the order: members are
+// sorted by the hex SHA-256 of Seed followed by their member ID in hex.
+type PayoutSchedule struct {
+	Strategy PayoutOrderStrategy `json:"strategy" bson:"strategy"`
+	Slots    []PayoutSlot        `json:"slots" bson:"slots"`
+	Seed     string              `json:"seed,omitempty" bson:"seed,omitempty"`
+	Locked   bool                `json:"locked" bson:"locked"`
+	LockedAt time.Time           `json:"locked_at,omitempty" bson:"locked_at,omitempty"`
+	LockedBy primitive.ObjectID  `json:"locked_by,omitempty" bson:"locked_by,omitempty"`
+
+	// SeedCommitment is the SHA-256 of Seed, published before the draw.
+	SeedCommitment string `json:"seed_commitment,omitempty" bson:"seed_commitment,omitempty"`
+}
+
 type Contribution struct {
 	ID                      primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
 	Name                    string               `json:"name" bson:"name"`
 	Description             string               `json:"description" bson:"description"`
 	Cycle                   ContributionCycle    `json:"cycle" bson:"cycle"`
-	Amount                  float64              `json:"amount" bson:"amount"`
+	Amount                  money.Money          `json:"amount" bson:"amount"`
 	CycleCount              int                  `json:"cycle_count" bson:"cycle_count"`
 	CollectionDay           string               `json:"collection_day" bson:"collection_day"`
 	CollectionDeadline      time.Time            `json:"collection_deadline" bson:"collection_deadline"`
+	CurrentCycle            int                  `json:"current_cycle" bson:"current_cycle"`
+	CycleStartedAt          time.Time            `json:"cycle_started_at" bson:"cycle_started_at"`
+	GracePeriodHours        int                  `json:"grace_period_hours" bson:"grace_period_hours"`
 	Type                    ContributionType     `json:"type" bson:"type"`
-	PenaltyAmount           float64              `json:"penalty_amount" bson:"penalty_amount"`
+	PenaltyAmount           money.Money          `json:"penalty_amount" bson:"penalty_amount"`
+	PayoutOrder             PayoutOrderStrategy  `json:"payout_order" bson:"payout_order"`
+	PayoutSchedule          *PayoutSchedule      `json:"payout_schedule,omitempty" bson:"payout_schedule,omitempty"`
+	PayoutBids              map[primitive.ObjectID]money.Money `json:"payout_bids,omitempty" bson:"payout_bids,omitempty"`
+	// DrawSeed decides the round's random draw. It stays secret until the
+	// schedule is locked; DrawCommitment, its SHA-256, is public before.
+	DrawSeed                string               `json:"-" bson:"draw_seed,omitempty"`
+	DrawCommitment          string               `json:"draw_commitment,omitempty" bson:"draw_commitment,omitempty"`
+	// BidPool is what bids have kept back from payouts and not yet paid
+	// out. It sits in the group wallet until the round's last collector is
+	// paid it.
+	BidPool                 money.Money          `json:"bid_pool" bson:"bid_pool,omitempty"`
 	YetToCollectMembers     []primitive.ObjectID `json:"yet_to_collect_members" bson:"yet_to_collect_members"`
 	AlreadyCollectedMembers []primitive.ObjectID `json:"already_collected_members" bson:"already_collected_members"`
 	GroupAdmin              primitive.ObjectID   `json:"group_admin" bson:"group_admin"`
+	// CollectorID is the esusu agent who records a daily-savings saver's
+	// deposits; the saver is the GroupAdmin.
+	CollectorID             primitive.ObjectID   `json:"collector_id,omitempty" bson:"collector_id,omitempty"`
+	// ApprovalPolicy is nil for groups whose admin approves payouts alone.
+	ApprovalPolicy          *ApprovalPolicy      `json:"approval_policy,omitempty" bson:"approval_policy,omitempty"`
 	AdminUsername           string               `json:"admin_username" bson:"admin_username"`
 	MemberUsernames         map[primitive.ObjectID]string `json:"member_usernames" bson:"member_usernames"`
 	WalletID                primitive.ObjectID   `json:"wallet_id" bson:"wallet_id"`
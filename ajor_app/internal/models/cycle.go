@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CycleWindow is one collection period of a contribution. Payments are due by
+// DueAt and count as late once GraceUntil has passed.
+type CycleWindow struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
+	Number         int                `json:"number" bson:"number"`
+	OpensAt        time.Time          `json:"opens_at" bson:"opens_at"`
+	DueAt          time.Time          `json:"due_at" bson:"due_at"`
+	GraceUntil     time.Time          `json:"grace_until" bson:"grace_until"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type MemberCycleStatus string
+
+const (
+	MemberCycleExpected MemberCycleStatus = "expected"
+	MemberCyclePaid     MemberCycleStatus = "paid"
+	MemberCycleLate     MemberCycleStatus = "late"
+	MemberCycleWaived   MemberCycleStatus = "waived"
+)
+
+// MemberCycle is what one member owes a contribution for one cycle and
+// whether they have paid it.
+type MemberCycle struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Username       string             `json:"username,omitempty" bson:"-"`
+	Cycle          int                `json:"cycle" bson:"cycle"`
+	Amount         money.Money        `json:"amount" bson:"amount"`
+	Status         MemberCycleStatus  `json:"status" bson:"status"`
+	TransactionID  primitive.ObjectID `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	PaidAt         time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	WaivedBy       primitive.ObjectID `json:"waived_by,omitempty" bson:"waived_by,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
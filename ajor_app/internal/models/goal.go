@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GoalStatus string
+
+const (
+	GoalActive    GoalStatus = "active"
+	GoalCompleted GoalStatus = "completed"
+	GoalBroken    GoalStatus = "broken"
+)
+
+// SavingsGoal is a personal target saved up in its own goal wallet. The money
+// is locked until TargetDate; breaking the goal early, if allowed, forfeits
+// EarlyBreakPenaltyPercent of the savings.
+type SavingsGoal struct {
+	ID                       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID                   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name                     string             `json:"name" bson:"name"`
+	WalletID                 primitive.ObjectID `json:"wallet_id" bson:"wallet_id"`
+	TargetAmount             money.Money        `json:"target_amount" bson:"target_amount"`
+	TargetDate               time.Time          `json:"target_date" bson:"target_date"`
+	AutoDebitAmount          money.Money        `json:"auto_debit_amount" bson:"auto_debit_amount"`
+	AutoDebitCycle           ContributionCycle  `json:"auto_debit_cycle,omitempty" bson:"auto_debit_cycle,omitempty"`
+	NextDebitAt              time.Time          `json:"next_debit_at,omitempty" bson:"next_debit_at,omitempty"`
+	AllowEarlyBreak          bool               `json:"allow_early_break" bson:"allow_early_break"`
+	EarlyBreakPenaltyPercent int                `json:"early_break_penalty_percent" bson:"early_break_penalty_percent"`
+	Status                   GoalStatus         `json:"status" bson:"status"`
+	CreatedAt                time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt                time.Time          `json:"updated_at" bson:"updated_at"`
+	ClosedAt                 time.Time          `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+}
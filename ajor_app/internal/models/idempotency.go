@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyProcessing IdempotencyStatus = "processing"
+	IdempotencyCompleted  IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord remembers a request sent with an Idempotency-Key header so
+// a retry with the same key gets the original response instead of running again.
+type IdempotencyRecord struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Key            string             `json:"key" bson:"key"`
+	Fingerprint    string             `json:"fingerprint" bson:"fingerprint"`
+	Status         IdempotencyStatus  `json:"status" bson:"status"`
+	ResponseStatus int                `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	ResponseBody   []byte             `json:"-" bson:"response_body,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt      time.Time          `json:"expires_at" bson:"expires_at"`
+}
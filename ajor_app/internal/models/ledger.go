@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerAccount string
+type JournalStatus string
+
+// Wallet legs move a wallet's balance; the other accounts represent money
+// held outside the platform's wallets so every entry can still balance.
+const (
+	AccountWallet          LedgerAccount = "wallet"
+	AccountGatewayClearing LedgerAccount = "gateway_clearing"
+	AccountOpeningBalance  LedgerAccount = "opening_balance"
+	AccountPlatformRevenue LedgerAccount = "platform_revenue"
+	// AccountWithdrawalsInTransit holds withdrawn money until the gateway
+	// reports whether the bank transfer went through.
+	AccountWithdrawalsInTransit LedgerAccount = "withdrawals_in_transit"
+)
+
+const (
+	JournalPending JournalStatus = "pending"
+	JournalPosted  JournalStatus = "posted"
+)
+
+type LedgerLeg struct {
+	Account  LedgerAccount      `json:"account" bson:"account"`
+	WalletID primitive.ObjectID `json:"wallet_id,omitempty" bson:"wallet_id,omitempty"`
+	Debit    money.Money        `json:"debit" bson:"debit"`
+	Credit   money.Money        `json:"credit" bson:"credit"`
+}
+
+type JournalEntry struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TransactionID primitive.ObjectID `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	Description   string             `json:"description" bson:"description"`
+	Legs          []LedgerLeg        `json:"legs" bson:"legs"`
+	Status        JournalStatus      `json:"status" bson:"status"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	PostedAt      time.Time          `json:"posted_at,omitempty" bson:"posted_at,omitempty"`
+}
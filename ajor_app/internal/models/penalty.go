@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PenaltyStatus string
+
+const (
+	PenaltyOutstanding PenaltyStatus = "outstanding"
+	PenaltyPaid        PenaltyStatus = "paid"
+)
+
+// Penalty is the late fee a member owes a group for one cycle. It stays
+// outstanding, counting towards the member's arrears, until it can be debited.
+type Penalty struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Cycle          int                `json:"cycle" bson:"cycle"`
+	Amount         money.Money        `json:"amount" bson:"amount"`
+	Status         PenaltyStatus      `json:"status" bson:"status"`
+	TransactionID  primitive.ObjectID `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	PaidAt         time.Time          `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+}
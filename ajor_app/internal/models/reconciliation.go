@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReconciliationIssue string
+
+const (
+	// ReconMissingTransaction is a successful charge we have no transaction
+	// for: money the gateway took that no wallet was credited with.
+	ReconMissingTransaction ReconciliationIssue = "missing_transaction"
+	// ReconMissingCharge is a successful funding transaction the gateway has
+	// no charge for: a wallet credited with money we never received.
+	ReconMissingCharge ReconciliationIssue = "missing_charge"
+	// ReconStatusMismatch is a charge that succeeded on one side only.
+	ReconStatusMismatch ReconciliationIssue = "status_mismatch"
+	// ReconAmountMismatch is a charge credited with a different amount than
+	// the gateway took.
+	ReconAmountMismatch ReconciliationIssue = "amount_mismatch"
+)
+
+// ReconciliationItem is a charge or funding transaction that didn't match.
+// The gateway's side is empty for ReconMissingCharge, ours for
+// ReconMissingTransaction.
+type ReconciliationItem struct {
+	Issue         ReconciliationIssue `json:"issue" bson:"issue"`
+	TxRef         string              `json:"tx_ref" bson:"tx_ref"`
+	ChargeID      string              `json:"charge_id,omitempty" bson:"charge_id,omitempty"`
+	ChargeStatus  string              `json:"charge_status,omitempty" bson:"charge_status,omitempty"`
+	ChargeAmount  *money.Money        `json:"charge_amount,omitempty" bson:"charge_amount,omitempty"`
+	TransactionID primitive.ObjectID  `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	WalletID      primitive.ObjectID  `json:"wallet_id,omitempty" bson:"wallet_id,omitempty"`
+	Status        TransactionStatus   `json:"status,omitempty" bson:"status,omitempty"`
+	Amount        *money.Money        `json:"amount,omitempty" bson:"amount,omitempty"`
+}
+
+// ReconciliationReport compares the charges the gateway made from From up to
+// To with the funding transactions we recorded, matched by TxRef. Unmatched
+// items exist on one side only; Mismatched items exist on both but disagree.
+// WalletTotal is the sum of every wallet balance when the report was made,
+// for comparison with GatewayBalance. The totals are in naira; amounts in
+// other currencies are matched but left out of them.
+type ReconciliationReport struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	From           time.Time            `json:"from" bson:"from"`
+	To             time.Time            `json:"to" bson:"to"`
+	Charges        int                  `json:"charges" bson:"charges"`
+	Matched        int                  `json:"matched" bson:"matched"`
+	Unmatched      []ReconciliationItem `json:"unmatched" bson:"unmatched"`
+	Mismatched     []ReconciliationItem `json:"mismatched" bson:"mismatched"`
+	ChargedTotal   money.Money          `json:"charged_total" bson:"charged_total"`
+	CreditedTotal  money.Money          `json:"credited_total" bson:"credited_total"`
+	WalletTotal    money.Money          `json:"wallet_total" bson:"wallet_total"`
+	GatewayBalance money.Money          `json:"gateway_balance" bson:"gateway_balance"`
+	CreatedAt      time.Time            `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StandingOrder is a member's opt-in to have their contribution debited from
+// their wallet on each cycle's due date. Attempts counts the failed debits for
+// the cycle being paid; after MaxRetries of them the cycle is left to the
+// member.
+type StandingOrder struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
+	UserID         primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Active         bool               `json:"active" bson:"active"`
+	MaxRetries     int                `json:"max_retries" bson:"max_retries"`
+	Attempts       int                `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError      string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,12 +15,22 @@ const (
 	TransactionContribution TransactionType = "contribution"
 	TransactionPayout       TransactionType = "payout"
 	TransactionWallet       TransactionType = "wallet"
+	TransactionPenalty      TransactionType = "penalty"
+	TransactionDeposit      TransactionType = "deposit"
+	TransactionCollectorFee TransactionType = "collector_fee"
+	TransactionSettlement   TransactionType = "settlement"
+	TransactionGoal         TransactionType = "goal"
+	TransactionFee          TransactionType = "fee"
+	TransactionWithdrawal   TransactionType = "withdrawal"
 )
 
 const (
 	StatusPending TransactionStatus = "pending"
 	StatusSuccess TransactionStatus = "success"
 	StatusFailed  TransactionStatus = "failed"
+	// StatusDiscrepancy marks money the gateway reported that didn't match
+	// what we expected. It is not credited until an admin looks into it.
+	StatusDiscrepancy TransactionStatus = "discrepancy"
 )
 
 const (
@@ -33,12 +44,32 @@ type Transaction struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	FromWallet     primitive.ObjectID `json:"from_wallet" bson:"from_wallet"`
 	ToWallet       primitive.ObjectID `json:"to_wallet" bson:"to_wallet"`
-	Amount         float64            `json:"amount" bson:"amount"`
+	Amount         money.Money        `json:"amount" bson:"amount"`
 	Type           TransactionType    `json:"type" bson:"type"`
 	Date           time.Time          `json:"date" bson:"date"`
 	PaymentMethod  PaymentMethod      `json:"payment_method" bson:"payment_method"`
 	Status         TransactionStatus  `json:"status" bson:"status"`
 	ContributionID primitive.ObjectID `json:"contribution_id" bson:"contribution_id"`
+	Cycle          int                `json:"cycle,omitempty" bson:"cycle,omitempty"`
 	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
 	TxRef          string             `json:"tx_ref" bson:"tx_ref"`
+	// BankAccountID and GatewayReference are set on withdrawals: the
+	// beneficiary paid and the gateway's ID for the transfer. GatewayStatus
+	// and GatewayMessage track the transfer as the gateway last reported it.
+	// Transfers into a virtual account carry the gateway's ID for the charge
+	// as their GatewayReference.
+	BankAccountID    primitive.ObjectID `json:"bank_account_id,omitempty" bson:"bank_account_id,omitempty"`
+	GatewayReference string             `json:"gateway_reference,omitempty" bson:"gateway_reference,omitempty"`
+	GatewayStatus    string             `json:"gateway_status,omitempty" bson:"gateway_status,omitempty"`
+	GatewayMessage   string             `json:"gateway_message,omitempty" bson:"gateway_message,omitempty"`
+	// Discrepancy says why a transaction has StatusDiscrepancy.
+	Discrepancy string `json:"discrepancy,omitempty" bson:"discrepancy,omitempty"`
+	// RequestedBy is who asked for a payout; payouts the rotation assigns
+	// have none. FailureReason says why a payout was rejected.
+	RequestedBy   primitive.ObjectID `json:"requested_by,omitempty" bson:"requested_by,omitempty"`
+	FailureReason string             `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	// BidKept is the collector's bid kept back from a payout, and BidShare
+	// the kept bids paid on top of it to a round's last collector.
+	BidKept  money.Money `json:"bid_kept" bson:"bid_kept,omitempty"`
+	BidShare money.Money `json:"bid_share" bson:"bid_share,omitempty"`
 }
@@ -20,6 +20,7 @@ type User struct {
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 	ResetToken string `json:"reset_token" bson:"reset_token"`
 	ResetTokenExpiry time.Time `json:"reset_token_expiry" bson:"reset_token_expiry"`
+	BankAccounts []BankAccount `json:"bank_accounts,omitempty" bson:"bank_accounts,omitempty"`
 }
 
 type UserResponse struct {
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -11,16 +12,18 @@ type WalletType string
 const (
 	WalletTypeUser         WalletType = "user"
 	WalletTypeContribution WalletType = "contribution"
+	WalletTypeGoal         WalletType = "goal"
 )
 
 type Wallet struct {
-	ID                   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	OwnerID              primitive.ObjectID `json:"owner_id" bson:"owner_id"`
-	Type                 WalletType         `json:"type" bson:"type"`
-	Balance              float64            `json:"balance" bson:"balance"`
-	VirtualAccountID     string             `json:"virtual_account_id" bson:"virtual_account_id"`
-	VirtualAccountNumber string             `json:"virtual_account_number" bson:"virtual_account_number"`
-	VirtualBankName      string             `json:"virtual_bank_name" bson:"virtual_bank_name"`
-	CreatedAt            time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt            time.Time          `json:"updated_at" bson:"updated_at"`
+	ID                   primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	OwnerID              primitive.ObjectID   `json:"owner_id" bson:"owner_id"`
+	Type                 WalletType           `json:"type" bson:"type"`
+	Balance              money.Money          `json:"balance" bson:"balance"`
+	VirtualAccountID     string               `json:"virtual_account_id" bson:"virtual_account_id"`
+	VirtualAccountNumber string               `json:"virtual_account_number" bson:"virtual_account_number"`
+	VirtualBankName      string               `json:"virtual_bank_name" bson:"virtual_bank_name"`
+	PendingEntries       []primitive.ObjectID `json:"-" bson:"pending_entries,omitempty"`
+	CreatedAt            time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt            time.Time            `json:"updated_at" bson:"updated_at"`
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebhookEventStatus string
+
+const (
+	// WebhookPending events are waiting to be processed, or retried after an
+	// error.
+	WebhookPending   WebhookEventStatus = "pending"
+	WebhookProcessed WebhookEventStatus = "processed"
+	// WebhookFailed events ran out of retries and wait for an admin to
+	// replay them.
+	WebhookFailed WebhookEventStatus = "failed"
+)
+
+// WebhookEvent is a verified webhook as the provider sent it. EventID is the
+// provider's ID for the event, so a webhook the provider sends twice is only
+// stored once. Result is what processing made of it, e.g. "ignored" when no
+// transaction matched.
+type WebhookEvent struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Provider      string             `json:"provider" bson:"provider"`
+	EventID       string             `json:"event_id" bson:"event_id"`
+	EventType     string             `json:"event_type" bson:"event_type"`
+	Payload       string             `json:"payload" bson:"payload"`
+	Status        WebhookEventStatus `json:"status" bson:"status"`
+	Result        string             `json:"result,omitempty" bson:"result,omitempty"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	ReceivedAt    time.Time          `json:"received_at" bson:"received_at"`
+	ProcessedAt   time.Time          `json:"processed_at,omitempty" bson:"processed_at,omitempty"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
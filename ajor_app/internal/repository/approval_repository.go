@@ -19,11 +19,16 @@ func CreateApproval(ctx context.Context, db *mongo.Database, approval *models.Ap
 	return err
 }
 
-func UpdateApproval(ctx context.Context, db *mongo.Database, approvalID primitive.ObjectID, status models.ApprovalStatus) error {
-	filter := bson.M{"_id": approvalID}
+// UpdateApproval moves a pending approval to its final status, recording who
+// decided it and their reason if they gave one. Approvals that were already
+// processed are left untouched so a payout can't run twice.
+func UpdateApproval(ctx context.Context, db *mongo.Database, approvalID primitive.ObjectID, status models.ApprovalStatus, reason string, decidedBy primitive.ObjectID) error {
+	filter := bson.M{"_id": approvalID, "status": models.ApprovalPending}
 	update := bson.M{
 		"$set": bson.M{
 			"status":     status,
+			"reason":     reason,
+			"decided_by": decidedBy,
 			"updated_at": time.Now(),
 		},
 	}
@@ -32,16 +37,118 @@ func UpdateApproval(ctx context.Context, db *mongo.Database, approvalID primitiv
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("approval not found")
+		return errors.New("approval not found or already processed")
 	}
 	return nil
 }
 
-func GetPendingApprovals(ctx context.Context, db *mongo.Database, approverID primitive.ObjectID) ([]*models.Approval, error) {
+// CancelApproval cancels a pending approval, recording why.
+func CancelApproval(ctx context.Context, db *mongo.Database, approvalID primitive.ObjectID, reason string) error {
+	filter := bson.M{"_id": approvalID, "status": models.ApprovalPending}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.ApprovalCancelled,
+			"reason":     reason,
+			"updated_at": time.Now(),
+		},
+	}
+	result, err := db.Collection("approvals").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("approval not found or already processed")
+	}
+	return nil
+}
+
+// EscalateApproval marks a pending approval as escalated. Only the first call
+// succeeds, so an approval is escalated once.
+func EscalateApproval(ctx context.Context, db *mongo.Database, approvalID primitive.ObjectID, at time.Time) error {
+	filter := bson.M{
+		"_id":          approvalID,
+		"status":       models.ApprovalPending,
+		"escalated_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"escalated_at": at, "updated_at": time.Now()}}
+	result, err := db.Collection("approvals").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("approval not found or already escalated")
+	}
+	return nil
+}
+
+// GetOverdueApprovals returns the pending approvals created, or escalated if
+// they have been, before the given time.
+func GetOverdueApprovals(ctx context.Context, db *mongo.Database, before time.Time) ([]*models.Approval, error) {
+	cursor, err := db.Collection("approvals").Find(ctx, bson.M{
+		"status": models.ApprovalPending,
+		"$or": bson.A{
+			bson.M{"escalated_at": bson.M{"$exists": false}, "created_at": bson.M{"$lt": before}},
+			bson.M{"escalated_at": bson.M{"$lt": before}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var approvals []*models.Approval
+	if err := cursor.All(ctx, &approvals); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// GetApprovalsByTransaction returns a payout's approval set.
+func GetApprovalsByTransaction(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID) ([]*models.Approval, error) {
+	cursor, err := db.Collection("approvals").Find(ctx, bson.M{"transaction_id": transactionID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var approvals []*models.Approval
+	if err := cursor.All(ctx, &approvals); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// GetPendingApprovalsCreatedBefore returns every pending approval, whoever
+// it waits on, created before the given time.
+func GetPendingApprovalsCreatedBefore(ctx context.Context, db *mongo.Database, before time.Time) ([]*models.Approval, error) {
+	cursor, err := db.Collection("approvals").Find(ctx, bson.M{
+		"status":     models.ApprovalPending,
+		"created_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var approvals []*models.Approval
+	if err := cursor.All(ctx, &approvals); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// GetPendingApprovals returns the pending approvals of approverID and of
+// everyone who has delegated to them through the given delegations.
+func GetPendingApprovals(ctx context.Context, db *mongo.Database, approverID primitive.ObjectID, delegations []*models.ApprovalDelegation) ([]*models.Approval, error) {
+	approvers := bson.A{bson.M{"approver_id": approverID}}
+	for _, delegation := range delegations {
+		delegated := bson.M{"approver_id": delegation.DelegatorID}
+		if !delegation.ContributionID.IsZero() {
+			delegated["contribution_id"] = delegation.ContributionID
+		}
+		approvers = append(approvers, delegated)
+	}
 	var approvals []*models.Approval
 	cursor, err := db.Collection("approvals").Find(ctx, bson.M{
-		"approver_id": approverID,
-		"status":      models.ApprovalPending,
+		"$or":    approvers,
+		"status": models.ApprovalPending,
 	})
 	if err != nil {
 		return nil, err
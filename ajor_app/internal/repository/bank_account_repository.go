@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrBankAccountExists is returned when a user adds a bank account they
+// already have.
+var ErrBankAccountExists = errors.New("bank account already added")
+
+// AddBankAccount adds a beneficiary to a user unless they already have the
+// same account.
+func AddBankAccount(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, account *models.BankAccount) error {
+	account.ID = primitive.NewObjectID()
+	account.CreatedAt = time.Now()
+	filter := bson.M{
+		"_id": userID,
+		"bank_accounts": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"bank_code":      account.BankCode,
+			"account_number": account.AccountNumber,
+		}}},
+	}
+	update := bson.M{
+		"$push": bson.M{"bank_accounts": account},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	result, err := db.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrBankAccountExists
+	}
+	return nil
+}
+
+func RemoveBankAccount(ctx context.Context, db *mongo.Database, userID, accountID primitive.ObjectID) error {
+	update := bson.M{
+		"$pull": bson.M{"bank_accounts": bson.M{"_id": accountID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	result, err := db.Collection("users").UpdateOne(ctx, bson.M{"_id": userID, "bank_accounts._id": accountID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("bank account not found")
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -42,11 +43,14 @@ func GetAllContributions(db *mongo.Database) ([]*models.Contribution, error) {
 	return contributions, nil
 }
 
+// ErrContributionNotFound is returned when a contribution doesn't exist.
+var ErrContributionNotFound = errors.New("contribution not found")
+
 func GetContributionByID(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.Contribution, error) {
 	var contribution models.Contribution
 	err := db.Collection("contributions").FindOne(ctx, bson.M{"_id": id}).Decode(&contribution)
 	if err == mongo.ErrNoDocuments {
-		return nil, errors.New("contribution not found")
+		return nil, ErrContributionNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -89,7 +93,7 @@ func GetContributionByInviteCode(ctx context.Context, db *mongo.Database, invite
 	err := db.Collection("contributions").FindOne(ctx, bson.M{"invite_code": inviteCode}).Decode(&contribution)
 
 	if err == mongo.ErrNoDocuments {
-		return nil, errors.New("contribution not found")
+		return nil, ErrContributionNotFound
 	}
 
 	if err != nil {
@@ -106,6 +110,7 @@ func GetContributionsByUser(ctx context.Context, db *mongo.Database, userID prim
 			{"group_admin": userID},
 			{"yet_to_collect_members": userID},
 			{"already_collected_members": userID},
+			{"collector_id": userID},
 		},
 	})
 	if err != nil {
@@ -135,6 +140,7 @@ func UpdateContribution(ctx context.Context, db *mongo.Database, id primitive.Ob
 			"collection_deadline": contribution.CollectionDeadline,
 			"type":                contribution.Type,
 			"penalty_amount":      contribution.PenaltyAmount,
+			"payout_order":        contribution.PayoutOrder,
 			"updated_at":          time.Now(),
 		},
 	}
@@ -143,7 +149,7 @@ func UpdateContribution(ctx context.Context, db *mongo.Database, id primitive.Ob
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("contribution not found")
+		return ErrContributionNotFound
 	}
 	return nil
 }
@@ -159,7 +165,7 @@ func DecrementCycleCount(ctx context.Context, db *mongo.Database, contributionID
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("contribution not found")
+		return ErrContributionNotFound
 	}
 	return nil
 }
@@ -178,7 +184,7 @@ func RemoveMember(ctx context.Context, db *mongo.Database, contributionID, userI
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("contribution not found")
+		return ErrContributionNotFound
 	}
 	return nil
 }
@@ -194,7 +200,7 @@ func JoinContribution(ctx context.Context, db *mongo.Database, contributionID, u
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("contribution not found")
+		return ErrContributionNotFound
 	}
 	return nil
 }
@@ -211,7 +217,7 @@ func MarkMemberCollected(ctx context.Context, db *mongo.Database, contributionID
 		return err
 	}
 	if result.MatchedCount == 0 {
-		return errors.New("contribution not found")
+		return ErrContributionNotFound
 	}
 	return nil
 }
@@ -225,3 +231,240 @@ func UpdateContributionMemberUsernames(ctx context.Context, db *mongo.Database,
 	)
 	return err
 }
+
+// GetContributionsDueForRotation returns group contributions whose current
+// cycle deadline has passed and which still have cycles left to run.
+func GetContributionsDueForRotation(ctx context.Context, db *mongo.Database, now time.Time) ([]*models.Contribution, error) {
+	return findContributions(ctx, db, bson.M{
+		"type":                models.TypeGroupContribution,
+		"cycle_count":         bson.M{"$gt": 0},
+		"collection_deadline": bson.M{"$lte": now},
+	})
+}
+
+// GetDailySavingsDueForSettlement returns daily-savings contributions whose
+// current month has ended.
+func GetDailySavingsDueForSettlement(ctx context.Context, db *mongo.Database, now time.Time) ([]*models.Contribution, error) {
+	return findContributions(ctx, db, bson.M{
+		"type":                models.TypeDailySavings,
+		"collection_deadline": bson.M{"$lte": now},
+	})
+}
+
+func findContributions(ctx context.Context, db *mongo.Database, filter bson.M) ([]*models.Contribution, error) {
+	cursor, err := db.Collection("contributions").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var contributions []*models.Contribution
+	if err := cursor.All(ctx, &contributions); err != nil {
+		return nil, err
+	}
+	return contributions, nil
+}
+
+// ErrCycleAlreadyAdvanced is returned when another run moved the contribution
+// past the cycle the caller was closing.
+var ErrCycleAlreadyAdvanced = errors.New("contribution cycle already advanced")
+
+// AdvanceContributionCycle closes the cycle ending at closedDeadline and opens
+// cycle number nextCycle, provided no one else has closed it first.
+func AdvanceContributionCycle(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, closedDeadline time.Time, nextCycle int, nextDeadline time.Time) error {
+	filter := bson.M{"_id": contributionID, "collection_deadline": closedDeadline}
+	update := bson.M{
+		"$set": bson.M{
+			"current_cycle":       nextCycle,
+			"cycle_started_at":    closedDeadline,
+			"collection_deadline": nextDeadline,
+			"updated_at":          time.Now(),
+		},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCycleAlreadyAdvanced
+	}
+	return nil
+}
+
+// ResetContributionRotation starts a new round in which every member is
+// waiting to collect again. Clearing the schedule lets the payout order
+// strategy decide the new round afresh, with a new draw seed.
+func ResetContributionRotation(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, members []primitive.ObjectID, clearSchedule bool) error {
+	filter := bson.M{"_id": contributionID}
+	update := bson.M{
+		"$set": bson.M{
+			"yet_to_collect_members":    members,
+			"already_collected_members": []primitive.ObjectID{},
+			"updated_at":                time.Now(),
+		},
+	}
+	if clearSchedule {
+		update["$unset"] = bson.M{"payout_schedule": "", "payout_bids": "", "draw_seed": "", "draw_commitment": ""}
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrContributionNotFound
+	}
+	return nil
+}
+
+// RequeueMember puts a member back among those waiting to collect, with the
+// given order of members waiting and, if the round's schedule is locked, the
+// schedule reordered to match.
+func RequeueMember(ctx context.Context, db *mongo.Database, contributionID, memberID primitive.ObjectID, yetToCollect []primitive.ObjectID, schedule *models.PayoutSchedule) error {
+	filter := bson.M{"_id": contributionID}
+	set := bson.M{
+		"yet_to_collect_members": yetToCollect,
+		"updated_at":             time.Now(),
+	}
+	if schedule != nil {
+		set["payout_schedule"] = schedule
+	}
+	update := bson.M{
+		"$set":  set,
+		"$pull": bson.M{"already_collected_members": memberID},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrContributionNotFound
+	}
+	return nil
+}
+
+// ErrPayoutScheduleLocked is returned when the payout order of the current
+// round has already been fixed.
+var ErrPayoutScheduleLocked = errors.New("payout schedule is already locked")
+
+// LockPayoutSchedule fixes the payout order for the current round. It fails
+// if a schedule was locked first.
+func LockPayoutSchedule(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, schedule *models.PayoutSchedule) error {
+	filter := bson.M{"_id": contributionID, "payout_schedule": nil}
+	update := bson.M{
+		"$set": bson.M{
+			"payout_schedule": schedule,
+			"updated_at":      time.Now(),
+		},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPayoutScheduleLocked
+	}
+	return nil
+}
+
+// SetDrawSeed stores the seed of a group's next random draw and its
+// commitment, unless it has one already. It returns the seed and commitment
+// the group ends up with.
+func SetDrawSeed(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, seed, commitment string) (string, string, error) {
+	filter := bson.M{"_id": contributionID, "draw_seed": nil}
+	update := bson.M{"$set": bson.M{"draw_seed": seed, "draw_commitment": commitment}}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return "", "", err
+	}
+	if result.MatchedCount == 1 {
+		return seed, commitment, nil
+	}
+	contribution, err := GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return "", "", err
+	}
+	return contribution.DrawSeed, contribution.DrawCommitment, nil
+}
+
+// AdjustBidPool adds delta to what bids have kept back in a group's wallet. A
+// group that is gone has no pool left to adjust.
+func AdjustBidPool(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, delta money.Money) error {
+	if delta.IsZero() {
+		return nil
+	}
+	_, err := db.Collection("contributions").UpdateOne(ctx, bson.M{"_id": contributionID}, bson.M{
+		"$inc": bson.M{"bid_pool.amount": delta.Kobo},
+		"$set": bson.M{"bid_pool.currency": delta.Currency, "updated_at": time.Now()},
+	})
+	return err
+}
+
+// SetPayoutBid records or replaces a member's bid while the schedule is open.
+func SetPayoutBid(ctx context.Context, db *mongo.Database, contributionID, memberID primitive.ObjectID, bid money.Money) error {
+	filter := bson.M{"_id": contributionID, "payout_schedule": nil}
+	update := bson.M{
+		"$set": bson.M{
+			"payout_bids." + memberID.Hex(): bid,
+			"updated_at":                    time.Now(),
+		},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrPayoutScheduleLocked
+	}
+	return nil
+}
+
+func SetContributionCollector(ctx context.Context, db *mongo.Database, contributionID, collectorID primitive.ObjectID) error {
+	filter := bson.M{"_id": contributionID}
+	update := bson.M{
+		"$set": bson.M{
+			"collector_id": collectorID,
+			"updated_at":   time.Now(),
+		},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrContributionNotFound
+	}
+	return nil
+}
+
+// LockContribution writes to a contribution inside a session transaction, so
+// that concurrent session transactions that check and change its payouts
+// conflict and are retried one after the other.
+func LockContribution(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID) error {
+	result, err := db.Collection("contributions").UpdateOne(ctx, bson.M{"_id": contributionID}, bson.M{"$set": bson.M{"updated_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrContributionNotFound
+	}
+	return nil
+}
+
+// SetApprovalPolicy replaces how a group's payouts are approved. A nil policy
+// leaves them to the group admin.
+func SetApprovalPolicy(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, policy *models.ApprovalPolicy) error {
+	filter := bson.M{"_id": contributionID}
+	update := bson.M{
+		"$set": bson.M{
+			"approval_policy": policy,
+			"updated_at":      time.Now(),
+		},
+	}
+	result, err := db.Collection("contributions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrContributionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMemberCycleSettled is returned when waiving a cycle the member has
+// already paid.
+var ErrMemberCycleSettled = errors.New("member has already paid for this cycle")
+
+// EnsureCycleIndexes keeps one window per cycle number, and one record and one
+// contribution payment per member per cycle.
+func EnsureCycleIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("contribution_cycles").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "contribution_id", Value: 1}, {Key: "number", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("member_cycles").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "contribution_id", Value: 1}, {Key: "cycle", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "contribution_id", Value: 1}, {Key: "from_wallet", Value: 1}, {Key: "cycle", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"type":  models.TransactionContribution,
+			"cycle": bson.M{"$gt": 0},
+		}),
+	})
+	return err
+}
+
+// CreateCycleWindow stores a window unless one with the same number exists,
+// and returns whichever is stored.
+func CreateCycleWindow(ctx context.Context, db *mongo.Database, window *models.CycleWindow) (*models.CycleWindow, error) {
+	window.CreatedAt = time.Now()
+	filter := bson.M{"contribution_id": window.ContributionID, "number": window.Number}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var stored models.CycleWindow
+	err := db.Collection("contribution_cycles").FindOneAndUpdate(ctx, filter, bson.M{"$setOnInsert": bson.M{
+		"opens_at":    window.OpensAt,
+		"due_at":      window.DueAt,
+		"grace_until": window.GraceUntil,
+		"created_at":  window.CreatedAt,
+	}}, opts).Decode(&stored)
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func GetCycleWindow(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, number int) (*models.CycleWindow, error) {
+	var window models.CycleWindow
+	err := db.Collection("contribution_cycles").FindOne(ctx, bson.M{"contribution_id": contributionID, "number": number}).Decode(&window)
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func GetLatestCycleWindow(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID) (*models.CycleWindow, error) {
+	var window models.CycleWindow
+	opts := options.FindOne().SetSort(bson.D{{Key: "number", Value: -1}})
+	err := db.Collection("contribution_cycles").FindOne(ctx, bson.M{"contribution_id": contributionID}, opts).Decode(&window)
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func GetCycleWindows(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID) ([]*models.CycleWindow, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "number", Value: 1}})
+	cursor, err := db.Collection("contribution_cycles").Find(ctx, bson.M{"contribution_id": contributionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var windows []*models.CycleWindow
+	if err := cursor.All(ctx, &windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// GetPaidCycles returns the cycle numbers a wallet has paid its contribution
+// for.
+func GetPaidCycles(ctx context.Context, db *mongo.Database, contributionID, walletID primitive.ObjectID) (map[int]bool, error) {
+	values, err := db.Collection("transactions").Distinct(ctx, "cycle", bson.M{
+		"contribution_id": contributionID,
+		"from_wallet":     walletID,
+		"type":            models.TransactionContribution,
+		"status":          models.StatusSuccess,
+		"cycle":           bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+	paid := make(map[int]bool, len(values))
+	for _, v := range values {
+		switch n := v.(type) {
+		case int32:
+			paid[int(n)] = true
+		case int64:
+			paid[int(n)] = true
+		}
+	}
+	return paid, nil
+}
+
+// ExpectMemberCycles records that each member owes amount for a cycle. Members
+// who already have a record for it are left as they are.
+func ExpectMemberCycles(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, cycle int, members []primitive.ObjectID, amount money.Money) error {
+	if len(members) == 0 {
+		return nil
+	}
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(members))
+	for _, member := range members {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"contribution_id": contributionID, "cycle": cycle, "user_id": member}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{
+				"amount":     amount,
+				"status":     models.MemberCycleExpected,
+				"created_at": now,
+				"updated_at": now,
+			}}).
+			SetUpsert(true))
+	}
+	_, err := db.Collection("member_cycles").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// RecordMemberCyclePayment marks a member's cycle as paid or late by the
+// given transaction.
+func RecordMemberCyclePayment(ctx context.Context, db *mongo.Database, record *models.MemberCycle) error {
+	now := time.Now()
+	filter := bson.M{"contribution_id": record.ContributionID, "cycle": record.Cycle, "user_id": record.UserID}
+	update := bson.M{
+		"$set": bson.M{
+			"amount":         record.Amount,
+			"status":         record.Status,
+			"transaction_id": record.TransactionID,
+			"paid_at":        record.PaidAt,
+			"updated_at":     now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	_, err := db.Collection("member_cycles").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// WaiveMemberCycle excuses a member from paying for a cycle, unless they have
+// already paid it.
+func WaiveMemberCycle(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID, cycle int, amount money.Money, waivedBy primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.M{
+		"contribution_id": contributionID,
+		"cycle":           cycle,
+		"user_id":         userID,
+		"status":          bson.M{"$nin": []models.MemberCycleStatus{models.MemberCyclePaid, models.MemberCycleLate}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.MemberCycleWaived,
+			"waived_by":  waivedBy,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{"amount": amount, "created_at": now},
+	}
+	_, err := db.Collection("member_cycles").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	// The upsert collides with the paid record the filter skipped
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMemberCycleSettled
+	}
+	return err
+}
+
+// GetMemberCycles returns a contribution's member cycle records ordered by
+// cycle. A zero userID returns every member's and a cycle of 0 every cycle's.
+func GetMemberCycles(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID, cycle int) ([]*models.MemberCycle, error) {
+	filter := bson.M{"contribution_id": contributionID}
+	if !userID.IsZero() {
+		filter["user_id"] = userID
+	}
+	if cycle > 0 {
+		filter["cycle"] = cycle
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "cycle", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.Collection("member_cycles").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var records []*models.MemberCycle
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
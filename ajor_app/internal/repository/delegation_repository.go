@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateApprovalDelegation(ctx context.Context, db *mongo.Database, delegation *models.ApprovalDelegation) error {
+	delegation.CreatedAt = time.Now()
+	result, err := db.Collection("approval_delegations").InsertOne(ctx, delegation)
+	if err != nil {
+		return err
+	}
+	delegation.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetActiveApprovalDelegations returns the delegations to delegateID that
+// are in force at the given time.
+func GetActiveApprovalDelegations(ctx context.Context, db *mongo.Database, delegateID primitive.ObjectID, at time.Time) ([]*models.ApprovalDelegation, error) {
+	return findApprovalDelegations(ctx, db, bson.M{
+		"delegate_id": delegateID,
+		"starts_at":   bson.M{"$lte": at},
+		"ends_at":     bson.M{"$gt": at},
+		"revoked_at":  bson.M{"$exists": false},
+	})
+}
+
+// GetApprovalDelegationsByUser returns the delegations a user has made or
+// been given, latest first.
+func GetApprovalDelegationsByUser(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]*models.ApprovalDelegation, error) {
+	return findApprovalDelegations(ctx, db, bson.M{
+		"$or": bson.A{bson.M{"delegator_id": userID}, bson.M{"delegate_id": userID}},
+	})
+}
+
+func findApprovalDelegations(ctx context.Context, db *mongo.Database, filter bson.M) ([]*models.ApprovalDelegation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.Collection("approval_delegations").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	delegations := []*models.ApprovalDelegation{}
+	if err := cursor.All(ctx, &delegations); err != nil {
+		return nil, err
+	}
+	return delegations, nil
+}
+
+// RevokeApprovalDelegation ends a delegation its delegator made early.
+func RevokeApprovalDelegation(ctx context.Context, db *mongo.Database, delegationID, delegatorID primitive.ObjectID, at time.Time) error {
+	filter := bson.M{
+		"_id":          delegationID,
+		"delegator_id": delegatorID,
+		"revoked_at":   bson.M{"$exists": false},
+	}
+	result, err := db.Collection("approval_delegations").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("delegation not found or already revoked")
+	}
+	return nil
+}
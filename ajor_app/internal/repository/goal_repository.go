@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrGoalClosed is returned when a goal has already been withdrawn.
+var ErrGoalClosed = errors.New("savings goal is already closed")
+
+func CreateGoal(ctx context.Context, db *mongo.Database, goal *models.SavingsGoal) error {
+	goal.Status = models.GoalActive
+	goal.CreatedAt = time.Now()
+	goal.UpdatedAt = goal.CreatedAt
+	result, err := db.Collection("savings_goals").InsertOne(ctx, goal)
+	if err != nil {
+		return err
+	}
+	goal.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func GetGoalByID(ctx context.Context, db *mongo.Database, goalID primitive.ObjectID) (*models.SavingsGoal, error) {
+	var goal models.SavingsGoal
+	err := db.Collection("savings_goals").FindOne(ctx, bson.M{"_id": goalID}).Decode(&goal)
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+func GetGoalsByUser(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]*models.SavingsGoal, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.Collection("savings_goals").Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var goals []*models.SavingsGoal
+	if err := cursor.All(ctx, &goals); err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+// GetGoalsDueForAutoDebit returns active goals whose next auto-debit is due.
+func GetGoalsDueForAutoDebit(ctx context.Context, db *mongo.Database, now time.Time) ([]*models.SavingsGoal, error) {
+	cursor, err := db.Collection("savings_goals").Find(ctx, bson.M{
+		"status":                   models.GoalActive,
+		"auto_debit_amount.amount": bson.M{"$gt": 0},
+		"next_debit_at":            bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var goals []*models.SavingsGoal
+	if err := cursor.All(ctx, &goals); err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+// ClaimGoalAutoDebit moves a goal's next auto-debit from due to next. It
+// reports false if another run claimed the debit first.
+func ClaimGoalAutoDebit(ctx context.Context, db *mongo.Database, goalID primitive.ObjectID, due, next time.Time) (bool, error) {
+	filter := bson.M{"_id": goalID, "status": models.GoalActive, "next_debit_at": due}
+	update := bson.M{"$set": bson.M{"next_debit_at": next, "updated_at": time.Now()}}
+	result, err := db.Collection("savings_goals").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// LockActiveGoal writes to an active goal inside a session transaction, so a
+// transfer into the goal conflicts with a concurrent CloseGoal and is retried
+// after it. It returns ErrGoalClosed if the goal is no longer active.
+func LockActiveGoal(ctx context.Context, db *mongo.Database, goalID primitive.ObjectID) error {
+	filter := bson.M{"_id": goalID, "status": models.GoalActive}
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	result, err := db.Collection("savings_goals").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGoalClosed
+	}
+	return nil
+}
+
+// CloseGoal ends an active goal with the given status.
+func CloseGoal(ctx context.Context, db *mongo.Database, goalID primitive.ObjectID, status models.GoalStatus) error {
+	now := time.Now()
+	filter := bson.M{"_id": goalID, "status": models.GoalActive}
+	update := bson.M{"$set": bson.M{"status": status, "closed_at": now, "updated_at": now}}
+	result, err := db.Collection("savings_goals").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGoalClosed
+	}
+	return nil
+}
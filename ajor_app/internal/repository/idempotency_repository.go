@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIdempotencyIndexes makes keys unique per user and lets MongoDB drop
+// records once they expire.
+func EnsureIdempotencyIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("idempotency_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// ReserveIdempotencyKey stores record as in flight. If the user already has a
+// live record for the key, that record is returned and nothing is stored.
+// Expired records the TTL monitor hasn't removed yet are replaced.
+func ReserveIdempotencyKey(ctx context.Context, db *mongo.Database, record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	collection := db.Collection("idempotency_keys")
+	record.Status = models.IdempotencyProcessing
+	record.CreatedAt = time.Now()
+	for attempt := 0; attempt < 2; attempt++ {
+		record.ID = primitive.NewObjectID()
+		_, err := collection.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing models.IdempotencyRecord
+		err = collection.FindOne(ctx, bson.M{"user_id": record.UserID, "key": record.Key}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, nil
+		}
+		if _, err := collection.DeleteOne(ctx, bson.M{"_id": existing.ID, "expires_at": existing.ExpiresAt}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("idempotency key is busy")
+}
+
+// CompleteIdempotencyKey caches the response of a finished request until the
+// record expires.
+func CompleteIdempotencyKey(ctx context.Context, db *mongo.Database, recordID primitive.ObjectID, status int, body []byte, expiresAt time.Time) error {
+	_, err := db.Collection("idempotency_keys").UpdateOne(ctx, bson.M{"_id": recordID}, bson.M{
+		"$set": bson.M{
+			"status":          models.IdempotencyCompleted,
+			"response_status": status,
+			"response_body":   body,
+			"expires_at":      expiresAt,
+		},
+	})
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a reservation so the request can be retried,
+// e.g. after it failed with a server error.
+func ReleaseIdempotencyKey(ctx context.Context, db *mongo.Database, recordID primitive.ObjectID) error {
+	_, err := db.Collection("idempotency_keys").DeleteOne(ctx, bson.M{"_id": recordID, "status": models.IdempotencyProcessing})
+	return err
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func validateJournalEntry(entry *models.JournalEntry) error {
+	if len(entry.Legs) < 2 {
+		return errors.New("journal entry needs at least two legs")
+	}
+	var debits, credits money.Money
+	wallets := make(map[primitive.ObjectID]bool)
+	for _, leg := range entry.Legs {
+		if leg.Debit.IsNegative() || leg.Credit.IsNegative() {
+			return errors.New("journal leg amounts cannot be negative")
+		}
+		if !leg.Debit.SameCurrency(leg.Credit) || !leg.Debit.SameCurrency(entry.Legs[0].Debit) {
+			return errors.New("journal entry mixes currencies")
+		}
+		if leg.Account == models.AccountWallet {
+			if leg.WalletID.IsZero() {
+				return errors.New("wallet leg is missing wallet id")
+			}
+			if wallets[leg.WalletID] {
+				return errors.New("journal entry has more than one leg for a wallet")
+			}
+			wallets[leg.WalletID] = true
+		}
+		debits = debits.Add(leg.Debit)
+		credits = credits.Add(leg.Credit)
+	}
+	if !debits.IsPositive() {
+		return errors.New("journal entry must move a positive amount")
+	}
+	if debits.Kobo != credits.Kobo {
+		return errors.New("journal entry is not balanced")
+	}
+	return nil
+}
+
+// CreateJournalEntry records a balanced entry as pending. The wallets it
+// touches are only moved by ApplyJournalEntry.
+func CreateJournalEntry(ctx context.Context, db *mongo.Database, entry *models.JournalEntry) error {
+	if err := validateJournalEntry(entry); err != nil {
+		return err
+	}
+	entry.Status = models.JournalPending
+	entry.CreatedAt = time.Now()
+	result, err := db.Collection("journal_entries").InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ApplyJournalEntry moves the balances of every wallet leg and marks the entry
+// posted. Each wallet remembers the entry while it is in flight, so applying the
+// same entry twice (e.g. when recovering after a crash) never moves money twice.
+func ApplyJournalEntry(ctx context.Context, db *mongo.Database, entry *models.JournalEntry) error {
+	// Debits go first so an entry that would overdraw a wallet fails before
+	// anything has been credited.
+	for _, leg := range entry.Legs {
+		if leg.Account != models.AccountWallet || !leg.Debit.IsPositive() {
+			continue
+		}
+		if err := DebitWallet(ctx, db, leg.WalletID, leg.Debit, entry.ID); err != nil {
+			return err
+		}
+	}
+	for _, leg := range entry.Legs {
+		if leg.Account != models.AccountWallet || !leg.Credit.IsPositive() {
+			continue
+		}
+		if err := CreditWallet(ctx, db, leg.WalletID, leg.Credit, entry.ID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err := db.Collection("journal_entries").UpdateOne(ctx, bson.M{"_id": entry.ID}, bson.M{
+		"$set": bson.M{"status": models.JournalPosted, "posted_at": now},
+	})
+	if err != nil {
+		return err
+	}
+	entry.Status = models.JournalPosted
+	entry.PostedAt = now
+
+	_, err = db.Collection("wallets").UpdateMany(ctx, bson.M{"pending_entries": entry.ID}, bson.M{
+		"$pull": bson.M{"pending_entries": entry.ID},
+	})
+	return err
+}
+
+// PostJournalEntry records and applies a balanced entry in one call.
+func PostJournalEntry(ctx context.Context, db *mongo.Database, entry *models.JournalEntry) error {
+	if err := CreateJournalEntry(ctx, db, entry); err != nil {
+		return err
+	}
+	return ApplyJournalEntry(ctx, db, entry)
+}
+
+func GetJournalEntriesByTransaction(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID) ([]*models.JournalEntry, error) {
+	cursor, err := db.Collection("journal_entries").Find(ctx, bson.M{"transaction_id": transactionID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var entries []*models.JournalEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetStalePendingJournalEntries returns entries that were recorded but never
+// finished applying, ignoring anything newer than the given age since it may
+// still be in flight.
+func GetStalePendingJournalEntries(ctx context.Context, db *mongo.Database, olderThan time.Duration) ([]*models.JournalEntry, error) {
+	cursor, err := db.Collection("journal_entries").Find(ctx, bson.M{
+		"status":     models.JournalPending,
+		"created_at": bson.M{"$lt": time.Now().Add(-olderThan)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var entries []*models.JournalEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetWalletLedgerBalance sums the posted legs of a wallet, plus any pending
+// entries the wallet has already applied.
+func GetWalletLedgerBalance(ctx context.Context, db *mongo.Database, wallet *models.Wallet) (money.Money, error) {
+	match := bson.M{"legs.wallet_id": wallet.ID, "status": models.JournalPosted}
+	if len(wallet.PendingEntries) > 0 {
+		match = bson.M{
+			"legs.wallet_id": wallet.ID,
+			"$or": []bson.M{
+				{"status": models.JournalPosted},
+				{"_id": bson.M{"$in": wallet.PendingEntries}},
+			},
+		}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$legs"}},
+		{{Key: "$match", Value: bson.M{"legs.wallet_id": wallet.ID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"balance": bson.M{"$sum": bson.M{"$subtract": bson.A{"$legs.credit.amount", "$legs.debit.amount"}}},
+		}}},
+	}
+	cursor, err := db.Collection("journal_entries").Aggregate(ctx, pipeline)
+	if err != nil {
+		return money.Money{}, err
+	}
+	defer cursor.Close(ctx)
+	var result []struct {
+		Balance int64 `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return money.Money{}, err
+	}
+	if len(result) == 0 {
+		return money.New(0, wallet.Balance.Currency), nil
+	}
+	return money.New(result[0].Balance, wallet.Balance.Currency), nil
+}
+
+// CreatePostedJournalEntry records an entry that describes money the wallets
+// already hold, such as the opening balance of a wallet that predates the
+// ledger. It does not move any balances.
+func CreatePostedJournalEntry(ctx context.Context, db *mongo.Database, entry *models.JournalEntry) error {
+	if err := validateJournalEntry(entry); err != nil {
+		return err
+	}
+	entry.Status = models.JournalPosted
+	entry.CreatedAt = time.Now()
+	entry.PostedAt = entry.CreatedAt
+	result, err := db.Collection("journal_entries").InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func CountWalletJournalEntries(ctx context.Context, db *mongo.Database, walletID primitive.ObjectID) (int64, error) {
+	return db.Collection("journal_entries").CountDocuments(ctx, bson.M{"legs.wallet_id": walletID})
+}
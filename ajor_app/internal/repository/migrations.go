@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"log"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// moneyFields lists every field that used to hold a float naira amount and now
+// holds a money document.
+var moneyFields = map[string][]string{
+	"wallets":       {"balance"},
+	"contributions": {"amount", "penalty_amount"},
+	"transactions":  {"amount"},
+}
+
+// koboExpr converts a legacy naira number into a money document.
+func koboExpr(field string) bson.M {
+	return bson.M{
+		"amount":   bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{field, 100}}, 0}}},
+		"currency": money.NGN,
+	}
+}
+
+// MigrateMoneyFields rewrites amounts stored as naira floats into
+// {amount: <kobo>, currency: "NGN"} documents. Documents already migrated are
+// skipped, so it is safe to run on every start.
+func MigrateMoneyFields(ctx context.Context, db *mongo.Database) error {
+	for collection, fields := range moneyFields {
+		for _, field := range fields {
+			result, err := db.Collection(collection).UpdateMany(ctx,
+				bson.M{field: bson.M{"$type": "number"}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{field: koboExpr("$" + field)}}}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.ModifiedCount > 0 {
+				log.Printf("Migrated %d %s.%s amounts to kobo", result.ModifiedCount, collection, field)
+			}
+		}
+	}
+
+	result, err := db.Collection("journal_entries").UpdateMany(ctx,
+		bson.M{"legs.debit": bson.M{"$type": "number"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"legs": bson.M{"$map": bson.M{
+			"input": "$legs",
+			"as":    "leg",
+			"in": bson.M{"$mergeObjects": bson.A{"$$leg", bson.M{
+				"debit":  koboExpr("$$leg.debit"),
+				"credit": koboExpr("$$leg.credit"),
+			}}},
+		}}}}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated %d journal entries to kobo", result.ModifiedCount)
+	}
+	return nil
+}
+
+// SeedOpeningBalances gives every wallet that predates the ledger an opening
+// balance entry for what it already holds. It must run before the wallets
+// take any postings, as a wallet with entries is taken to be in the ledger
+// already; wallets with entries are skipped, so it is safe to run on every
+// start.
+func SeedOpeningBalances(ctx context.Context, db *mongo.Database) error {
+	wallets, err := GetAllWallets(ctx, db)
+	if err != nil {
+		return err
+	}
+	seeded := 0
+	for _, wallet := range wallets {
+		if !wallet.Balance.IsPositive() {
+			continue
+		}
+		count, err := CountWalletJournalEntries(ctx, db, wallet.ID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		entry := &models.JournalEntry{
+			Description: "Opening balance",
+			Legs: []models.LedgerLeg{
+				{Account: models.AccountOpeningBalance, Debit: wallet.Balance},
+				{Account: models.AccountWallet, WalletID: wallet.ID, Credit: wallet.Balance},
+			},
+		}
+		if err := CreatePostedJournalEntry(ctx, db, entry); err != nil {
+			return err
+		}
+		seeded++
+	}
+	if seeded > 0 {
+		log.Printf("Seeded opening balances for %d wallets", seeded)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPenaltyExists is returned when the member was already penalised for the
+// cycle.
+var ErrPenaltyExists = errors.New("penalty already charged for this cycle")
+
+// EnsurePenaltyIndexes allows at most one penalty per member per cycle.
+func EnsurePenaltyIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("penalties").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "contribution_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "cycle", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func CreatePenalty(ctx context.Context, db *mongo.Database, penalty *models.Penalty) error {
+	penalty.Status = models.PenaltyOutstanding
+	penalty.CreatedAt = time.Now()
+	result, err := db.Collection("penalties").InsertOne(ctx, penalty)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPenaltyExists
+	}
+	if err != nil {
+		return err
+	}
+	penalty.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// MarkPenaltyPaid settles an outstanding penalty with the transaction that
+// paid it.
+func MarkPenaltyPaid(ctx context.Context, db *mongo.Database, penaltyID, transactionID primitive.ObjectID) error {
+	filter := bson.M{"_id": penaltyID, "status": models.PenaltyOutstanding}
+	update := bson.M{
+		"$set": bson.M{
+			"status":         models.PenaltyPaid,
+			"transaction_id": transactionID,
+			"paid_at":        time.Now(),
+		},
+	}
+	result, err := db.Collection("penalties").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("penalty not found or already paid")
+	}
+	return nil
+}
+
+// GetOutstandingPenalties returns a group's unpaid penalties, oldest first. A
+// zero userID returns them for every member.
+func GetOutstandingPenalties(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) ([]*models.Penalty, error) {
+	filter := bson.M{"contribution_id": contributionID, "status": models.PenaltyOutstanding}
+	if !userID.IsZero() {
+		filter["user_id"] = userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := db.Collection("penalties").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var penalties []*models.Penalty
+	if err := cursor.All(ctx, &penalties); err != nil {
+		return nil, err
+	}
+	return penalties, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureReconciliationReportIndexes keeps one report per period.
+func EnsureReconciliationReportIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("reconciliation_reports").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SaveReconciliationReport stores a report, replacing any earlier one for the
+// same period, and sets its ID.
+func SaveReconciliationReport(ctx context.Context, db *mongo.Database, report *models.ReconciliationReport) error {
+	report.ID = primitive.NilObjectID
+	filter := bson.M{"from": report.From, "to": report.To}
+	opts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.After)
+	var saved models.ReconciliationReport
+	if err := db.Collection("reconciliation_reports").FindOneAndReplace(ctx, filter, report, opts).Decode(&saved); err != nil {
+		return err
+	}
+	report.ID = saved.ID
+	return nil
+}
+
+func GetReconciliationReportByID(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.ReconciliationReport, error) {
+	var report models.ReconciliationReport
+	if err := db.Collection("reconciliation_reports").FindOne(ctx, bson.M{"_id": id}).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListReconciliationReports returns the latest reports, newest period first.
+func ListReconciliationReports(ctx context.Context, db *mongo.Database, limit int64) ([]*models.ReconciliationReport, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "from", Value: -1}}).SetLimit(limit)
+	cursor, err := db.Collection("reconciliation_reports").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	reports := []*models.ReconciliationReport{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureStandingOrderIndexes allows one standing order per membership.
+func EnsureStandingOrderIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("standing_orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "contribution_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SaveStandingOrder creates or replaces the standing order of a membership
+// and returns the stored order.
+func SaveStandingOrder(ctx context.Context, db *mongo.Database, order *models.StandingOrder) (*models.StandingOrder, error) {
+	now := time.Now()
+	filter := bson.M{"contribution_id": order.ContributionID, "user_id": order.UserID}
+	update := bson.M{
+		"$set": bson.M{
+			"active":          order.Active,
+			"max_retries":     order.MaxRetries,
+			"attempts":        0,
+			"next_attempt_at": order.NextAttemptAt,
+			"last_error":      "",
+			"updated_at":      now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var stored models.StandingOrder
+	if err := db.Collection("standing_orders").FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func GetStandingOrder(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) (*models.StandingOrder, error) {
+	var order models.StandingOrder
+	err := db.Collection("standing_orders").FindOne(ctx, bson.M{"contribution_id": contributionID, "user_id": userID}).Decode(&order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetDueStandingOrders returns active standing orders whose next attempt is
+// due.
+func GetDueStandingOrders(ctx context.Context, db *mongo.Database, now time.Time) ([]*models.StandingOrder, error) {
+	cursor, err := db.Collection("standing_orders").Find(ctx, bson.M{
+		"active":          true,
+		"next_attempt_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.StandingOrder
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ClaimStandingOrder pushes a due order's next attempt back to leaseUntil so
+// only one run debits it. It reports false if another run claimed it first.
+func ClaimStandingOrder(ctx context.Context, db *mongo.Database, orderID primitive.ObjectID, due, leaseUntil time.Time) (bool, error) {
+	filter := bson.M{"_id": orderID, "active": true, "next_attempt_at": due}
+	update := bson.M{"$set": bson.M{"next_attempt_at": leaseUntil, "updated_at": time.Now()}}
+	result, err := db.Collection("standing_orders").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// ScheduleStandingOrder records the outcome of an attempt and when to try
+// next.
+func ScheduleStandingOrder(ctx context.Context, db *mongo.Database, orderID primitive.ObjectID, attempts int, next time.Time, lastError string) error {
+	update := bson.M{"$set": bson.M{
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"last_error":      lastError,
+		"updated_at":      time.Now(),
+	}}
+	_, err := db.Collection("standing_orders").UpdateOne(ctx, bson.M{"_id": orderID}, update)
+	return err
+}
+
+// DeactivateStandingOrder stops a membership's standing order, if it has one.
+func DeactivateStandingOrder(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) error {
+	filter := bson.M{"contribution_id": contributionID, "user_id": userID}
+	update := bson.M{"$set": bson.M{"active": false, "updated_at": time.Now()}}
+	_, err := db.Collection("standing_orders").UpdateOne(ctx, filter, update)
+	return err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
@@ -11,6 +12,19 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// EnsureTransactionIndexes credits each inbound transfer to a virtual account
+// once: those transactions carry the gateway's ID for the payment.
+func EnsureTransactionIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "gateway_reference", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			"type":              models.TransactionWallet,
+			"gateway_reference": bson.M{"$exists": true},
+		}),
+	})
+	return err
+}
+
 func CreateTransaction(ctx context.Context, db *mongo.Database, transaction *models.Transaction) error {
 	collection := db.Collection("transactions")
 	transaction.CreatedAt = time.Now()
@@ -40,6 +54,123 @@ func UpdateTransactionStatus(ctx context.Context, db *mongo.Database, transactio
 	return nil
 }
 
+// ErrTransactionNotPending is returned when settling a transaction that has
+// already succeeded or failed.
+var ErrTransactionNotPending = errors.New("transaction is no longer pending")
+
+// SettlePendingTransaction moves a pending transaction to its final status.
+// Only the first call succeeds, so a repeated gateway notification can't
+// settle the same transaction twice.
+func SettlePendingTransaction(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID, status models.TransactionStatus) error {
+	filter := bson.M{"_id": transactionID, "status": models.StatusPending}
+	update := bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}
+	result, err := db.Collection("transactions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTransactionNotPending
+	}
+	return nil
+}
+
+// FailPendingTransaction fails a pending transaction, recording why. It
+// returns ErrTransactionNotPending if the transaction has been settled.
+func FailPendingTransaction(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID, reason string) error {
+	filter := bson.M{"_id": transactionID, "status": models.StatusPending}
+	update := bson.M{"$set": bson.M{"status": models.StatusFailed, "failure_reason": reason, "updated_at": time.Now()}}
+	result, err := db.Collection("transactions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTransactionNotPending
+	}
+	return nil
+}
+
+// LockPendingTransaction writes to a pending transaction inside a session
+// transaction, so that concurrent session transactions acting on it conflict
+// and are retried one after the other. It returns ErrTransactionNotPending if
+// the transaction has been settled.
+func LockPendingTransaction(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID) error {
+	filter := bson.M{"_id": transactionID, "status": models.StatusPending}
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	result, err := db.Collection("transactions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTransactionNotPending
+	}
+	return nil
+}
+
+// MarkTransactionDiscrepancy flags a funding transaction that hasn't been
+// credited because the gateway's charge didn't match it. It returns
+// ErrTransactionNotPending if the transaction was credited in the meantime.
+func MarkTransactionDiscrepancy(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID, reason string) error {
+	filter := bson.M{"_id": transactionID, "status": bson.M{"$in": bson.A{models.StatusPending, models.StatusFailed}}}
+	update := bson.M{"$set": bson.M{"status": models.StatusDiscrepancy, "discrepancy": reason}}
+	result, err := db.Collection("transactions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTransactionNotPending
+	}
+	return nil
+}
+
+// UpdateTransactionGateway records the gateway's reference for a transaction
+// and the status it last reported.
+func UpdateTransactionGateway(ctx context.Context, db *mongo.Database, transactionID primitive.ObjectID, reference, status, message string) error {
+	_, err := db.Collection("transactions").UpdateOne(ctx, bson.M{"_id": transactionID}, bson.M{
+		"$set": bson.M{
+			"gateway_reference": reference,
+			"gateway_status":    status,
+			"gateway_message":   message,
+			"updated_at":        time.Now(),
+		},
+	})
+	return err
+}
+
+// HasPendingPayout reports whether a contribution has a payout to a wallet
+// still waiting for approval.
+func HasPendingPayout(ctx context.Context, db *mongo.Database, contributionID, walletID primitive.ObjectID) (bool, error) {
+	count, err := db.Collection("transactions").CountDocuments(ctx, bson.M{
+		"type":            models.TransactionPayout,
+		"status":          models.StatusPending,
+		"contribution_id": contributionID,
+		"to_wallet":       walletID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetPendingWithdrawals returns withdrawals created before the given time
+// that haven't been settled, whether or not the gateway has given their
+// transfer an ID.
+func GetPendingWithdrawals(ctx context.Context, db *mongo.Database, before time.Time) ([]*models.Transaction, error) {
+	cursor, err := db.Collection("transactions").Find(ctx, bson.M{
+		"type":       models.TransactionWithdrawal,
+		"status":     models.StatusPending,
+		"created_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
 func GetUserTransactions(ctx context.Context, db *mongo.Database, userID, contributionID primitive.ObjectID) ([]*models.Transaction, error) {
 	var wallet models.Wallet
 	err := db.Collection("wallets").FindOne(ctx, bson.M{"owner_id": userID, "type": models.WalletTypeUser}).Decode(&wallet)
@@ -97,4 +228,107 @@ func GetTransactionByTxRef(ctx context.Context, db *mongo.Database, txRef string
 		return nil, err
 	}
 	return &transaction, nil
-}
\ No newline at end of file
+}
+func GetTransactionByID(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := db.Collection("transactions").FindOne(ctx, bson.M{"_id": id}).Decode(&transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// GetPendingFundings returns the funding transactions created before the
+// given time that are still waiting for their payment.
+func GetPendingFundings(ctx context.Context, db *mongo.Database, before time.Time) ([]*models.Transaction, error) {
+	cursor, err := db.Collection("transactions").Find(ctx, bson.M{
+		"type":        models.TransactionWallet,
+		"from_wallet": primitive.NilObjectID,
+		"status":      models.StatusPending,
+		"created_at":  bson.M{"$lt": before},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// GetTransactionByGatewayReference finds the wallet transaction a gateway
+// charge was credited as.
+func GetTransactionByGatewayReference(ctx context.Context, db *mongo.Database, reference string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	filter := bson.M{"type": models.TransactionWallet, "gateway_reference": reference}
+	if err := db.Collection("transactions").FindOne(ctx, filter).Decode(&transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// GetFundingTransactions returns the successful transactions that brought
+// money into wallets from the gateway from from up to to.
+func GetFundingTransactions(ctx context.Context, db *mongo.Database, from, to time.Time) ([]*models.Transaction, error) {
+	cursor, err := db.Collection("transactions").Find(ctx, bson.M{
+		"type":        models.TransactionWallet,
+		"from_wallet": primitive.NilObjectID,
+		"status":      models.StatusSuccess,
+		"date":        bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// GetContributionPayerWallets returns the wallets that paid their contribution
+// for a cycle. Payments made before cycles were recorded count towards the
+// cycle that was open when they were made, i.e. any made after since.
+func GetContributionPayerWallets(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, cycle int, since time.Time) ([]primitive.ObjectID, error) {
+	values, err := db.Collection("transactions").Distinct(ctx, "from_wallet", bson.M{
+		"contribution_id": contributionID,
+		"type":            models.TransactionContribution,
+		"status":          models.StatusSuccess,
+		"$or": []bson.M{
+			{"cycle": cycle},
+			{"cycle": bson.M{"$exists": false}, "date": bson.M{"$gt": since}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			wallets = append(wallets, id)
+		}
+	}
+	return wallets, nil
+}
+
+// GetContributionCycleTransactions returns a contribution's successful
+// transactions of one type for a cycle.
+func GetContributionCycleTransactions(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, transactionType models.TransactionType, cycle int) ([]*models.Transaction, error) {
+	cursor, err := db.Collection("transactions").Find(ctx, bson.M{
+		"contribution_id": contributionID,
+		"type":            transactionType,
+		"status":          models.StatusSuccess,
+		"cycle":           cycle,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var transactions []*models.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -39,6 +39,25 @@ func GetAllUsers(db *mongo.Collection) ([]*models.User, error) {
 	return users, nil
 }
 
+// GetAdminUserIDs returns the IDs of all system admins.
+func GetAdminUserIDs(ctx context.Context, db *mongo.Database) ([]primitive.ObjectID, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := db.Collection("users").Find(ctx, bson.M{"is_admin": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var ids []primitive.ObjectID
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids, cursor.Err()
+}
+
 func CreateUser(db *mongo.Collection, user *models.User) error {
 	_, err := db.InsertOne(context.TODO(), user)
 	return err
@@ -99,7 +118,7 @@ func UpdateUser(db *mongo.Database, id primitive.ObjectID, userUpdate *UserUpdat
 	).Decode(&updatedUser)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -107,12 +126,15 @@ func UpdateUser(db *mongo.Database, id primitive.ObjectID, userUpdate *UserUpdat
 	return &updatedUser, nil
 }
 
+// ErrUserNotFound is returned when a user doesn't exist.
+var ErrUserNotFound = errors.New("user not found")
+
 func GetUserByID(db *mongo.Collection, id primitive.ObjectID) (*models.User, error) {
 	var user models.User
 	err := db.FindOne(context.Background(), bson.M{"_id": id}).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
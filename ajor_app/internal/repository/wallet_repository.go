@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,9 +31,11 @@ func CreateWallet(db *mongo.Database, wallet *models.Wallet) error {
 	return nil
 }
 
+// GetWalletByUserID returns a user's personal wallet, not the contribution or
+// goal wallets they also own.
 func GetWalletByUserID(db *mongo.Database, owner_id primitive.ObjectID) (*models.Wallet, error) {
 	var wallet models.Wallet
-	err := db.Collection("wallets").FindOne(context.TODO(), bson.M{"owner_id": owner_id}).Decode(&wallet)
+	err := db.Collection("wallets").FindOne(context.TODO(), bson.M{"owner_id": owner_id, "type": models.WalletTypeUser}).Decode(&wallet)
 	if err != nil {
 		return nil, err
 	}
@@ -48,6 +51,30 @@ func GetWalletByID(db *mongo.Database, wallet_id primitive.ObjectID) (*models.Wa
 	return &wallet, nil
 }
 
+// GetWalletByVirtualAccount finds the wallet that owns a virtual account,
+// by account number or by any of the IDs it may be stored under.
+func GetWalletByVirtualAccount(ctx context.Context, db *mongo.Database, accountNumber string, accountIDs []string) (*models.Wallet, error) {
+	var or bson.A
+	if accountNumber != "" {
+		or = append(or, bson.M{"virtual_account_number": accountNumber})
+	}
+	if len(accountIDs) > 0 {
+		or = append(or, bson.M{"virtual_account_id": bson.M{"$in": accountIDs}})
+	}
+	if len(or) == 0 {
+		return nil, errors.New("wallet not found")
+	}
+	var wallet models.Wallet
+	err := db.Collection("wallets").FindOne(ctx, bson.M{"$or": or}).Decode(&wallet)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("wallet not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
 func GetContributionWalletByID(ctx context.Context, db *mongo.Database, walletID primitive.ObjectID) (*models.Wallet, error) {
 	var wallet models.Wallet
 	collection := db.Collection("wallets")
@@ -75,28 +102,76 @@ func GetWalletByContributionID(db *mongo.Database, contributionID primitive.Obje
 	return &wallet, nil
 }
 
-func UpdateWalletBalance(db *mongo.Database, walletID primitive.ObjectID, amount float64, isCredit bool) error {
-	filter := bson.M{"_id": walletID}
-	var update bson.M
-	if isCredit {
-		update = bson.M{
-			"$inc": bson.M{"balance": amount},
-			"$set": bson.M{"updated_at": time.Now()},
-		}
-	} else {
-		update = bson.M{
-			"$inc": bson.M{"balance": -amount},
-			"$set": bson.M{"updated_at": time.Now()},
-		}
+// GetUserWalletsByOwners returns the personal wallets of the given users.
+func GetUserWalletsByOwners(ctx context.Context, db *mongo.Database, ownerIDs []primitive.ObjectID) ([]*models.Wallet, error) {
+	cursor, err := db.Collection("wallets").Find(ctx, bson.M{
+		"owner_id": bson.M{"$in": ownerIDs},
+		"type":     models.WalletTypeUser,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var wallets []*models.Wallet
+	if err := cursor.All(ctx, &wallets); err != nil {
+		return nil, err
 	}
-	result, err := db.Collection("wallets").UpdateOne(context.TODO(), filter, update)
+	return wallets, nil
+}
+
+// ErrInsufficientFunds is returned when a debit would take a wallet below zero.
+var ErrInsufficientFunds = errors.New("insufficient balance")
+
+// DebitWallet takes amount out of a wallet for a journal entry. The balance
+// check is part of the update filter, so concurrent debits can never drive a
+// wallet negative. A debit already applied for the same entry is a no-op.
+func DebitWallet(ctx context.Context, db *mongo.Database, walletID primitive.ObjectID, amount money.Money, entryID primitive.ObjectID) error {
+	filter := bson.M{
+		"_id":             walletID,
+		"pending_entries": bson.M{"$ne": entryID},
+		"balance.amount":  bson.M{"$gte": amount.Kobo},
+	}
+	return applyWalletDelta(ctx, db, filter, walletID, -amount.Kobo, entryID)
+}
+
+// CreditWallet adds amount to a wallet for a journal entry. A credit already
+// applied for the same entry is a no-op.
+func CreditWallet(ctx context.Context, db *mongo.Database, walletID primitive.ObjectID, amount money.Money, entryID primitive.ObjectID) error {
+	filter := bson.M{
+		"_id":             walletID,
+		"pending_entries": bson.M{"$ne": entryID},
+	}
+	return applyWalletDelta(ctx, db, filter, walletID, amount.Kobo, entryID)
+}
+
+func applyWalletDelta(ctx context.Context, db *mongo.Database, filter bson.M, walletID primitive.ObjectID, delta int64, entryID primitive.ObjectID) error {
+	wallets := db.Collection("wallets")
+	result, err := wallets.UpdateOne(ctx, filter, bson.M{
+		"$inc":      bson.M{"balance.amount": delta},
+		"$addToSet": bson.M{"pending_entries": entryID},
+		"$set":      bson.M{"updated_at": time.Now()},
+	})
 	if err != nil {
 		return err
 	}
-	if result.MatchedCount == 0 {
-		return errors.New("wallet not found")
+	if result.MatchedCount > 0 {
+		return nil
 	}
-	return nil
+
+	// Work out why nothing matched
+	var wallet models.Wallet
+	if err := wallets.FindOne(ctx, bson.M{"_id": walletID}).Decode(&wallet); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("wallet not found")
+		}
+		return err
+	}
+	for _, id := range wallet.PendingEntries {
+		if id == entryID {
+			return nil
+		}
+	}
+	return ErrInsufficientFunds
 }
 
 func UpdateWalletVirtualAccount(db *mongo.Database, walletID primitive.ObjectID, virtualAccountNumber, accountID, accountBank string) error {
@@ -133,4 +208,17 @@ func DeleteWallet(db *mongo.Database, walletID primitive.ObjectID) error {
 		return errors.New("wallet not found")
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func GetAllWallets(ctx context.Context, db *mongo.Database) ([]*models.Wallet, error) {
+	cursor, err := db.Collection("wallets").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var wallets []*models.Wallet
+	if err := cursor.All(ctx, &wallets); err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
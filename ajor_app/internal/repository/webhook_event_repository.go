@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrDuplicateWebhookEvent = errors.New("webhook event already received")
+
+// EnsureWebhookEventIndexes stores each provider event once and lets the
+// worker find due events.
+func EnsureWebhookEventIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("webhook_events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+	})
+	return err
+}
+
+// CreateWebhookEvent stores a newly received event. It returns
+// ErrDuplicateWebhookEvent if the provider already sent it.
+func CreateWebhookEvent(ctx context.Context, db *mongo.Database, event *models.WebhookEvent) error {
+	// MongoDB keeps milliseconds, and the event must match what is stored
+	// for ClaimWebhookEvent
+	now := time.Now().Truncate(time.Millisecond)
+	event.ID = primitive.NewObjectID()
+	event.Status = models.WebhookPending
+	event.ReceivedAt = now
+	event.NextAttemptAt = now
+	event.UpdatedAt = now
+	_, err := db.Collection("webhook_events").InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateWebhookEvent
+	}
+	return err
+}
+
+func GetWebhookEventByID(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	if err := db.Collection("webhook_events").FindOne(ctx, bson.M{"_id": id}).Decode(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListWebhookEvents returns the latest events, optionally only those with a
+// status or from a provider.
+func ListWebhookEvents(ctx context.Context, db *mongo.Database, status models.WebhookEventStatus, provider string, limit int64) ([]*models.WebhookEvent, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if provider != "" {
+		filter["provider"] = provider
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "received_at", Value: -1}}).SetLimit(limit)
+	cursor, err := db.Collection("webhook_events").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	events := []*models.WebhookEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetDueWebhookEvents returns pending events whose next attempt is due.
+func GetDueWebhookEvents(ctx context.Context, db *mongo.Database, now time.Time) ([]*models.WebhookEvent, error) {
+	cursor, err := db.Collection("webhook_events").Find(ctx, bson.M{
+		"status":          models.WebhookPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}, options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var events []*models.WebhookEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ClaimWebhookEvent pushes a due event's next attempt back to leaseUntil so
+// only one worker processes it. It reports false if another worker claimed it
+// first.
+func ClaimWebhookEvent(ctx context.Context, db *mongo.Database, id primitive.ObjectID, due, leaseUntil time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "status": models.WebhookPending, "next_attempt_at": due}
+	update := bson.M{"$set": bson.M{"next_attempt_at": leaseUntil, "updated_at": time.Now()}}
+	result, err := db.Collection("webhook_events").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// CompleteWebhookEvent marks an event processed.
+func CompleteWebhookEvent(ctx context.Context, db *mongo.Database, id primitive.ObjectID, attempts int, result string) error {
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"status":       models.WebhookProcessed,
+		"result":       result,
+		"attempts":     attempts,
+		"last_error":   "",
+		"processed_at": now,
+		"updated_at":   now,
+	}}
+	_, err := db.Collection("webhook_events").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// ScheduleWebhookRetry records a failed attempt and when to try next, or
+// gives up on the event if status is WebhookFailed.
+func ScheduleWebhookRetry(ctx context.Context, db *mongo.Database, id primitive.ObjectID, status models.WebhookEventStatus, attempts int, next time.Time, lastError string) error {
+	update := bson.M{"$set": bson.M{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"last_error":      lastError,
+		"updated_at":      time.Now(),
+	}}
+	_, err := db.Collection("webhook_events").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// RequeueWebhookEvent puts a failed event back in the queue with fresh
+// retries. It returns mongo.ErrNoDocuments if the event isn't failed.
+func RequeueWebhookEvent(ctx context.Context, db *mongo.Database, id primitive.ObjectID, now time.Time) (*models.WebhookEvent, error) {
+	filter := bson.M{"_id": id, "status": models.WebhookFailed}
+	update := bson.M{"$set": bson.M{
+		"status":          models.WebhookPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var event models.WebhookEvent
+	if err := db.Collection("webhook_events").FindOneAndUpdate(ctx, filter, update, opts).Decode(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/Gerard-007/ajor_app/internal/auth"
 	"github.com/Gerard-007/ajor_app/internal/handlers"
+	"github.com/Gerard-007/ajor_app/internal/middleware"
 	"github.com/Gerard-007/ajor_app/internal/repository"
 	"github.com/Gerard-007/ajor_app/internal/services"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
@@ -10,7 +11,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func InitRoutes(router *gin.Engine, db *mongo.Database, pg payment.PaymentGateway) {
+func InitRoutes(router *gin.Engine, db *mongo.Database, pg *payment.Registry) {
 	usersCollection := db.Collection("users")
 	// Authentication routes
 	router.POST("/login", handlers.LoginHandler(usersCollection))
@@ -19,7 +20,12 @@ func InitRoutes(router *gin.Engine, db *mongo.Database, pg payment.PaymentGatewa
 
 	notifRepo := repository.NewNotificationRepository(db)
 	notifService := services.NewNotificationService(notifRepo)
+	// Webhook routes; providers sign their requests instead of logging in
+	router.POST("/webhook/flutterwave", handlers.FlutterwaveWebhookHandler(db, pg, notifService))
+	router.POST("/webhook/paystack", handlers.PaystackWebhookHandler(db, pg, notifService))
 	notifHandler := handlers.NewNotificationHandler(notifService)
+	// Money-moving routes replay the original response for a retried Idempotency-Key
+	idempotent := middleware.Idempotency(db)
 
 	// Authenticated routes
 	authenticated := router.Group("/")
@@ -37,12 +43,25 @@ func InitRoutes(router *gin.Engine, db *mongo.Database, pg payment.PaymentGatewa
 		authenticated.GET("/contributions/:id", handlers.GetContributionHandler(db))
 		authenticated.GET("/contributions/:id/wallet", handlers.GetContributionWalletHandler(db, pg))
 		authenticated.GET("/contributions/:id/transactions", handlers.GetContributionTransactionsHandler(db))
+		authenticated.GET("/contributions/:id/arrears", handlers.GetContributionArrearsHandler(db))
+		authenticated.GET("/contributions/:id/cycles", handlers.GetCycleScheduleHandler(db))
+		authenticated.GET("/contributions/:id/cycles/matrix", handlers.GetCycleStatusMatrixHandler(db))
+		authenticated.GET("/contributions/:id/cycles/:n", handlers.GetCycleDetailHandler(db))
+		authenticated.POST("/contributions/:id/cycles/:n/waive", handlers.WaiveMemberCycleHandler(db))
 		authenticated.GET("/contributions", handlers.GetUserContributionsHandler(db))
 		authenticated.PUT("/contributions/:id", handlers.UpdateContributionHandler(db))
 		authenticated.POST("/contributions/join", handlers.JoinContributionHandler(db, notifService))
 		authenticated.DELETE("/contributions/:id/:user_id", handlers.RemoveMemberHandler(db, notifService))
-		authenticated.POST("/contributions/:id/contribute", handlers.RecordContributionHandler(db, notifService))
-		authenticated.POST("/contributions/:id/payout", handlers.RecordPayoutHandler(db, notifService))
+		authenticated.POST("/contributions/:id/contribute", idempotent, handlers.RecordContributionHandler(db, notifService))
+		authenticated.POST("/contributions/:id/payout", idempotent, handlers.RecordPayoutHandler(db, notifService))
+		authenticated.GET("/contributions/:id/auto-debit", handlers.GetStandingOrderHandler(db))
+		authenticated.PUT("/contributions/:id/auto-debit", handlers.SetStandingOrderHandler(db))
+		authenticated.PUT("/contributions/:id/collector", handlers.AssignCollectorHandler(db, notifService))
+		authenticated.PUT("/contributions/:id/approval-policy", handlers.SetApprovalPolicyHandler(db, notifService))
+		authenticated.POST("/contributions/:id/deposits", idempotent, handlers.RecordDepositHandler(db, notifService))
+		authenticated.GET("/contributions/:id/schedule", handlers.GetPayoutScheduleHandler(db))
+		authenticated.POST("/contributions/:id/schedule/lock", handlers.LockPayoutScheduleHandler(db))
+		authenticated.POST("/contributions/:id/bids", handlers.PlacePayoutBidHandler(db))
 		authenticated.GET("/notifications", notifHandler.GetAll)
 		authenticated.GET("/notifications/unread", notifHandler.GetUnread)
 		authenticated.POST("/notifications/mark-read", notifHandler.MarkAsRead)
@@ -54,18 +73,38 @@ func InitRoutes(router *gin.Engine, db *mongo.Database, pg payment.PaymentGatewa
 		authenticated.POST("/contributions/:id/collections", handlers.CreateCollectionHandler(db, notifService))
 		authenticated.GET("/contributions/:id/collections", handlers.GetCollectionsHandler(db))
 		// Approval routes
-		authenticated.PUT("/approvals/:approval_id", handlers.ApprovePayoutHandler(db, notifService))
+		authenticated.PUT("/approvals/:approval_id", idempotent, handlers.ApprovePayoutHandler(db, notifService))
 		authenticated.GET("/approvals", handlers.GetPendingApprovalsHandler(db))
+		authenticated.POST("/approvals/delegations", handlers.DelegateApprovalsHandler(db, notifService))
+		authenticated.GET("/approvals/delegations", handlers.GetApprovalDelegationsHandler(db))
+		authenticated.DELETE("/approvals/delegations/:delegation_id", handlers.RevokeApprovalDelegationHandler(db))
 		// Wallet routes
 		authenticated.GET("/wallet", handlers.GetUserWalletHandler(db, pg))
-		authenticated.POST("/wallet/fund", handlers.FundWalletHandler(db, pg))
+		authenticated.POST("/wallet/fund", idempotent, handlers.FundWalletHandler(db, pg))
 		authenticated.GET("/wallet/transactions", handlers.GetUserTransactionsHandler(db))
 		authenticated.DELETE("/wallet", handlers.DeleteWalletHandler(db, pg))
+		authenticated.POST("/wallet/withdraw", idempotent, handlers.WithdrawHandler(db, pg))
+		authenticated.GET("/bank-accounts", handlers.GetBankAccountsHandler(db))
+		authenticated.GET("/bank-accounts/resolve", handlers.ResolveBankAccountHandler(pg))
+		authenticated.POST("/bank-accounts", handlers.AddBankAccountHandler(db, pg))
+		authenticated.DELETE("/bank-accounts/:id", handlers.RemoveBankAccountHandler(db))
+		authenticated.GET("/admin/wallets/:id/reconciliation", handlers.GetWalletReconciliationHandler(db))
+		authenticated.GET("/admin/webhook-events", handlers.ListWebhookEventsHandler(db))
+		authenticated.GET("/admin/webhook-events/:id", handlers.GetWebhookEventHandler(db))
+		authenticated.POST("/admin/webhook-events/:id/replay", handlers.ReplayWebhookEventHandler(db, pg, notifService))
+		authenticated.GET("/admin/reconciliation-reports", handlers.ListReconciliationReportsHandler(db))
+		authenticated.GET("/admin/reconciliation-reports/:id", handlers.GetReconciliationReportHandler(db))
+		authenticated.POST("/admin/reconciliation-reports", handlers.RunReconciliationHandler(db, pg))
+		// Savings goal routes
+		authenticated.POST("/goals", handlers.CreateGoalHandler(db))
+		authenticated.GET("/goals", handlers.GetUserGoalsHandler(db))
+		authenticated.GET("/goals/:id", handlers.GetGoalHandler(db))
+		authenticated.POST("/goals/:id/fund", idempotent, handlers.FundGoalHandler(db))
+		authenticated.POST("/goals/:id/withdraw", idempotent, handlers.WithdrawGoalHandler(db))
 		authenticated.POST("/notifications/test", notifHandler.CreateTest)
-		authenticated.POST("/wallet/simulate-fund", handlers.SimulateFundWalletHandler(db))
+		authenticated.POST("/wallet/simulate-fund", idempotent, handlers.SimulateFundWalletHandler(db))
 		authenticated.GET("/transactions/:id", handlers.GetTransactionByIdHandler(db))
 		authenticated.POST("/users/change-password", handlers.ChangePasswordHandler(db))
-		authenticated.POST("/webhook/flutterwave", handlers.FlutterwaveWebhookHandler(db, pg))
 	}
 
 	router.GET("/ws", func(c *gin.Context) {
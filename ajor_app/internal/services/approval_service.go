@@ -4,31 +4,65 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func ApprovePayout(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approvalID, approverID primitive.ObjectID, approve bool) error {
+// PayoutVote is where a payout's approval set stands after a vote. Outcome
+// stays pending until Threshold approvals are in, or until so many approvers
+// have rejected it that the rest can't reach Threshold.
+type PayoutVote struct {
+	Approvals  int                   `json:"approvals"`
+	Rejections int                   `json:"rejections"`
+	Threshold  int                   `json:"threshold"`
+	Outcome    models.ApprovalStatus `json:"outcome"`
+}
+
+// ApprovePayout records an approver's vote on a payout. The payout is made
+// by the vote that brings its approval set to its threshold; approvals still
+// pending once the outcome is decided are cancelled. A rejection needs a
+// reason. If it is the vote that rejects the payout, the payout is failed with
+// that reason and its recipient is put back in the rotation at requeue. The
+// rotation took its collector out of the queue when it assigned them the
+// payout, so they go back at the front unless requeue says otherwise.
+// voterID is the approver or someone they have delegated to.
+func ApprovePayout(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approvalID, voterID primitive.ObjectID, approve bool, reason string, requeue models.RequeuePosition) (*PayoutVote, error) {
+	reason = strings.TrimSpace(reason)
+	if !approve && reason == "" {
+		return nil, errors.New("a reason is required to reject a payout")
+	}
+	switch {
+	case requeue != models.RequeueNone && requeue != models.RequeueFront && requeue != models.RequeueBack:
+		return nil, errors.New("requeue must be front or back")
+	case approve && requeue != models.RequeueNone:
+		return nil, errors.New("only the recipient of a rejected payout can be requeued")
+	}
+
 	var approval models.Approval
 	err := db.Collection("approvals").FindOne(ctx, bson.M{"_id": approvalID}).Decode(&approval)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return errors.New("approval not found")
+			return nil, errors.New("approval not found")
 		}
-		return err
+		return nil, err
 	}
 
-	if approval.ApproverID != approverID {
-		return errors.New("unauthorized to approve this payout")
+	if approval.ApproverID != voterID {
+		if err := checkDelegatedVote(ctx, db, &approval, voterID); err != nil {
+			return nil, err
+		}
 	}
 
 	if approval.Status != models.ApprovalPending {
-		return errors.New("approval already processed")
+		return nil, errors.New("approval already processed")
 	}
 
 	var status models.ApprovalStatus
@@ -38,63 +72,444 @@ func ApprovePayout(ctx context.Context, db *mongo.Database, notificationService
 		status = models.ApprovalRejected
 	}
 
-	if err := repository.UpdateApproval(ctx, db, approvalID, status); err != nil {
-		return err
-	}
-
-	if approve {
-		var transaction models.Transaction
-		err := db.Collection("transactions").FindOne(ctx, bson.M{"_id": approval.TransactionID}).Decode(&transaction)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				return errors.New("transaction not found")
+	var vote *PayoutVote
+	var transaction models.Transaction
+	var recipient *models.Wallet
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		recipient = nil
+		// Votes on the same payout are counted one at a time
+		if err := repository.LockPendingTransaction(sc, db, approval.TransactionID); err != nil {
+			if errors.Is(err, repository.ErrTransactionNotPending) {
+				return errors.New("payout not found or already processed")
 			}
 			return err
 		}
-
-		// Update wallet balances
-		if err := repository.UpdateWalletBalance(db, transaction.FromWallet, transaction.Amount, false); err != nil {
+		if approval.ApproverID != voterID {
+			if err := checkSecondVote(sc, db, &approval, voterID); err != nil {
+				return err
+			}
+		}
+		if err := repository.UpdateApproval(sc, db, approvalID, status, reason, voterID); err != nil {
 			return err
 		}
-		if err := repository.UpdateWalletBalance(db, transaction.ToWallet, transaction.Amount, true); err != nil {
-			// Rollback
-			repository.UpdateWalletBalance(db, transaction.FromWallet, transaction.Amount, true)
+		approvals, err := repository.GetApprovalsByTransaction(sc, db, approval.TransactionID)
+		if err != nil {
 			return err
 		}
+		vote = tallyVotes(approvals)
+		if vote.Outcome == models.ApprovalPending {
+			return nil
+		}
 
-		// Update transaction status
-		_, err = db.Collection("transactions").UpdateOne(ctx, bson.M{"_id": transaction.ID}, bson.M{
-			"$set": bson.M{
-				"status":     models.StatusSuccess,
-				"updated_at": time.Now(),
-			},
-		})
+		err = db.Collection("transactions").FindOne(sc, bson.M{"_id": approval.TransactionID}).Decode(&transaction)
 		if err != nil {
-			// Rollback
-			repository.UpdateWalletBalance(db, transaction.FromWallet, transaction.Amount, true)
-			repository.UpdateWalletBalance(db, transaction.ToWallet, transaction.Amount, false)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("transaction not found")
+			}
 			return err
 		}
+		if vote.Outcome == models.ApprovalRejected {
+			if requeue == models.RequeueNone && transaction.RequestedBy.IsZero() {
+				requeue = models.RequeueFront
+			}
+			recipient, err = rejectPayout(sc, db, &transaction, reason, requeue)
+			if err != nil {
+				return err
+			}
+			return cancelPendingApprovals(sc, db, approvals, "the payout was rejected")
+		}
 
-		// Mark member as collected
-		if err := repository.MarkMemberCollected(ctx, db, approval.ContributionID, transaction.ToWallet); err != nil {
+		recipient, err = repository.GetContributionWalletByID(sc, db, transaction.ToWallet)
+		if err != nil {
+			return errors.New("recipient wallet not found")
+		}
+
+		if err := executeTransfer(sc, db, &transaction, false); err != nil {
 			return err
 		}
 
+		// The rotation marks its collector when it closes the cycle and may
+		// have started a new round since, so only requested payouts are
+		// marked here
+		if !transaction.RequestedBy.IsZero() {
+			if err := repository.MarkMemberCollected(sc, db, approval.ContributionID, recipient.OwnerID); err != nil {
+				return err
+			}
+		}
+		return cancelPendingApprovals(sc, db, approvals, "the payout was already approved")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch vote.Outcome {
+	case models.ApprovalApproved:
 		// Notify user
 		n := &models.Notification{
-			UserID:  transaction.ToWallet,
+			UserID:  recipient.OwnerID,
 			Type:    "payout_approved",
 			Title:   "Payout Approved",
-			Message: fmt.Sprintf("Payout of %.2f approved for contribution", transaction.Amount),
-			Meta:    map[string]interface{}{ "amount": transaction.Amount },
+			Message: fmt.Sprintf("Payout of %s approved for contribution", transaction.Amount),
+			Meta:    map[string]interface{}{"amount": transaction.Amount},
+		}
+		if err := notificationService.Create(ctx, n); err != nil {
+			return nil, err
+		}
+	case models.ApprovalRejected:
+		notifyPayoutRejected(ctx, db, notificationService, &transaction, recipient, voterID, reason, requeue)
+	}
+
+	return vote, nil
+}
+
+// rejectPayout fails a rejected payout and requeues its recipient. It returns
+// the recipient's wallet, or nil if it no longer exists.
+func rejectPayout(sc mongo.SessionContext, db *mongo.Database, transaction *models.Transaction, reason string, requeue models.RequeuePosition) (*models.Wallet, error) {
+	if err := repository.FailPendingTransaction(sc, db, transaction.ID, reason); err != nil {
+		return nil, err
+	}
+	transaction.Status = models.StatusFailed
+	transaction.FailureReason = reason
+	// The pot stays in the group wallet, bid and share included
+	if err := repository.AdjustBidPool(sc, db, transaction.ContributionID, unkeptBids(transaction)); err != nil {
+		return nil, err
+	}
+
+	recipient, err := repository.GetContributionWalletByID(sc, db, transaction.ToWallet)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if requeue == models.RequeueNone {
+		return recipient, nil
+	}
+	return recipient, requeueMember(sc, db, transaction.ContributionID, recipient.OwnerID, requeue)
+}
+
+// unkeptBids is how a payout that won't be made changes its group's bid pool:
+// the share it would have paid out goes back, and the bid it kept comes out.
+// Amounts that were zero aren't stored with a currency.
+func unkeptBids(transaction *models.Transaction) money.Money {
+	delta := money.New(0, transaction.Amount.Currency)
+	if !transaction.BidShare.IsZero() {
+		delta = delta.Add(transaction.BidShare)
+	}
+	if !transaction.BidKept.IsZero() {
+		delta = delta.Sub(transaction.BidKept)
+	}
+	return delta
+}
+
+// requeueMember puts a member back among those waiting to collect, first or
+// last. With a locked schedule their slot moves too: ahead of every slot
+// still waiting, or to the end. Members who have left the group aren't
+// requeued.
+func requeueMember(sc mongo.SessionContext, db *mongo.Database, contributionID, memberID primitive.ObjectID, requeue models.RequeuePosition) error {
+	contribution, err := repository.GetContributionByID(sc, db, contributionID)
+	if err != nil {
+		return err
+	}
+	if !containsUser(contributionMembers(contribution), memberID) {
+		return nil
+	}
+
+	yetToCollect := make([]primitive.ObjectID, 0, len(contribution.YetToCollectMembers)+1)
+	for _, member := range contribution.YetToCollectMembers {
+		if member != memberID {
+			yetToCollect = append(yetToCollect, member)
+		}
+	}
+	if requeue == models.RequeueFront {
+		yetToCollect = append([]primitive.ObjectID{memberID}, yetToCollect...)
+	} else {
+		yetToCollect = append(yetToCollect, memberID)
+	}
+
+	schedule := contribution.PayoutSchedule
+	if schedule != nil {
+		slot := models.PayoutSlot{
+			MemberID: memberID,
+			Username: contribution.MemberUsernames[memberID],
+			Bid:      money.New(0, contribution.Amount.Currency),
+		}
+		found := false
+		slots := make([]models.PayoutSlot, 0, len(schedule.Slots)+1)
+		for _, s := range schedule.Slots {
+			if s.MemberID == memberID {
+				slot, found = s, true
+				continue
+			}
+			slots = append(slots, s)
+		}
+		switch {
+		case requeue == models.RequeueFront:
+			// Slots are taken in order, so the member goes ahead of the
+			// first one still waiting
+			i := 0
+			for i < len(slots) && !containsUser(yetToCollect, slots[i].MemberID) {
+				i++
+			}
+			slots = append(slots[:i], append([]models.PayoutSlot{slot}, slots[i:]...)...)
+		case found:
+			slots = append(slots, slot)
+		}
+		for i := range slots {
+			slots[i].Position = i + 1
+		}
+		schedule.Slots = slots
+	}
+	return repository.RequeueMember(sc, db, contributionID, memberID, yetToCollect, schedule)
+}
+
+// notifyPayoutRejected tells a rejected payout's recipient and whoever asked
+// for it, unless they rejected it themselves. Payouts the rotation assigned
+// were asked for on the group admin's behalf. Failures are logged.
+func notifyPayoutRejected(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, recipient *models.Wallet, rejectedBy primitive.ObjectID, reason string, requeue models.RequeuePosition) {
+	meta := map[string]interface{}{"amount": transaction.Amount, "transaction_id": transaction.ID.Hex(), "reason": reason}
+	if requeue != models.RequeueNone {
+		meta["requeue"] = requeue
+	}
+	var recipientID primitive.ObjectID
+	if recipient != nil {
+		recipientID = recipient.OwnerID
+		message := fmt.Sprintf("Your payout of %s was rejected: %s.", transaction.Amount, reason)
+		if requeue != models.RequeueNone {
+			message += fmt.Sprintf(" You have been moved to the %s of the payout queue.", requeue)
+		}
+		n := &models.Notification{
+			UserID:  recipientID,
+			Type:    "payout_rejected",
+			Title:   "Payout Rejected",
+			Message: message,
+			Meta:    meta,
+		}
+		if err := notificationService.Create(ctx, n); err != nil {
+			log.Printf("Failed to notify recipient of rejected payout %s: %v", transaction.ID.Hex(), err)
 		}
-		return notificationService.Create(ctx, n)
 	}
 
+	requester := transaction.RequestedBy
+	if requester.IsZero() {
+		contribution, err := repository.GetContributionByID(ctx, db, transaction.ContributionID)
+		if err != nil {
+			log.Printf("Failed to look up requester of rejected payout %s: %v", transaction.ID.Hex(), err)
+			return
+		}
+		requester = contribution.GroupAdmin
+	}
+	if requester == recipientID || requester == rejectedBy {
+		return
+	}
+	n := &models.Notification{
+		UserID:  requester,
+		Type:    "payout_rejected",
+		Title:   "Payout Rejected",
+		Message: fmt.Sprintf("The payout of %s you requested was rejected: %s.", transaction.Amount, reason),
+		Meta:    meta,
+	}
+	if err := notificationService.Create(ctx, n); err != nil {
+		log.Printf("Failed to notify requester of rejected payout %s: %v", transaction.ID.Hex(), err)
+	}
+}
+
+// tallyVotes counts a payout's approval set. Approvals made before approval
+// sets had a threshold stood alone.
+func tallyVotes(approvals []*models.Approval) *PayoutVote {
+	vote := &PayoutVote{Threshold: 1, Outcome: models.ApprovalPending}
+	pending := 0
+	for _, approval := range approvals {
+		if approval.Threshold > vote.Threshold {
+			vote.Threshold = approval.Threshold
+		}
+		switch approval.Status {
+		case models.ApprovalApproved:
+			vote.Approvals++
+		case models.ApprovalRejected:
+			vote.Rejections++
+		case models.ApprovalPending:
+			pending++
+		}
+	}
+	switch {
+	case vote.Approvals >= vote.Threshold:
+		vote.Outcome = models.ApprovalApproved
+	case vote.Approvals+pending < vote.Threshold:
+		vote.Outcome = models.ApprovalRejected
+	}
+	return vote
+}
+
+func cancelPendingApprovals(sc mongo.SessionContext, db *mongo.Database, approvals []*models.Approval, reason string) error {
+	for _, approval := range approvals {
+		if approval.Status != models.ApprovalPending {
+			continue
+		}
+		if err := repository.CancelApproval(sc, db, approval.ID, reason); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// GetPendingApprovals returns the approvals waiting on approverID's vote,
+// including those delegated to them.
 func GetPendingApprovals(ctx context.Context, db *mongo.Database, approverID primitive.ObjectID) ([]*models.Approval, error) {
-	return repository.GetPendingApprovals(ctx, db, approverID)
-}
\ No newline at end of file
+	delegations, err := repository.GetActiveApprovalDelegations(ctx, db, approverID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return repository.GetPendingApprovals(ctx, db, approverID, delegations)
+}
+
+// SetApprovalPolicy changes how a group's payouts are approved. Only the
+// group admin can change it; payouts already requested keep the approvers
+// they were requested with.
+func SetApprovalPolicy(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, groupAdminID primitive.ObjectID, policy models.ApprovalPolicy) error {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return err
+	}
+	if contribution.GroupAdmin != groupAdminID {
+		return errors.New("only group admin can change the approval policy")
+	}
+	if err := validateApprovalPolicy(contribution, &policy); err != nil {
+		return err
+	}
+	var stored *models.ApprovalPolicy
+	if policy.Mode != models.ApprovalModeAdmin {
+		stored = &policy
+	}
+	if err := repository.SetApprovalPolicy(ctx, db, contributionID, stored); err != nil {
+		return err
+	}
+
+	var previous []primitive.ObjectID
+	if contribution.ApprovalPolicy != nil {
+		previous = contribution.ApprovalPolicy.Treasurers
+	}
+	for _, treasurer := range policy.Treasurers {
+		if containsUser(previous, treasurer) {
+			continue
+		}
+		n := &models.Notification{
+			UserID:  treasurer,
+			Type:    "treasurer_elected",
+			Title:   "Elected Treasurer",
+			Message: fmt.Sprintf("You are now a treasurer of %s. Payouts from the group need %d approvals from its admin and treasurers.", contribution.Name, policy.Threshold),
+			Meta:    map[string]interface{}{"group": contribution.Name, "threshold": policy.Threshold},
+		}
+		if err := notificationService.Create(ctx, n); err != nil {
+			log.Printf("Failed to notify treasurer %s: %v", treasurer.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func validateApprovalPolicy(contribution *models.Contribution, policy *models.ApprovalPolicy) error {
+	switch policy.Mode {
+	case models.ApprovalModeAdmin, models.ApprovalModeMajority:
+		if len(policy.Treasurers) > 0 {
+			return fmt.Errorf("treasurers are only elected in %s mode", models.ApprovalModeTreasurers)
+		}
+		policy.Treasurers = nil
+		policy.Threshold = 0
+		return nil
+	case models.ApprovalModeTreasurers:
+	default:
+		return errors.New("invalid approval mode")
+	}
+
+	if len(policy.Treasurers) == 0 {
+		return errors.New("at least one treasurer is required")
+	}
+	members := contributionMembers(contribution)
+	var treasurers []primitive.ObjectID
+	for _, treasurer := range policy.Treasurers {
+		if treasurer == contribution.GroupAdmin {
+			return errors.New("the group admin can't also be a treasurer")
+		}
+		if !containsUser(members, treasurer) {
+			return fmt.Errorf("treasurer %s is not a member of the group", treasurer.Hex())
+		}
+		if containsUser(treasurers, treasurer) {
+			return fmt.Errorf("treasurer %s is listed twice", treasurer.Hex())
+		}
+		treasurers = append(treasurers, treasurer)
+	}
+	if policy.Threshold < 1 || policy.Threshold > len(treasurers)+1 {
+		return fmt.Errorf("threshold must be between 1 and %d", len(treasurers)+1)
+	}
+	return nil
+}
+
+// payoutApprovers lists who must vote on a payout to payee under a group's
+// approval policy, and how many of them must approve it. Treasurers who have
+// left the group don't vote, and the threshold is lowered if too few
+// approvers are left to reach it.
+func payoutApprovers(contribution *models.Contribution, payee primitive.ObjectID) ([]primitive.ObjectID, int) {
+	policy := contribution.ApprovalPolicy
+	if policy == nil || policy.Mode == models.ApprovalModeAdmin {
+		return []primitive.ObjectID{contribution.GroupAdmin}, 1
+	}
+
+	members := contributionMembers(contribution)
+	var candidates []primitive.ObjectID
+	switch policy.Mode {
+	case models.ApprovalModeTreasurers:
+		candidates = append(candidates, contribution.GroupAdmin)
+		for _, treasurer := range policy.Treasurers {
+			if containsUser(members, treasurer) && !containsUser(candidates, treasurer) {
+				candidates = append(candidates, treasurer)
+			}
+		}
+	case models.ApprovalModeMajority:
+		candidates = members
+	}
+
+	var approvers []primitive.ObjectID
+	for _, candidate := range candidates {
+		if candidate != payee {
+			approvers = append(approvers, candidate)
+		}
+	}
+	if len(approvers) == 0 {
+		return []primitive.ObjectID{contribution.GroupAdmin}, 1
+	}
+	threshold := policy.Threshold
+	if policy.Mode == models.ApprovalModeMajority {
+		threshold = len(approvers)/2 + 1
+	}
+	if threshold < 1 {
+		threshold = 1
+	}
+	if threshold > len(approvers) {
+		threshold = len(approvers)
+	}
+	return approvers, threshold
+}
+
+// notifyApprovers sends a copy of n to every approver still to vote on a
+// payout, except the one who asked for it. Failures are logged.
+func notifyApprovers(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transactionID, except primitive.ObjectID, n models.Notification) {
+	approvals, err := repository.GetApprovalsByTransaction(ctx, db, transactionID)
+	if err != nil {
+		log.Printf("Failed to look up approvers of payout %s: %v", transactionID.Hex(), err)
+		return
+	}
+	for _, approval := range approvals {
+		if approval.Status != models.ApprovalPending || approval.ApproverID == except {
+			continue
+		}
+		notification := n
+		notification.UserID = approval.ApproverID
+		notification.Meta = map[string]interface{}{"approval_id": approval.ID.Hex(), "threshold": approval.Threshold}
+		for key, value := range n.Meta {
+			notification.Meta[key] = value
+		}
+		if err := notificationService.Create(ctx, &notification); err != nil {
+			log.Printf("Failed to notify approver %s: %v", approval.ApproverID.Hex(), err)
+		}
+	}
+}
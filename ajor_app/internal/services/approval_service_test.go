@@ -0,0 +1,123 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTallyVotes(t *testing.T) {
+	const (
+		a = models.ApprovalApproved
+		r = models.ApprovalRejected
+		p = models.ApprovalPending
+		c = models.ApprovalCancelled
+	)
+	tests := []struct {
+		name      string
+		threshold int
+		statuses  []models.ApprovalStatus
+		want      PayoutVote
+	}{
+		{"lone legacy approval", 0, []models.ApprovalStatus{p}, PayoutVote{Threshold: 1, Outcome: p}},
+		{"lone legacy approval approved", 0, []models.ApprovalStatus{a}, PayoutVote{Approvals: 1, Threshold: 1, Outcome: a}},
+		{"threshold not reached yet", 2, []models.ApprovalStatus{a, p, p}, PayoutVote{Approvals: 1, Threshold: 2, Outcome: p}},
+		{"threshold reached", 2, []models.ApprovalStatus{a, a, p}, PayoutVote{Approvals: 2, Threshold: 2, Outcome: a}},
+		{"threshold reached despite a rejection", 2, []models.ApprovalStatus{a, r, a}, PayoutVote{Approvals: 2, Rejections: 1, Threshold: 2, Outcome: a}},
+		{"rejection still outvotable", 2, []models.ApprovalStatus{r, p, p}, PayoutVote{Rejections: 1, Threshold: 2, Outcome: p}},
+		{"rejections make threshold unreachable", 2, []models.ApprovalStatus{r, r, p}, PayoutVote{Rejections: 2, Threshold: 2, Outcome: r}},
+		{"unanimity broken by one rejection", 3, []models.ApprovalStatus{a, a, r}, PayoutVote{Approvals: 2, Rejections: 1, Threshold: 3, Outcome: r}},
+		{"removed approvers leave enough", 2, []models.ApprovalStatus{c, p, p}, PayoutVote{Threshold: 2, Outcome: p}},
+		{"removed approvers leave too few", 2, []models.ApprovalStatus{c, c, p}, PayoutVote{Threshold: 2, Outcome: r}},
+		{"removed approver after threshold reached", 2, []models.ApprovalStatus{a, a, c}, PayoutVote{Approvals: 2, Threshold: 2, Outcome: a}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approvals := make([]*models.Approval, len(tt.statuses))
+			for i, status := range tt.statuses {
+				approvals[i] = &models.Approval{Status: status, Threshold: tt.threshold}
+			}
+			if got := tallyVotes(approvals); *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateApprovalPolicy(t *testing.T) {
+	admin, alice, bob, outsider := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	contribution := &models.Contribution{
+		GroupAdmin:              admin,
+		YetToCollectMembers:     []primitive.ObjectID{admin, alice},
+		AlreadyCollectedMembers: []primitive.ObjectID{bob},
+	}
+	tests := []struct {
+		name    string
+		policy  models.ApprovalPolicy
+		wantErr string
+	}{
+		{name: "admin", policy: models.ApprovalPolicy{Mode: models.ApprovalModeAdmin}},
+		{name: "majority ignores threshold", policy: models.ApprovalPolicy{Mode: models.ApprovalModeMajority, Threshold: 9}},
+		{name: "majority with treasurers", policy: models.ApprovalPolicy{Mode: models.ApprovalModeMajority, Treasurers: []primitive.ObjectID{alice}}, wantErr: "only elected"},
+		{name: "unknown mode", policy: models.ApprovalPolicy{Mode: "anyone"}, wantErr: "invalid approval mode"},
+		{name: "no treasurers", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Threshold: 1}, wantErr: "at least one treasurer"},
+		{name: "two of three", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 2}},
+		{name: "all of three", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 3}},
+		{name: "threshold above approvers", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 4}, wantErr: "between 1 and 3"},
+		{name: "zero threshold", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice}}, wantErr: "between 1 and 2"},
+		{name: "admin as treasurer", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{admin}, Threshold: 1}, wantErr: "group admin"},
+		{name: "treasurer not a member", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{outsider}, Threshold: 1}, wantErr: "not a member"},
+		{name: "treasurer listed twice", policy: models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, alice}, Threshold: 1}, wantErr: "listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			err := validateApprovalPolicy(contribution, &policy)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPayoutApprovers(t *testing.T) {
+	admin, alice, bob, carol, departed := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	members := []primitive.ObjectID{admin, alice, bob, carol}
+	tests := []struct {
+		name          string
+		policy        *models.ApprovalPolicy
+		payee         primitive.ObjectID
+		wantApprovers []primitive.ObjectID
+		wantThreshold int
+	}{
+		{"no policy", nil, alice, []primitive.ObjectID{admin}, 1},
+		{"treasurers", &models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 2}, carol, []primitive.ObjectID{admin, alice, bob}, 2},
+		{"payee doesn't vote", &models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 2}, alice, []primitive.ObjectID{admin, bob}, 2},
+		{"departed treasurer removed", &models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, departed}, Threshold: 3}, carol, []primitive.ObjectID{admin, alice}, 2},
+		{"threshold lowered to who is left", &models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{alice, bob}, Threshold: 3}, bob, []primitive.ObjectID{admin, alice}, 2},
+		{"majority", &models.ApprovalPolicy{Mode: models.ApprovalModeMajority}, carol, []primitive.ObjectID{admin, alice, bob}, 2},
+		{"admin collecting falls back to admin", &models.ApprovalPolicy{Mode: models.ApprovalModeTreasurers, Treasurers: []primitive.ObjectID{departed}, Threshold: 1}, admin, []primitive.ObjectID{admin}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contribution := &models.Contribution{GroupAdmin: admin, YetToCollectMembers: members, ApprovalPolicy: tt.policy}
+			approvers, threshold := payoutApprovers(contribution, tt.payee)
+			if len(approvers) != len(tt.wantApprovers) {
+				t.Fatalf("got approvers %v, want %v", approvers, tt.wantApprovers)
+			}
+			for i := range approvers {
+				if approvers[i] != tt.wantApprovers[i] {
+					t.Fatalf("got approvers %v, want %v", approvers, tt.wantApprovers)
+				}
+			}
+			if threshold != tt.wantThreshold {
+				t.Errorf("got threshold %d, want %d", threshold, tt.wantThreshold)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"github.com/Gerard-007/ajor_app/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson"
@@ -151,7 +152,7 @@ func RegisterUser(db *mongo.Database, user *models.User, pg payment.PaymentGatew
 		ID:            primitive.NewObjectID(),
 		OwnerID:       user.ID,
 		Type:          models.WalletTypeUser,
-		Balance:       0.0,
+		Balance:       money.FromKobo(0),
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -170,7 +171,7 @@ func RegisterUser(db *mongo.Database, user *models.User, pg payment.PaymentGatew
 
 	// Create virtual account
 	narration := fmt.Sprintf("Wallet for %s", user.Username)
-	va, err := pg.CreateVirtualAccount(ctx, user.ID, user.Email, user.Phone, narration, true, user.BVN, 0.0)
+	va, err := pg.CreateVirtualAccount(ctx, user.ID, user.Email, user.Phone, narration, true, user.BVN, money.Money{})
 	if err != nil {
 		log.Printf("Failed to create virtual account for user %s: %v", user.Email, err)
 		usersCollection.DeleteOne(ctx, bson.M{"_id": user.ID})
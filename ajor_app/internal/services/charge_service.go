@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// inboundCharge is a successful charge as a provider's webhook describes it.
+// VerifyID is the ID VerifyTransaction looks the charge up by. AccountNumber
+// and AccountID say which virtual account a bank transfer was paid into, when
+// the charge is one.
+type inboundCharge struct {
+	Provider      payment.Provider
+	ID            string
+	VerifyID      string
+	TxRef         string
+	Amount        money.Money
+	AccountNumber string
+	AccountID     string
+}
+
+// creditCharge credits a successful charge to the wallet it was for: the
+// funding transaction with its reference, or else the wallet owning the
+// virtual account it was paid into. The webhook is only a prompt; what is
+// credited is what the gateway says it charged.
+func creditCharge(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, charge inboundCharge) (string, error) {
+	if charge.TxRef != "" {
+		transaction, err := repository.GetTransactionByTxRef(ctx, db, charge.TxRef)
+		if err == nil {
+			return creditFunding(ctx, db, pg, notificationService, transaction, charge)
+		}
+		if err != mongo.ErrNoDocuments {
+			return "", err
+		}
+	}
+	if charge.AccountNumber != "" || charge.AccountID != "" {
+		return creditInboundTransfer(ctx, db, pg, notificationService, charge)
+	}
+	log.Printf("Transaction not found for txRef: %s", charge.TxRef)
+	return "ignored", nil
+}
+
+// creditFunding settles the pending funding transaction a successful charge
+// paid for, unless the charge doesn't match it. A funding that has already
+// failed, e.g. expired by the sweeper, is never revived: a successful charge
+// for it is flagged as a discrepancy for an operator.
+func creditFunding(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, transaction *models.Transaction, charge inboundCharge) (string, error) {
+	if transaction.Type != models.TransactionWallet || !transaction.FromWallet.IsZero() {
+		log.Printf("Charge reference %s belongs to a %s transaction, not a funding", transaction.TxRef, transaction.Type)
+		return "ignored", nil
+	}
+	switch transaction.Status {
+	case models.StatusSuccess:
+		return "already_processed", nil
+	case models.StatusDiscrepancy:
+		return "discrepancy", nil
+	}
+
+	verified, discrepancy, err := verifyCharge(ctx, pg, charge, transaction.Amount)
+	if err != nil {
+		return "", err
+	}
+	if transaction.Status == models.StatusFailed {
+		if verified.Status != payment.ChargeSuccessful {
+			// The gateway agrees the funding wasn't paid
+			return "already_processed", nil
+		}
+		if discrepancy == "" {
+			discrepancy = failedFundingCharged(verified)
+		}
+	}
+	if discrepancy != "" {
+		return flagFundingDiscrepancy(ctx, db, notificationService, transaction, charge, discrepancy)
+	}
+
+	// Credit the wallet through the ledger and settle the transaction
+	transaction.Amount = verified.Amount
+	err = ExecuteTransfer(ctx, db, transaction)
+	if errors.Is(err, repository.ErrTransactionNotPending) {
+		// Settled or failed since it was loaded
+		current, err := repository.GetTransactionByID(ctx, db, transaction.ID)
+		if err != nil {
+			return "", err
+		}
+		if current.Status != models.StatusFailed {
+			return "already_processed", nil
+		}
+		return flagFundingDiscrepancy(ctx, db, notificationService, current, charge, failedFundingCharged(verified))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to update wallet balance: %v", err)
+	}
+	wallet, err := repository.GetWalletByID(db, transaction.ToWallet)
+	if err == nil {
+		notificationService.CreateWalletFundedNotification(ctx, wallet.OwnerID, verified.Amount)
+	}
+	log.Printf("Wallet funded: txRef=%s, amount=%s", transaction.TxRef, verified.Amount)
+	return "credited", nil
+}
+
+func failedFundingCharged(verified *payment.TransactionResponse) string {
+	return fmt.Sprintf("the gateway charged %s %s after the funding had failed", verified.Amount, verified.Amount.Currency)
+}
+
+// flagFundingDiscrepancy marks a pending or failed funding as a discrepancy
+// and alerts the system admins, instead of crediting it.
+func flagFundingDiscrepancy(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, charge inboundCharge, discrepancy string) (string, error) {
+	err := repository.MarkTransactionDiscrepancy(ctx, db, transaction.ID, discrepancy)
+	if errors.Is(err, repository.ErrTransactionNotPending) {
+		return "already_processed", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	transaction.Status = models.StatusDiscrepancy
+	transaction.Discrepancy = discrepancy
+	alertDiscrepancy(ctx, db, notificationService, transaction, charge)
+	return "discrepancy", nil
+}
+
+// creditInboundTransfer credits a bank transfer made straight into a
+// wallet's virtual account, which no transaction was waiting for. The
+// transaction is created with the gateway's ID for the charge, which is
+// unique among wallet transactions, so a charge is credited once however
+// often it is reported. A charge that doesn't check out is recorded with
+// StatusDiscrepancy instead, also once.
+func creditInboundTransfer(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, charge inboundCharge) (string, error) {
+	// Virtual accounts created before the payment registry are stored with
+	// Flutterwave's unprefixed ID
+	var accountIDs []string
+	if charge.AccountID != "" {
+		accountIDs = append(accountIDs, payment.QualifiedID(charge.Provider, charge.AccountID))
+		if charge.Provider == payment.ProviderFlutterwave {
+			accountIDs = append(accountIDs, charge.AccountID)
+		}
+	}
+	wallet, err := repository.GetWalletByVirtualAccount(ctx, db, charge.AccountNumber, accountIDs)
+	if err != nil {
+		return "", fmt.Errorf("no wallet for virtual account number %q, ID %q: %v", charge.AccountNumber, charge.AccountID, err)
+	}
+	if charge.ID == "" {
+		return "", errors.New("inbound transfer has no charge ID")
+	}
+
+	verified, discrepancy, err := verifyCharge(ctx, pg, charge, charge.Amount)
+	if err != nil {
+		return "", err
+	}
+	if discrepancy == "" && (!verified.Amount.IsPositive() || !verified.Amount.SameCurrency(wallet.Balance)) {
+		discrepancy = fmt.Sprintf("%s %s can't be credited to a %s wallet", verified.Amount, verified.Amount.Currency, wallet.Balance.Currency)
+	}
+
+	reference := payment.QualifiedID(charge.Provider, charge.ID)
+	transaction := &models.Transaction{
+		ToWallet:         wallet.ID,
+		Amount:           verified.Amount,
+		Type:             models.TransactionWallet,
+		Date:             time.Now(),
+		PaymentMethod:    models.PaymentBankTransfer,
+		TxRef:            reference,
+		GatewayReference: reference,
+	}
+	if discrepancy != "" {
+		transaction.Status = models.StatusDiscrepancy
+		transaction.Discrepancy = discrepancy
+		err := repository.CreateTransaction(ctx, db, transaction)
+		if mongo.IsDuplicateKeyError(err) {
+			return "already_processed", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		alertDiscrepancy(ctx, db, notificationService, transaction, charge)
+		return "discrepancy", nil
+	}
+
+	err = ExecuteTransfer(ctx, db, transaction)
+	if mongo.IsDuplicateKeyError(err) {
+		return "already_processed", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to credit inbound transfer: %v", err)
+	}
+	notificationService.CreateWalletFundedNotification(ctx, wallet.OwnerID, verified.Amount)
+	log.Printf("Inbound transfer credited: wallet=%s, reference=%s, amount=%s", wallet.ID.Hex(), reference, verified.Amount)
+	return "credited", nil
+}
+
+// verifyCharge looks up a charge a webhook reported as successful with the
+// gateway, and says why it can't be credited as expected, if it can't. A
+// charge the gateway still has as pending is an error, so the webhook is
+// retried later.
+func verifyCharge(ctx context.Context, pg payment.PaymentGateway, charge inboundCharge, expected money.Money) (*payment.TransactionResponse, string, error) {
+	if charge.VerifyID == "" {
+		return nil, "", errors.New("charge has no ID to verify it by")
+	}
+	verified, err := pg.VerifyTransaction(ctx, charge.VerifyID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to verify charge %s: %v", charge.VerifyID, err)
+	}
+	switch {
+	case verified.Status == payment.ChargePending:
+		return nil, "", fmt.Errorf("charge %s is still pending with the gateway", charge.VerifyID)
+	case verified.Status != payment.ChargeSuccessful:
+		return verified, fmt.Sprintf("the gateway reports the charge as %s", verified.Status), nil
+	case charge.TxRef != "" && verified.TxRef != charge.TxRef:
+		return verified, fmt.Sprintf("the gateway has the charge under reference %q, not %q", verified.TxRef, charge.TxRef), nil
+	case !verified.Amount.Equal(charge.Amount):
+		return verified, fmt.Sprintf("the webhook reported %s %s but the gateway charged %s %s", charge.Amount, charge.Amount.Currency, verified.Amount, verified.Amount.Currency), nil
+	case !verified.Amount.Equal(expected):
+		return verified, fmt.Sprintf("expected %s %s but the gateway charged %s %s", expected, expected.Currency, verified.Amount, verified.Amount.Currency), nil
+	}
+	return verified, "", nil
+}
+
+// alertDiscrepancy tells every system admin about a charge that wasn't
+// credited because it didn't check out.
+func alertDiscrepancy(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, charge inboundCharge) {
+	log.Printf("Payment discrepancy on transaction %s (charge %s): %s", transaction.ID.Hex(), charge.VerifyID, transaction.Discrepancy)
+	notifyAdmins(ctx, db, notificationService, models.Notification{
+		Type:    "payment_discrepancy",
+		Title:   "Payment Discrepancy",
+		Message: fmt.Sprintf("Charge %s was not credited: %s.", charge.VerifyID, transaction.Discrepancy),
+		Meta: map[string]interface{}{
+			"transaction_id": transaction.ID.Hex(),
+			"charge":         charge.VerifyID,
+			"wallet_id":      transaction.ToWallet.Hex(),
+			"reason":         transaction.Discrepancy,
+		},
+	})
+}
@@ -22,9 +22,18 @@ func CreateCollection(ctx context.Context, db *mongo.Database, notificationServi
 		return errors.New("only group admin can create collections")
 	}
 
+	// Without a collector, schedule whoever is next in the payout order. A
+	// locked schedule can't be jumped.
+	next, _ := nextCollector(contribution)
+	if collectorID.IsZero() {
+		collectorID = next
+	}
 	if !containsUser(contribution.YetToCollectMembers, collectorID) {
 		return errors.New("collector not in contribution")
 	}
+	if contribution.PayoutSchedule != nil && collectorID != next {
+		return errors.New("collector is not next in the payout order")
+	}
 
 	var finalCollectionDate time.Time
 	if collectionDate == nil {
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,18 +20,53 @@ func CreateContribution(ctx context.Context, db *mongo.Database, pg payment.Paym
 	if contribution.Name == "" || contribution.Cycle == "" || contribution.Type == "" {
 		return errors.New("name, cycle, and type are required")
 	}
-	if contribution.Amount <= 0 {
+	if !contribution.Amount.IsPositive() {
 		return errors.New("amount must be positive")
 	}
-	if contribution.PenaltyAmount < 0 {
+	if contribution.PenaltyAmount.IsNegative() {
 		return errors.New("penalty amount cannot be negative")
 	}
+	if contribution.GracePeriodHours < 0 {
+		return errors.New("grace period cannot be negative")
+	}
 	//if contribution.CycleCount <= 0 {
 	//	return errors.New("cycle count must be positive")
 	//}
 	if !isValidCycle(contribution.Cycle) || !isValidType(contribution.Type) {
 		return errors.New("invalid cycle or type")
 	}
+	if contribution.PayoutOrder == "" {
+		contribution.PayoutOrder = models.PayoutOrderJoin
+	}
+	if !isValidPayoutOrder(contribution.PayoutOrder) {
+		return errors.New("invalid payout order")
+	}
+	contribution.PayoutSchedule = nil
+	contribution.PayoutBids = nil
+	contribution.DrawSeed = ""
+	contribution.DrawCommitment = ""
+	if contribution.PayoutOrder == models.PayoutOrderRandom {
+		// Members can check the draw against the commitment from the start
+		seed, err := newDrawSeed()
+		if err != nil {
+			return err
+		}
+		contribution.DrawSeed = seed
+		contribution.DrawCommitment = drawCommitment(seed)
+	}
+	// Treasurers are elected from members, once the group has some
+	contribution.ApprovalPolicy = nil
+	if contribution.Type == models.TypeDailySavings {
+		// Deposits are daily but the savings are paid back monthly
+		contribution.Cycle = models.CycleMonthly
+		if !contribution.CollectorID.IsZero() {
+			if err := validateCollector(db, groupAdminID, contribution.CollectorID); err != nil {
+				return err
+			}
+		}
+	} else {
+		contribution.CollectorID = primitive.NilObjectID
+	}
 
 	// Set collection day and deadline
 	switch contribution.Cycle {
@@ -58,7 +95,7 @@ func CreateContribution(ctx context.Context, db *mongo.Database, pg payment.Paym
 		ID:      primitive.NewObjectID(),
 		OwnerID: groupAdminID,
 		Type:    models.WalletTypeContribution,
-		Balance: 0.0,
+		Balance: money.New(0, contribution.Amount.Currency),
 	}
 	if err := repository.CreateWallet(db, wallet); err != nil {
 		return fmt.Errorf("failed to create wallet: %w", err)
@@ -96,8 +133,16 @@ func CreateContribution(ctx context.Context, db *mongo.Database, pg payment.Paym
 	contribution.WalletID = wallet.ID
 	contribution.YetToCollectMembers = []primitive.ObjectID{groupAdminID}
 	contribution.AlreadyCollectedMembers = []primitive.ObjectID{}
+	contribution.CurrentCycle = 1
+	contribution.CycleStartedAt = time.Now()
 
-	return repository.CreateContribution(ctx, db, contribution)
+	if err := repository.CreateContribution(ctx, db, contribution); err != nil {
+		return err
+	}
+	if _, err := createCycleWindow(ctx, db, contribution, firstCycleWindow(contribution)); err != nil {
+		log.Printf("Failed to create first cycle of contribution %s: %v", contribution.ID.Hex(), err)
+	}
+	return nil
 }
 func GetUserContributionsByUserId(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]*models.Contribution, error) {
 	return repository.GetContributionsByUserID(ctx, db, userID)
@@ -109,7 +154,7 @@ func GetContribution(ctx context.Context, db *mongo.Database, id, userID primiti
 		return nil, err
 	}
 
-	if contribution.GroupAdmin != userID &&
+	if contribution.GroupAdmin != userID && contribution.CollectorID != userID &&
 		!containsUser(contribution.YetToCollectMembers, userID) &&
 		!containsUser(contribution.AlreadyCollectedMembers, userID) {
 		return nil, errors.New("unauthorized access to contribution")
@@ -130,6 +175,23 @@ func UpdateContribution(ctx context.Context, db *mongo.Database, id, userID prim
 	if existing.GroupAdmin != userID {
 		return errors.New("only group admin can update contribution")
 	}
+	if contribution.Type == "" {
+		contribution.Type = existing.Type
+	}
+	if contribution.Type != existing.Type {
+		return errors.New("contribution type can't change")
+	}
+	if contribution.PayoutOrder == "" {
+		contribution.PayoutOrder = existing.PayoutOrder
+	}
+	if contribution.PayoutOrder != existing.PayoutOrder {
+		if !isValidPayoutOrder(contribution.PayoutOrder) {
+			return errors.New("invalid payout order")
+		}
+		if existing.PayoutSchedule != nil {
+			return errors.New("payout order can't change once the schedule is locked")
+		}
+	}
 
 	return repository.UpdateContribution(ctx, db, id, contribution)
 }
@@ -155,6 +217,9 @@ func JoinContribution(ctx context.Context, db *mongo.Database, notificationServi
 	if contribution.InviteCode != inviteCode {
 		return errors.New("invalid invite code")
 	}
+	if contribution.Type == models.TypeDailySavings {
+		return errors.New("daily savings can't be joined")
+	}
 	if containsUser(contribution.YetToCollectMembers, userID) || containsUser(contribution.AlreadyCollectedMembers, userID) {
 		return errors.New("user already in contribution")
 	}
@@ -196,6 +261,9 @@ func RemoveMember(ctx context.Context, db *mongo.Database, notificationService *
 	if err != nil {
 		return err
 	}
+	if err := repository.DeactivateStandingOrder(ctx, db, contributionID, userID); err != nil {
+		return err
+	}
 	// Use NotificationService
 	n := &models.Notification{
 		UserID:  userID,
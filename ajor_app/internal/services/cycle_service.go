@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrCycleAlreadyPaid is returned when a member has paid every cycle that is
+// open so far.
+var ErrCycleAlreadyPaid = errors.New("contribution for the current cycle already paid")
+
+func gracePeriod(contribution *models.Contribution) time.Duration {
+	return time.Duration(contribution.GracePeriodHours) * time.Hour
+}
+
+// firstCycleWindow opens the schedule at the contribution's current cycle.
+// New contributions start at cycle 1; contributions that predate the schedule
+// pick up from the cycle they are on.
+func firstCycleWindow(contribution *models.Contribution) *models.CycleWindow {
+	opensAt := contribution.CycleStartedAt
+	if opensAt.IsZero() {
+		opensAt = contribution.CreatedAt
+	}
+	dueAt := contribution.CollectionDeadline
+	if dueAt.IsZero() {
+		dueAt = computeCollectionDate(contribution.Cycle, opensAt)
+	}
+	return &models.CycleWindow{
+		ContributionID: contribution.ID,
+		Number:         currentCycle(contribution),
+		OpensAt:        opensAt,
+		DueAt:          dueAt,
+		GraceUntil:     dueAt.Add(gracePeriod(contribution)),
+	}
+}
+
+// nextCycleWindow returns the window that follows prev. Each cycle opens when
+// the previous one is due.
+func nextCycleWindow(contribution *models.Contribution, prev *models.CycleWindow) *models.CycleWindow {
+	dueAt := nextCollectionDeadline(contribution.Cycle, prev.DueAt)
+	return &models.CycleWindow{
+		ContributionID: contribution.ID,
+		Number:         prev.Number + 1,
+		OpensAt:        prev.DueAt,
+		DueAt:          dueAt,
+		GraceUntil:     dueAt.Add(gracePeriod(contribution)),
+	}
+}
+
+// nextCollectionDeadline returns the deadline of the cycle after the one
+// ending at deadline.
+func nextCollectionDeadline(cycle models.ContributionCycle, deadline time.Time) time.Time {
+	return computeCollectionDate(cycle, deadline.Add(time.Second))
+}
+
+// createCycleWindow stores a window and, for a group, records that every
+// current member owes the contribution amount for it.
+func createCycleWindow(ctx context.Context, db *mongo.Database, contribution *models.Contribution, window *models.CycleWindow) (*models.CycleWindow, error) {
+	stored, err := repository.CreateCycleWindow(ctx, db, window)
+	if err != nil || contribution.Type != models.TypeGroupContribution {
+		return stored, err
+	}
+	if err := repository.ExpectMemberCycles(ctx, db, contribution.ID, stored.Number, contributionMembers(contribution), contribution.Amount); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// latestCycleWindow returns the newest stored window, creating the first one
+// if the contribution has none yet.
+func latestCycleWindow(ctx context.Context, db *mongo.Database, contribution *models.Contribution) (*models.CycleWindow, error) {
+	latest, err := repository.GetLatestCycleWindow(ctx, db, contribution.ID)
+	if err == mongo.ErrNoDocuments {
+		return createCycleWindow(ctx, db, contribution, firstCycleWindow(contribution))
+	}
+	return latest, err
+}
+
+// EnsureCycleSchedule stores every window up to the one open at now and
+// returns that window.
+func EnsureCycleSchedule(ctx context.Context, db *mongo.Database, contribution *models.Contribution, now time.Time) (*models.CycleWindow, error) {
+	latest, err := latestCycleWindow(ctx, db, contribution)
+	if err != nil {
+		return nil, err
+	}
+	for !latest.DueAt.After(now) {
+		latest, err = createCycleWindow(ctx, db, contribution, nextCycleWindow(contribution, latest))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return latest, nil
+}
+
+// ensureCycleWindow returns window number n, generating the windows before it
+// if needed.
+func ensureCycleWindow(ctx context.Context, db *mongo.Database, contribution *models.Contribution, n int) (*models.CycleWindow, error) {
+	window, err := repository.GetCycleWindow(ctx, db, contribution.ID, n)
+	if err != mongo.ErrNoDocuments {
+		return window, err
+	}
+	latest, err := latestCycleWindow(ctx, db, contribution)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Number > n {
+		return nil, errors.New("cycle window not found")
+	}
+	for latest.Number < n {
+		latest, err = createCycleWindow(ctx, db, contribution, nextCycleWindow(contribution, latest))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return latest, nil
+}
+
+// attributeContributionCycle picks the cycle a member's payment is for: the
+// earliest cycle they haven't paid or been excused from, from the one the
+// group is settling up to the one open now.
+func attributeContributionCycle(ctx context.Context, db *mongo.Database, contribution *models.Contribution, userID, walletID primitive.ObjectID, now time.Time) (*models.CycleWindow, error) {
+	open, err := EnsureCycleSchedule(ctx, db, contribution, now)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := repository.GetPaidCycles(ctx, db, contribution.ID, walletID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := repository.GetMemberCycles(ctx, db, contribution.ID, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.Status == models.MemberCycleWaived {
+			paid[record.Cycle] = true
+		}
+	}
+	for n := currentCycle(contribution); n <= open.Number; n++ {
+		if !paid[n] {
+			return ensureCycleWindow(ctx, db, contribution, n)
+		}
+	}
+	return nil, ErrCycleAlreadyPaid
+}
+
+// AdvanceCycleSchedules keeps the cycle schedule of every running contribution
+// up to date.
+func AdvanceCycleSchedules(ctx context.Context, db *mongo.Database, now time.Time) error {
+	contributions, err := repository.GetAllContributions(db)
+	if err != nil {
+		return err
+	}
+	for _, contribution := range contributions {
+		if contribution.CycleCount <= 0 {
+			continue
+		}
+		if _, err := EnsureCycleSchedule(ctx, db, contribution, now); err != nil {
+			log.Printf("Failed to advance cycle schedule of contribution %s: %v", contribution.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// GetCycleSchedule lists a contribution's cycle windows up to the one open now.
+func GetCycleSchedule(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) ([]*models.CycleWindow, error) {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := EnsureCycleSchedule(ctx, db, contribution, time.Now()); err != nil {
+		return nil, err
+	}
+	return repository.GetCycleWindows(ctx, db, contributionID)
+}
+
+type CycleDetail struct {
+	Window  *models.CycleWindow   `json:"cycle"`
+	Members []*models.MemberCycle `json:"members"`
+}
+
+type MemberCycleRow struct {
+	MemberID primitive.ObjectID         `json:"member_id"`
+	Username string                     `json:"username,omitempty"`
+	Statuses []models.MemberCycleStatus `json:"statuses"`
+}
+
+// CycleStatusMatrix has one row per member, with one status per cycle in the
+// order of Cycles.
+type CycleStatusMatrix struct {
+	Cycles  []*models.CycleWindow `json:"cycles"`
+	Members []*MemberCycleRow     `json:"members"`
+}
+
+// GetCycleDetail shows what each member owes for cycle n and whether they have
+// paid it.
+func GetCycleDetail(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID, n int) (*CycleDetail, error) {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := EnsureCycleSchedule(ctx, db, contribution, time.Now()); err != nil {
+		return nil, err
+	}
+	window, err := repository.GetCycleWindow(ctx, db, contributionID, n)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("cycle not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	records, err := repository.GetMemberCycles(ctx, db, contributionID, primitive.NilObjectID, n)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &CycleDetail{Window: window, Members: []*models.MemberCycle{}}
+	byMember := make(map[primitive.ObjectID]*models.MemberCycle, len(records))
+	for _, record := range records {
+		record.Username = memberUsername(contribution, record.UserID)
+		byMember[record.UserID] = record
+		detail.Members = append(detail.Members, record)
+	}
+	// Members who joined after the cycle opened owe it too
+	if n >= currentCycle(contribution) {
+		for _, member := range contributionMembers(contribution) {
+			if _, ok := byMember[member]; !ok {
+				detail.Members = append(detail.Members, &models.MemberCycle{
+					ContributionID: contributionID,
+					UserID:         member,
+					Username:       memberUsername(contribution, member),
+					Cycle:          n,
+					Amount:         contribution.Amount,
+					Status:         models.MemberCycleExpected,
+				})
+			}
+		}
+	}
+	return detail, nil
+}
+
+// GetCycleStatusMatrix shows every member's payment status for every cycle so
+// far. A member has no status for a settled cycle they weren't part of.
+func GetCycleStatusMatrix(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) (*CycleStatusMatrix, error) {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := EnsureCycleSchedule(ctx, db, contribution, time.Now()); err != nil {
+		return nil, err
+	}
+	windows, err := repository.GetCycleWindows(ctx, db, contributionID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := repository.GetMemberCycles(ctx, db, contributionID, primitive.NilObjectID, 0)
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[primitive.ObjectID]map[int]models.MemberCycleStatus)
+	for _, record := range records {
+		if status[record.UserID] == nil {
+			status[record.UserID] = make(map[int]models.MemberCycleStatus)
+		}
+		status[record.UserID][record.Cycle] = record.Status
+	}
+
+	matrix := &CycleStatusMatrix{Cycles: windows, Members: []*MemberCycleRow{}}
+	for _, member := range contributionMembers(contribution) {
+		row := &MemberCycleRow{
+			MemberID: member,
+			Username: memberUsername(contribution, member),
+			Statuses: make([]models.MemberCycleStatus, len(windows)),
+		}
+		for i, window := range windows {
+			s, ok := status[member][window.Number]
+			if !ok && window.Number >= currentCycle(contribution) {
+				s = models.MemberCycleExpected
+			}
+			row.Statuses[i] = s
+		}
+		matrix.Members = append(matrix.Members, row)
+	}
+	return matrix, nil
+}
+
+// WaiveMemberCycle lets the group admin excuse a member from paying for a
+// cycle that hasn't been settled yet.
+func WaiveMemberCycle(ctx context.Context, db *mongo.Database, contributionID, groupAdminID, memberID primitive.ObjectID, n int) error {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return err
+	}
+	if contribution.GroupAdmin != groupAdminID {
+		return errors.New("only group admin can waive contributions")
+	}
+	if !containsUser(contributionMembers(contribution), memberID) {
+		return errors.New("user not in contribution")
+	}
+	if n < currentCycle(contribution) {
+		return errors.New("cycle already settled")
+	}
+	if _, err := EnsureCycleSchedule(ctx, db, contribution, time.Now()); err != nil {
+		return err
+	}
+	if _, err := repository.GetCycleWindow(ctx, db, contributionID, n); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("cycle not found")
+		}
+		return err
+	}
+	return repository.WaiveMemberCycle(ctx, db, contributionID, memberID, n, contribution.Amount, groupAdminID)
+}
+
+func memberUsername(contribution *models.Contribution, member primitive.ObjectID) string {
+	if username := contribution.MemberUsernames[member]; username != "" {
+		return username
+	}
+	if member == contribution.GroupAdmin {
+		return contribution.AdminUsername
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxDelegationWindow is the longest an approver can hand their votes to
+// someone else for at a time.
+const maxDelegationWindow = 90 * 24 * time.Hour
+
+// DelegateApprovals lets delegation.DelegateID vote in the delegator's place
+// on payouts during the delegation's window, which starts now unless given.
+// A delegation limited to one group needs the delegator to belong to it.
+func DelegateApprovals(ctx context.Context, db *mongo.Database, notificationService *NotificationService, delegation *models.ApprovalDelegation) error {
+	now := time.Now()
+	if delegation.DelegateID == delegation.DelegatorID {
+		return errors.New("can't delegate approvals to yourself")
+	}
+	if _, err := repository.GetUserByID(db.Collection("users"), delegation.DelegateID); err != nil {
+		return errors.New("delegate not found")
+	}
+	if delegation.StartsAt.IsZero() {
+		delegation.StartsAt = now
+	}
+	if !delegation.EndsAt.After(delegation.StartsAt) || !delegation.EndsAt.After(now) {
+		return errors.New("delegation must end after it starts and in the future")
+	}
+	if delegation.EndsAt.Sub(delegation.StartsAt) > maxDelegationWindow {
+		return fmt.Errorf("delegation can't last more than %d days", int(maxDelegationWindow.Hours()/24))
+	}
+
+	group := "all your groups"
+	if !delegation.ContributionID.IsZero() {
+		contribution, err := repository.GetContributionByID(ctx, db, delegation.ContributionID)
+		if err != nil {
+			return err
+		}
+		if contribution.GroupAdmin != delegation.DelegatorID && !containsUser(contributionMembers(contribution), delegation.DelegatorID) {
+			return errors.New("only members of the group can delegate its approvals")
+		}
+		group = contribution.Name
+	}
+
+	delegation.ID = primitive.NilObjectID
+	delegation.RevokedAt = time.Time{}
+	if err := repository.CreateApprovalDelegation(ctx, db, delegation); err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  delegation.DelegateID,
+		Type:    "approvals_delegated",
+		Title:   "Approvals Delegated to You",
+		Message: fmt.Sprintf("You can approve payouts in place of another approver for %s until %s.", group, delegation.EndsAt.Format(time.RFC1123)),
+		Meta:    map[string]interface{}{"delegation_id": delegation.ID.Hex(), "delegator_id": delegation.DelegatorID.Hex(), "ends_at": delegation.EndsAt},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+func GetApprovalDelegations(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]*models.ApprovalDelegation, error) {
+	return repository.GetApprovalDelegationsByUser(ctx, db, userID)
+}
+
+func RevokeApprovalDelegation(ctx context.Context, db *mongo.Database, delegationID, delegatorID primitive.ObjectID) error {
+	return repository.RevokeApprovalDelegation(ctx, db, delegationID, delegatorID, time.Now())
+}
+
+// checkDelegatedVote makes sure delegateID may vote on an approval in its
+// approver's place: they hold a delegation for it that is in force and they
+// aren't the payout's recipient. Whether they have a vote of their own on it
+// is checked by checkSecondVote once votes on the payout are locked.
+func checkDelegatedVote(ctx context.Context, db *mongo.Database, approval *models.Approval, delegateID primitive.ObjectID) error {
+	delegations, err := repository.GetActiveApprovalDelegations(ctx, db, delegateID, time.Now())
+	if err != nil {
+		return err
+	}
+	delegated := false
+	for _, delegation := range delegations {
+		if delegation.DelegatorID == approval.ApproverID && (delegation.ContributionID.IsZero() || delegation.ContributionID == approval.ContributionID) {
+			delegated = true
+			break
+		}
+	}
+	if !delegated {
+		return errors.New("unauthorized to approve this payout")
+	}
+
+	transaction, err := repository.GetTransactionByID(ctx, db, approval.TransactionID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.New("transaction not found")
+		}
+		return err
+	}
+	recipient, err := repository.GetWalletByID(db, transaction.ToWallet)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if recipient != nil && recipient.OwnerID == delegateID {
+		return errors.New("unauthorized to approve your own payout")
+	}
+	return nil
+}
+
+// checkSecondVote stops a delegate voting on a payout they have a vote on
+// already, as an approver or another approver's delegate. It runs after
+// LockPendingTransaction so a vote can't slip in between.
+func checkSecondVote(sc mongo.SessionContext, db *mongo.Database, approval *models.Approval, delegateID primitive.ObjectID) error {
+	approvals, err := repository.GetApprovalsByTransaction(sc, db, approval.TransactionID)
+	if err != nil {
+		return err
+	}
+	for _, other := range approvals {
+		if other.ApproverID == delegateID || other.DecidedBy == delegateID {
+			return errors.New("unauthorized to vote twice on a payout")
+		}
+	}
+	return nil
+}
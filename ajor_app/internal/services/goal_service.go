@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrGoalLocked is returned when withdrawing from a goal before its target
+// date without choosing to break it.
+var ErrGoalLocked = errors.New("savings goal is locked until its target date")
+
+type GoalProgress struct {
+	*models.SavingsGoal
+	Saved           money.Money `json:"saved"`
+	Remaining       money.Money `json:"remaining"`
+	PercentComplete int         `json:"percent_complete"`
+	DaysLeft        int         `json:"days_left"`
+	Locked          bool        `json:"locked"`
+}
+
+// CreateGoal opens a savings goal with its own goal wallet.
+func CreateGoal(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, goal *models.SavingsGoal) error {
+	goal.Name = strings.TrimSpace(goal.Name)
+	if goal.Name == "" {
+		return errors.New("goal name is required")
+	}
+	if !goal.TargetAmount.IsPositive() {
+		return errors.New("target amount must be positive")
+	}
+	if !goal.TargetDate.After(time.Now()) {
+		return errors.New("target date must be in the future")
+	}
+	if goal.EarlyBreakPenaltyPercent < 0 || goal.EarlyBreakPenaltyPercent > 100 {
+		return errors.New("early break penalty must be between 0 and 100 percent")
+	}
+	if goal.AutoDebitAmount.IsNegative() {
+		return errors.New("auto-debit amount cannot be negative")
+	}
+	if goal.AutoDebitAmount.IsPositive() {
+		if !goal.AutoDebitAmount.SameCurrency(goal.TargetAmount) {
+			return errors.New("auto-debit amount must be in the goal's currency")
+		}
+		if goal.AutoDebitCycle != models.CycleDaily && goal.AutoDebitCycle != models.CycleWeekly && goal.AutoDebitCycle != models.CycleMonthly {
+			return errors.New("auto-debit cycle must be daily, weekly or monthly")
+		}
+		// The first debit is taken on the scheduler's next run
+		goal.NextDebitAt = time.Now()
+	} else {
+		goal.AutoDebitCycle = ""
+		goal.NextDebitAt = time.Time{}
+	}
+
+	wallet := &models.Wallet{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   userID,
+		Type:      models.WalletTypeGoal,
+		Balance:   money.New(0, goal.TargetAmount.Currency),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := repository.CreateWallet(db, wallet); err != nil {
+		return fmt.Errorf("failed to create wallet: %w", err)
+	}
+	goal.UserID = userID
+	goal.WalletID = wallet.ID
+	if err := repository.CreateGoal(ctx, db, goal); err != nil {
+		repository.DeleteWallet(db, wallet.ID)
+		return err
+	}
+	return nil
+}
+
+func getUserGoal(ctx context.Context, db *mongo.Database, goalID, userID primitive.ObjectID) (*models.SavingsGoal, error) {
+	goal, err := repository.GetGoalByID(ctx, db, goalID)
+	if err != nil {
+		return nil, errors.New("savings goal not found")
+	}
+	if goal.UserID != userID {
+		return nil, errors.New("unauthorized access to savings goal")
+	}
+	return goal, nil
+}
+
+// GetGoal returns one of the user's goals with its progress.
+func GetGoal(ctx context.Context, db *mongo.Database, goalID, userID primitive.ObjectID) (*GoalProgress, error) {
+	goal, err := getUserGoal(ctx, db, goalID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return goalProgress(ctx, db, goal)
+}
+
+// GetUserGoals returns every goal of the user with its progress, newest first.
+func GetUserGoals(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]*GoalProgress, error) {
+	goals, err := repository.GetGoalsByUser(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress := make([]*GoalProgress, 0, len(goals))
+	for _, goal := range goals {
+		p, err := goalProgress(ctx, db, goal)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+func goalProgress(ctx context.Context, db *mongo.Database, goal *models.SavingsGoal) (*GoalProgress, error) {
+	wallet, err := repository.GetContributionWalletByID(ctx, db, goal.WalletID)
+	if err != nil {
+		return nil, err
+	}
+	p := &GoalProgress{
+		SavingsGoal: goal,
+		Saved:       wallet.Balance,
+		Remaining:   money.New(0, goal.TargetAmount.Currency),
+		Locked:      goal.Status == models.GoalActive && time.Now().Before(goal.TargetDate),
+	}
+	if wallet.Balance.LessThan(goal.TargetAmount) {
+		p.Remaining = goal.TargetAmount.Sub(wallet.Balance)
+	}
+	p.PercentComplete = int(wallet.Balance.Kobo * 100 / goal.TargetAmount.Kobo)
+	if p.PercentComplete > 100 {
+		p.PercentComplete = 100
+	}
+	if p.Locked {
+		p.DaysLeft = int(time.Until(goal.TargetDate).Hours()/24) + 1
+	}
+	return p, nil
+}
+
+// FundGoal moves money from the user's wallet into an active goal.
+func FundGoal(ctx context.Context, db *mongo.Database, goalID, userID primitive.ObjectID, amount money.Money) error {
+	goal, err := getUserGoal(ctx, db, goalID, userID)
+	if err != nil {
+		return err
+	}
+	if goal.Status != models.GoalActive {
+		return repository.ErrGoalClosed
+	}
+	if !amount.IsPositive() || !amount.SameCurrency(goal.TargetAmount) {
+		return errors.New("amount must be positive and in the goal's currency")
+	}
+	return transferToGoal(ctx, db, goal, amount)
+}
+
+// transferToGoal moves money from the user's wallet into the goal, provided
+// the goal is still active when the transfer commits; it fails with
+// repository.ErrGoalClosed if the goal was withdrawn in the meantime.
+func transferToGoal(ctx context.Context, db *mongo.Database, goal *models.SavingsGoal, amount money.Money) error {
+	userWallet, err := repository.GetWalletByUserID(db, goal.UserID)
+	if err != nil {
+		return errors.New("user wallet not found")
+	}
+	transaction := &models.Transaction{
+		FromWallet:    userWallet.ID,
+		ToWallet:      goal.WalletID,
+		Amount:        amount,
+		Type:          models.TransactionGoal,
+		Date:          time.Now(),
+		PaymentMethod: models.PaymentWallet,
+	}
+	return RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if err := repository.LockActiveGoal(sc, db, goal.ID); err != nil {
+			return err
+		}
+		return executeTransfer(sc, db, transaction, true)
+	})
+}
+
+// WithdrawGoal closes a goal and pays its savings into the user's wallet.
+// Before the target date the goal is locked unless the user breaks it, which
+// the goal must allow and which forfeits the early-break penalty.
+func WithdrawGoal(ctx context.Context, db *mongo.Database, goalID, userID primitive.ObjectID, breakEarly bool) (money.Money, error) {
+	goal, err := getUserGoal(ctx, db, goalID, userID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if goal.Status != models.GoalActive {
+		return money.Money{}, repository.ErrGoalClosed
+	}
+	status := models.GoalCompleted
+	if time.Now().Before(goal.TargetDate) {
+		if !breakEarly {
+			return money.Money{}, ErrGoalLocked
+		}
+		if !goal.AllowEarlyBreak {
+			return money.Money{}, errors.New("savings goal can't be broken early")
+		}
+		status = models.GoalBroken
+	}
+	userWallet, err := repository.GetWalletByUserID(db, userID)
+	if err != nil {
+		return money.Money{}, errors.New("user wallet not found")
+	}
+
+	var paidOut money.Money
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if err := repository.CloseGoal(sc, db, goal.ID, status); err != nil {
+			return err
+		}
+		wallet, err := repository.GetContributionWalletByID(sc, db, goal.WalletID)
+		if err != nil {
+			return err
+		}
+		paidOut = wallet.Balance
+		if status == models.GoalBroken && goal.EarlyBreakPenaltyPercent > 0 {
+			penalty := money.New(wallet.Balance.Kobo*int64(goal.EarlyBreakPenaltyPercent)/100, wallet.Balance.Currency)
+			if penalty.IsPositive() {
+				fee := &models.Transaction{
+					FromWallet:    goal.WalletID,
+					Amount:        penalty,
+					Type:          models.TransactionFee,
+					Date:          time.Now(),
+					PaymentMethod: models.PaymentWallet,
+				}
+				if err := executeTransfer(sc, db, fee, true); err != nil {
+					return err
+				}
+				paidOut = paidOut.Sub(penalty)
+			}
+		}
+		if !paidOut.IsPositive() {
+			return nil
+		}
+		withdrawal := &models.Transaction{
+			FromWallet:    goal.WalletID,
+			ToWallet:      userWallet.ID,
+			Amount:        paidOut,
+			Type:          models.TransactionGoal,
+			Date:          time.Now(),
+			PaymentMethod: models.PaymentWallet,
+		}
+		return executeTransfer(sc, db, withdrawal, true)
+	})
+	return paidOut, err
+}
+
+// RunGoalAutoDebits takes the scheduled debit of every goal that is due. A
+// debit the wallet can't cover is skipped until the next one, and the user is
+// told either way.
+func RunGoalAutoDebits(ctx context.Context, db *mongo.Database, notificationService *NotificationService, now time.Time) error {
+	goals, err := repository.GetGoalsDueForAutoDebit(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	for _, goal := range goals {
+		if err := runGoalAutoDebit(ctx, db, notificationService, goal, now); err != nil {
+			log.Printf("Failed to auto-debit savings goal %s: %v", goal.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func runGoalAutoDebit(ctx context.Context, db *mongo.Database, notificationService *NotificationService, goal *models.SavingsGoal, now time.Time) error {
+	next := nextGoalDebit(goal.AutoDebitCycle, goal.NextDebitAt, now)
+	claimed, err := repository.ClaimGoalAutoDebit(ctx, db, goal.ID, goal.NextDebitAt, next)
+	if err != nil || !claimed {
+		return err
+	}
+	if now.After(goal.TargetDate) {
+		return nil
+	}
+	progress, err := goalProgress(ctx, db, goal)
+	if err != nil {
+		return err
+	}
+	amount := goal.AutoDebitAmount
+	if progress.Remaining.LessThan(amount) {
+		amount = progress.Remaining
+	}
+	if !amount.IsPositive() {
+		return nil
+	}
+
+	n := &models.Notification{
+		UserID:  goal.UserID,
+		Type:    "goal_auto_debit",
+		Title:   "Savings Goal Funded",
+		Message: fmt.Sprintf("%s was moved from your wallet to your savings goal: %s", amount, goal.Name),
+		Meta:    map[string]interface{}{"goal": goal.Name, "amount": amount},
+	}
+	if err := transferToGoal(ctx, db, goal, amount); err != nil {
+		if !errors.Is(err, repository.ErrInsufficientFunds) {
+			return err
+		}
+		n.Type = "goal_auto_debit_failed"
+		n.Title = "Savings Goal Debit Failed"
+		n.Message = fmt.Sprintf("Your wallet couldn't cover the %s scheduled for your savings goal: %s. We'll try again on %s.", amount, goal.Name, next.Format("2006-01-02"))
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// nextGoalDebit returns the first debit date after now, so debits missed
+// while the scheduler was down are not all taken at once.
+func nextGoalDebit(cycle models.ContributionCycle, due, now time.Time) time.Time {
+	next := due
+	for !next.After(now) {
+		switch cycle {
+		case models.CycleDaily:
+			next = next.AddDate(0, 0, 1)
+		case models.CycleWeekly:
+			next = next.AddDate(0, 0, 7)
+		default:
+			next = next.AddDate(0, 1, 0)
+		}
+	}
+	return next
+}
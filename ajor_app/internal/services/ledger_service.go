@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pendingEntryGracePeriod is how long a journal entry may stay pending before
+// recovery assumes the request that created it died mid-transfer.
+const pendingEntryGracePeriod = 5 * time.Minute
+
+type WalletReconciliation struct {
+	WalletID      primitive.ObjectID `json:"wallet_id"`
+	StoredBalance money.Money        `json:"stored_balance"`
+	LedgerBalance money.Money        `json:"ledger_balance"`
+	Difference    money.Money        `json:"difference"`
+	Balanced      bool               `json:"balanced"`
+}
+
+// journalEntryForTransaction builds the double-entry legs for a transaction.
+// Transactions without a source wallet are funded from outside the platform,
+// so they are balanced against the gateway clearing account. Fees are kept by
+// the platform.
+func journalEntryForTransaction(transaction *models.Transaction) *models.JournalEntry {
+	from := models.LedgerLeg{Account: models.AccountGatewayClearing, Debit: transaction.Amount}
+	if !transaction.FromWallet.IsZero() {
+		from = models.LedgerLeg{Account: models.AccountWallet, WalletID: transaction.FromWallet, Debit: transaction.Amount}
+	}
+	to := models.LedgerLeg{Account: models.AccountWallet, WalletID: transaction.ToWallet, Credit: transaction.Amount}
+	if transaction.Type == models.TransactionFee {
+		to = models.LedgerLeg{Account: models.AccountPlatformRevenue, Credit: transaction.Amount}
+	}
+	return &models.JournalEntry{
+		TransactionID: transaction.ID,
+		Description:   fmt.Sprintf("%s transaction", transaction.Type),
+		Legs:          []models.LedgerLeg{from, to},
+	}
+}
+
+// ReconcileWallet compares a wallet's stored balance with the sum of its postings.
+func ReconcileWallet(ctx context.Context, db *mongo.Database, walletID primitive.ObjectID) (*WalletReconciliation, error) {
+	wallet, err := repository.GetContributionWalletByID(ctx, db, walletID)
+	if err != nil {
+		return nil, fmt.Errorf("wallet not found: %v", err)
+	}
+	return reconcileWallet(ctx, db, wallet)
+}
+
+func reconcileWallet(ctx context.Context, db *mongo.Database, wallet *models.Wallet) (*WalletReconciliation, error) {
+	ledgerBalance, err := repository.GetWalletLedgerBalance(ctx, db, wallet)
+	if err != nil {
+		return nil, err
+	}
+	difference := wallet.Balance.Sub(ledgerBalance)
+	return &WalletReconciliation{
+		WalletID:      wallet.ID,
+		StoredBalance: wallet.Balance,
+		LedgerBalance: ledgerBalance,
+		Difference:    difference,
+		Balanced:      difference.IsZero(),
+	}, nil
+}
+
+// RecoverPendingJournalEntries finishes entries left pending by a crash and
+// settles the transactions they belong to.
+func RecoverPendingJournalEntries(ctx context.Context, db *mongo.Database) error {
+	entries, err := repository.GetStalePendingJournalEntries(ctx, db, pendingEntryGracePeriod)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := repository.ApplyJournalEntry(ctx, db, entry); err != nil {
+			log.Printf("Failed to recover journal entry %s: %v", entry.ID.Hex(), err)
+			continue
+		}
+		if !entry.TransactionID.IsZero() {
+			if err := repository.UpdateTransactionStatus(ctx, db, entry.TransactionID, models.StatusSuccess); err != nil {
+				log.Printf("Failed to settle transaction %s for journal entry %s: %v", entry.TransactionID.Hex(), entry.ID.Hex(), err)
+			}
+		}
+		log.Printf("Recovered journal entry %s", entry.ID.Hex())
+	}
+	return nil
+}
+
+// ReconcileAllWallets checks every wallet against the ledger. A wallet that
+// can't be checked is logged and skipped.
+func ReconcileAllWallets(ctx context.Context, db *mongo.Database) ([]*WalletReconciliation, error) {
+	wallets, err := repository.GetAllWallets(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var mismatches []*WalletReconciliation
+	for _, wallet := range wallets {
+		result, err := reconcileWallet(ctx, db, wallet)
+		if err != nil {
+			log.Printf("Failed to reconcile wallet %s: %v", wallet.ID.Hex(), err)
+			continue
+		}
+		if !result.Balanced {
+			mismatches = append(mismatches, result)
+		}
+	}
+	return mismatches, nil
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"log"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type NotificationService struct {
@@ -37,7 +40,7 @@ func (s *NotificationService) Delete(ctx context.Context, notificationID primiti
 }
 
 // Helper for common notification types
-func (s *NotificationService) CreateWalletFundedNotification(ctx context.Context, userID primitive.ObjectID, amount float64) error {
+func (s *NotificationService) CreateWalletFundedNotification(ctx context.Context, userID primitive.ObjectID, amount money.Money) error {
 	n := &models.Notification{
 		UserID:  userID,
 		Type:    "wallet_funded",
@@ -48,7 +51,7 @@ func (s *NotificationService) CreateWalletFundedNotification(ctx context.Context
 	return s.Create(ctx, n)
 }
 
-func (s *NotificationService) CreateGroupContributionNotification(ctx context.Context, userID primitive.ObjectID, groupName string, amount float64) error {
+func (s *NotificationService) CreateGroupContributionNotification(ctx context.Context, userID primitive.ObjectID, groupName string, amount money.Money) error {
 	n := &models.Notification{
 		UserID:  userID,
 		Type:    "group_contribution",
@@ -57,4 +60,21 @@ func (s *NotificationService) CreateGroupContributionNotification(ctx context.Co
 		Meta:    map[string]interface{}{ "group": groupName, "amount": amount },
 	}
 	return s.Create(ctx, n)
-}
\ No newline at end of file
+}
+
+// notifyAdmins sends every system admin a copy of n. Failures are logged, so
+// an alert never stops the work that raised it.
+func notifyAdmins(ctx context.Context, db *mongo.Database, notificationService *NotificationService, n models.Notification) {
+	adminIDs, err := repository.GetAdminUserIDs(ctx, db)
+	if err != nil {
+		log.Printf("Failed to look up admins to notify: %v", err)
+		return
+	}
+	for _, adminID := range adminIDs {
+		notification := n
+		notification.UserID = adminID
+		if err := notificationService.Create(ctx, &notification); err != nil {
+			log.Printf("Failed to notify admin %s: %v", adminID.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrPayoutOrderNotAssigned is returned when an admin-assigned group has no
+// locked order yet, so nobody can be picked to collect.
+var ErrPayoutOrderNotAssigned = errors.New("group admin has not assigned the payout order")
+
+func isValidPayoutOrder(strategy models.PayoutOrderStrategy) bool {
+	return strategy == models.PayoutOrderJoin || strategy == models.PayoutOrderRandom ||
+		strategy == models.PayoutOrderAdminAssigned || strategy == models.PayoutOrderBidding
+}
+
+// payoutOrder returns the group's strategy, treating groups created before
+// strategies existed as join order.
+func payoutOrder(contribution *models.Contribution) models.PayoutOrderStrategy {
+	if contribution.PayoutOrder == "" {
+		return models.PayoutOrderJoin
+	}
+	return contribution.PayoutOrder
+}
+
+// GetPayoutSchedule returns the locked schedule of the current round, or a
+// preview of what locking it now would produce. A random draw can't be
+// previewed, so its preview lists members in join order without positions,
+// with the commitment to the seed the draw will use.
+func GetPayoutSchedule(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) (*models.PayoutSchedule, error) {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if contribution.PayoutSchedule != nil {
+		return contribution.PayoutSchedule, nil
+	}
+
+	strategy := payoutOrder(contribution)
+	var order []primitive.ObjectID
+	switch strategy {
+	case models.PayoutOrderRandom, models.PayoutOrderAdminAssigned:
+		order = contributionMembers(contribution)
+	default:
+		order, _, err = buildPayoutOrder(contribution, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	schedule := newPayoutSchedule(contribution, strategy, order, "")
+	if strategy == models.PayoutOrderRandom {
+		if err := ensureDrawSeed(ctx, db, contribution); err != nil {
+			return nil, err
+		}
+		schedule.SeedCommitment = contribution.DrawCommitment
+	}
+	if strategy == models.PayoutOrderRandom || strategy == models.PayoutOrderAdminAssigned {
+		for i := range schedule.Slots {
+			schedule.Slots[i].Position = 0
+		}
+	}
+	return schedule, nil
+}
+
+// LockPayoutSchedule fixes the payout order of the current round. Only the
+// group admin can lock it, and for admin-assigned groups they must pass the
+// order, listing every member exactly once.
+func LockPayoutSchedule(ctx context.Context, db *mongo.Database, contributionID, groupAdminID primitive.ObjectID, assigned []primitive.ObjectID) (*models.PayoutSchedule, error) {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return nil, err
+	}
+	if contribution.GroupAdmin != groupAdminID {
+		return nil, errors.New("only group admin can lock the payout schedule")
+	}
+	if contribution.PayoutSchedule != nil {
+		return nil, repository.ErrPayoutScheduleLocked
+	}
+	return lockPayoutSchedule(ctx, db, contribution, groupAdminID, assigned)
+}
+
+func lockPayoutSchedule(ctx context.Context, db *mongo.Database, contribution *models.Contribution, lockedBy primitive.ObjectID, assigned []primitive.ObjectID) (*models.PayoutSchedule, error) {
+	if payoutOrder(contribution) == models.PayoutOrderRandom {
+		if err := ensureDrawSeed(ctx, db, contribution); err != nil {
+			return nil, err
+		}
+	}
+	order, seed, err := buildPayoutOrder(contribution, assigned)
+	if err != nil {
+		return nil, err
+	}
+	schedule := newPayoutSchedule(contribution, payoutOrder(contribution), order, seed)
+	if seed != "" {
+		schedule.SeedCommitment = contribution.DrawCommitment
+	}
+	schedule.Locked = true
+	schedule.LockedAt = time.Now()
+	schedule.LockedBy = lockedBy
+	if err := repository.LockPayoutSchedule(ctx, db, contribution.ID, schedule); err != nil {
+		return nil, err
+	}
+	contribution.PayoutSchedule = schedule
+	return schedule, nil
+}
+
+// PlacePayoutBid records what a member of a bidding group offers to give up
+// from their payout for an earlier slot. A new bid replaces the old one.
+func PlacePayoutBid(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID, bid money.Money) error {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return err
+	}
+	if payoutOrder(contribution) != models.PayoutOrderBidding {
+		return errors.New("group does not use bidding for the payout order")
+	}
+	if contribution.PayoutSchedule != nil {
+		return repository.ErrPayoutScheduleLocked
+	}
+	if !containsUser(contributionMembers(contribution), userID) {
+		return errors.New("user not in contribution")
+	}
+	if !bid.IsPositive() || !bid.SameCurrency(contribution.Amount) {
+		return errors.New("bid must be a positive amount in the group's currency")
+	}
+	// Members excused from a cycle later only lower what the bid keeps back
+	if limit := maxPayoutBid(contribution, len(contributionMembers(contribution))); limit.LessThan(bid) {
+		return fmt.Errorf("bid can't be more than the other members' contributions of %s", limit)
+	}
+	return repository.SetPayoutBid(ctx, db, contributionID, userID, bid)
+}
+
+// buildPayoutOrder orders the members for a new schedule. It returns the seed
+// used for a random draw, which is the one ensureDrawSeed committed to.
+func buildPayoutOrder(contribution *models.Contribution, assigned []primitive.ObjectID) ([]primitive.ObjectID, string, error) {
+	members := contributionMembers(contribution)
+	switch payoutOrder(contribution) {
+	case models.PayoutOrderRandom:
+		if contribution.DrawSeed == "" {
+			return nil, "", errors.New("random draw has no committed seed")
+		}
+		return drawOrder(members, contribution.DrawSeed), contribution.DrawSeed, nil
+	case models.PayoutOrderAdminAssigned:
+		if len(assigned) == 0 {
+			return nil, "", ErrPayoutOrderNotAssigned
+		}
+		if len(assigned) != len(members) {
+			return nil, "", errors.New("payout order must list every member exactly once")
+		}
+		seen := make(map[primitive.ObjectID]bool, len(assigned))
+		for _, member := range assigned {
+			if seen[member] || !containsUser(members, member) {
+				return nil, "", errors.New("payout order must list every member exactly once")
+			}
+			seen[member] = true
+		}
+		return assigned, "", nil
+	case models.PayoutOrderBidding:
+		// Highest bid first; members who bid the same or not at all keep
+		// their join order.
+		order := append([]primitive.ObjectID(nil), members...)
+		sort.SliceStable(order, func(i, j int) bool {
+			return contribution.PayoutBids[order[j]].LessThan(contribution.PayoutBids[order[i]])
+		})
+		return order, "", nil
+	default:
+		return members, "", nil
+	}
+}
+
+func newDrawSeed() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ensureDrawSeed fixes the seed of a random-draw group's next draw the first
+// time anyone can see the group's schedule, and publishes its SHA-256 so the
+// seed can't be swapped for a more convenient one when the schedule is
+// locked.
+func ensureDrawSeed(ctx context.Context, db *mongo.Database, contribution *models.Contribution) error {
+	if contribution.DrawSeed != "" {
+		return nil
+	}
+	seed, err := newDrawSeed()
+	if err != nil {
+		return err
+	}
+	seed, commitment, err := repository.SetDrawSeed(ctx, db, contribution.ID, seed, drawCommitment(seed))
+	if err != nil {
+		return err
+	}
+	contribution.DrawSeed = seed
+	contribution.DrawCommitment = commitment
+	return nil
+}
+
+func drawCommitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// drawOrder sorts members by SHA-256(seed + member ID hex), which anyone with
+// the published seed can recompute.
+func drawOrder(members []primitive.ObjectID, seed string) []primitive.ObjectID {
+	keys := make(map[primitive.ObjectID]string, len(members))
+	for _, member := range members {
+		sum := sha256.Sum256([]byte(seed + member.Hex()))
+		keys[member] = hex.EncodeToString(sum[:])
+	}
+	order := append([]primitive.ObjectID(nil), members...)
+	sort.Slice(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+	return order
+}
+
+func newPayoutSchedule(contribution *models.Contribution, strategy models.PayoutOrderStrategy, order []primitive.ObjectID, seed string) *models.PayoutSchedule {
+	schedule := &models.PayoutSchedule{Strategy: strategy, Seed: seed, Slots: make([]models.PayoutSlot, 0, len(order))}
+	for i, member := range order {
+		slot := models.PayoutSlot{
+			Position: i + 1,
+			MemberID: member,
+			Username: contribution.MemberUsernames[member],
+			Bid:      money.New(0, contribution.Amount.Currency),
+		}
+		if member == contribution.GroupAdmin && slot.Username == "" {
+			slot.Username = contribution.AdminUsername
+		}
+		if bid, ok := contribution.PayoutBids[member]; ok && strategy == models.PayoutOrderBidding {
+			slot.Bid = bid
+		}
+		schedule.Slots = append(schedule.Slots, slot)
+	}
+	return schedule
+}
+
+// nextCollector picks whose turn it is: the first member of the locked
+// schedule still waiting to collect, then anyone who joined after it was
+// locked, in join order.
+func nextCollector(contribution *models.Contribution) (primitive.ObjectID, models.PayoutSlot) {
+	if contribution.PayoutSchedule != nil {
+		for _, slot := range contribution.PayoutSchedule.Slots {
+			if containsUser(contribution.YetToCollectMembers, slot.MemberID) {
+				return slot.MemberID, slot
+			}
+		}
+	}
+	if len(contribution.YetToCollectMembers) == 0 {
+		return primitive.NilObjectID, models.PayoutSlot{}
+	}
+	member := contribution.YetToCollectMembers[0]
+	return member, models.PayoutSlot{MemberID: member, Bid: money.New(0, contribution.Amount.Currency)}
+}
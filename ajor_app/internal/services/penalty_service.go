@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type MemberArrears struct {
+	MemberID    primitive.ObjectID `json:"member_id"`
+	Username    string             `json:"username,omitempty"`
+	Outstanding money.Money        `json:"outstanding"`
+	Penalties   []*models.Penalty  `json:"penalties"`
+}
+
+// ChargeLatePenalty charges a member the group's late fee for a cycle, at most
+// once per cycle. If their wallet can't cover it, the penalty
+// is kept as arrears and collected later.
+func ChargeLatePenalty(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contribution *models.Contribution, userID primitive.ObjectID, cycle int) error {
+	if !contribution.PenaltyAmount.IsPositive() {
+		return nil
+	}
+	penalty := &models.Penalty{
+		ContributionID: contribution.ID,
+		UserID:         userID,
+		Cycle:          cycle,
+		Amount:         contribution.PenaltyAmount,
+	}
+	err := repository.CreatePenalty(ctx, db, penalty)
+	if errors.Is(err, repository.ErrPenaltyExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	paid, err := settlePenalty(ctx, db, contribution, penalty)
+	if err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  userID,
+		Type:    "late_contribution",
+		Title:   "Late Contribution",
+		Message: fmt.Sprintf("Late contribution for group %s. Penalty charged: %s", contribution.Name, penalty.Amount),
+		Meta:    map[string]interface{}{"penalty": penalty.Amount, "group": contribution.Name, "cycle": penalty.Cycle},
+	}
+	if !paid {
+		n.Type = "penalty_outstanding"
+		n.Title = "Penalty Owed"
+		n.Message = fmt.Sprintf("Your wallet couldn't cover the %s late penalty for group %s. It has been added to your arrears.", penalty.Amount, contribution.Name)
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// CollectArrears pays off a member's outstanding penalties for a group, oldest
+// first, for as long as their wallet can cover them.
+func CollectArrears(ctx context.Context, db *mongo.Database, contribution *models.Contribution, userID primitive.ObjectID) (money.Money, error) {
+	collected := money.New(0, contribution.PenaltyAmount.Currency)
+	penalties, err := repository.GetOutstandingPenalties(ctx, db, contribution.ID, userID)
+	if err != nil {
+		return collected, err
+	}
+	for _, penalty := range penalties {
+		paid, err := settlePenalty(ctx, db, contribution, penalty)
+		if err != nil || !paid {
+			return collected, err
+		}
+		collected = collected.Add(penalty.Amount)
+	}
+	return collected, nil
+}
+
+// settlePenalty moves a penalty from the member's wallet to the group wallet.
+// It reports false, without an error, if the wallet is short.
+func settlePenalty(ctx context.Context, db *mongo.Database, contribution *models.Contribution, penalty *models.Penalty) (bool, error) {
+	userWallet, err := repository.GetWalletByUserID(db, penalty.UserID)
+	if err != nil {
+		return false, errors.New("user wallet not found")
+	}
+	transaction := &models.Transaction{
+		FromWallet:     userWallet.ID,
+		ToWallet:       contribution.WalletID,
+		Amount:         penalty.Amount,
+		Type:           models.TransactionPenalty,
+		Date:           time.Now(),
+		PaymentMethod:  models.PaymentWallet,
+		ContributionID: contribution.ID,
+	}
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if err := executeTransfer(sc, db, transaction, true); err != nil {
+			return err
+		}
+		return repository.MarkPenaltyPaid(sc, db, penalty.ID, transaction.ID)
+	})
+	if errors.Is(err, repository.ErrInsufficientFunds) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetContributionArrears lists the members of a group who owe penalties.
+func GetContributionArrears(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) ([]*MemberArrears, error) {
+	contribution, err := GetContribution(ctx, db, contributionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	penalties, err := repository.GetOutstandingPenalties(ctx, db, contributionID, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	arrears := []*MemberArrears{}
+	byMember := make(map[primitive.ObjectID]*MemberArrears)
+	for _, penalty := range penalties {
+		member, ok := byMember[penalty.UserID]
+		if !ok {
+			member = &MemberArrears{
+				MemberID:    penalty.UserID,
+				Username:    contribution.MemberUsernames[penalty.UserID],
+				Outstanding: money.New(0, penalty.Amount.Currency),
+			}
+			byMember[penalty.UserID] = member
+			arrears = append(arrears, member)
+		}
+		member.Outstanding = member.Outstanding.Add(penalty.Amount)
+		member.Penalties = append(member.Penalties, penalty)
+	}
+	return arrears, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// chargeLookback is how far before a report's period charges are listed
+	// to match its transactions, which are dated after the charge they were
+	// for: when the payment was started, or when its webhook finally went
+	// through after retries.
+	chargeLookback = 6 * time.Hour
+
+	DefaultReconciliationReportLimit = 30
+	maxReconciliationReportLimit     = 366
+)
+
+// RunDailyReconciliation reconciles the previous UTC day and alerts system
+// admins if anything didn't match.
+func RunDailyReconciliation(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, now time.Time) error {
+	to := now.UTC().Truncate(24 * time.Hour)
+	from := to.Add(-24 * time.Hour)
+	report, err := ReconcileCharges(ctx, db, pg, from, to)
+	if err != nil {
+		return err
+	}
+	issues := len(report.Unmatched) + len(report.Mismatched)
+	log.Printf("Reconciled %s: %d charges, %d matched, %d unmatched, %d mismatched", from.Format("2006-01-02"), report.Charges, report.Matched, len(report.Unmatched), len(report.Mismatched))
+	if issues == 0 {
+		return nil
+	}
+	notifyAdmins(ctx, db, notificationService, models.Notification{
+		Type:    "reconciliation_issues",
+		Title:   "Reconciliation Issues",
+		Message: fmt.Sprintf("%d charges on %s didn't reconcile with the gateway.", issues, from.Format("2006-01-02")),
+		Meta: map[string]interface{}{
+			"report_id":  report.ID.Hex(),
+			"unmatched":  len(report.Unmatched),
+			"mismatched": len(report.Mismatched),
+		},
+	})
+	return nil
+}
+
+// ReconcileCharges matches the charges the gateway made from from up to to
+// with our funding transactions, by the gateway's ID for the charge or else
+// its TxRef, and stores the report, replacing any earlier one for the period.
+func ReconcileCharges(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, from, to time.Time) (*models.ReconciliationReport, error) {
+	charges, err := pg.ListCharges(ctx, from.Add(-chargeLookback), to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gateway charges: %w", err)
+	}
+	report := &models.ReconciliationReport{
+		From:          from,
+		To:            to,
+		Unmatched:     []models.ReconciliationItem{},
+		Mismatched:    []models.ReconciliationItem{},
+		ChargedTotal:  money.New(0, money.NGN),
+		CreditedTotal: money.New(0, money.NGN),
+		WalletTotal:   money.New(0, money.NGN),
+		CreatedAt:     time.Now(),
+	}
+
+	matched := make(map[primitive.ObjectID]bool)
+	for _, charge := range charges {
+		transaction, err := findChargeTransaction(ctx, db, charge)
+		if err != nil {
+			return nil, err
+		}
+		if transaction != nil {
+			matched[transaction.ID] = true
+		}
+		// Charges from before the period only stand in for its transactions
+		if charge.CreatedAt.Before(from) {
+			continue
+		}
+		report.Charges++
+		if charge.Status == payment.ChargeSuccessful && charge.Amount.SameCurrency(report.ChargedTotal) {
+			report.ChargedTotal = report.ChargedTotal.Add(charge.Amount)
+		}
+		issue := chargeIssue(charge, transaction)
+		switch {
+		case issue == models.ReconMissingTransaction:
+			report.Unmatched = append(report.Unmatched, reconciliationItem(issue, &charge, nil))
+		case issue != "":
+			report.Mismatched = append(report.Mismatched, reconciliationItem(issue, &charge, transaction))
+		case transaction != nil:
+			report.Matched++
+		}
+	}
+
+	transactions, err := repository.GetFundingTransactions(ctx, db, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions {
+		if transaction.Amount.SameCurrency(report.CreditedTotal) {
+			report.CreditedTotal = report.CreditedTotal.Add(transaction.Amount)
+		}
+		if !matched[transaction.ID] {
+			report.Unmatched = append(report.Unmatched, reconciliationItem(models.ReconMissingCharge, nil, transaction))
+		}
+	}
+
+	wallets, err := repository.GetAllWallets(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, wallet := range wallets {
+		if wallet.Balance.SameCurrency(report.WalletTotal) {
+			report.WalletTotal = report.WalletTotal.Add(wallet.Balance)
+		}
+	}
+	report.GatewayBalance, err = pg.GetBalance(ctx, money.NGN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gateway balance: %w", err)
+	}
+
+	if err := repository.SaveReconciliationReport(ctx, db, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// findChargeTransaction returns the funding transaction a charge was
+// recorded as, or nil if there is none. Inbound transfers are recorded under
+// the charge's ID, fundings under the reference they were started with.
+func findChargeTransaction(ctx context.Context, db *mongo.Database, charge payment.Charge) (*models.Transaction, error) {
+	transaction, err := repository.GetTransactionByGatewayReference(ctx, db, charge.ID)
+	if err == mongo.ErrNoDocuments && charge.TxRef != "" {
+		transaction, err = repository.GetTransactionByTxRef(ctx, db, charge.TxRef)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if transaction.Type != models.TransactionWallet || !transaction.FromWallet.IsZero() {
+		return nil, nil
+	}
+	return transaction, nil
+}
+
+// chargeIssue says what is wrong with a charge and the transaction it was
+// recorded as, if anything. Charges that didn't go through need no
+// transaction, and a transaction that wasn't credited needs no charge.
+func chargeIssue(charge payment.Charge, transaction *models.Transaction) models.ReconciliationIssue {
+	successful := charge.Status == payment.ChargeSuccessful
+	switch {
+	case transaction == nil:
+		if successful {
+			return models.ReconMissingTransaction
+		}
+	case successful != (transaction.Status == models.StatusSuccess):
+		return models.ReconStatusMismatch
+	case successful && !transaction.Amount.Equal(charge.Amount):
+		return models.ReconAmountMismatch
+	}
+	return ""
+}
+
+func reconciliationItem(issue models.ReconciliationIssue, charge *payment.Charge, transaction *models.Transaction) models.ReconciliationItem {
+	item := models.ReconciliationItem{Issue: issue}
+	if charge != nil {
+		amount := charge.Amount
+		item.TxRef = charge.TxRef
+		item.ChargeID = charge.ID
+		item.ChargeStatus = charge.Status
+		item.ChargeAmount = &amount
+	}
+	if transaction != nil {
+		amount := transaction.Amount
+		item.TxRef = transaction.TxRef
+		item.TransactionID = transaction.ID
+		item.WalletID = transaction.ToWallet
+		item.Status = transaction.Status
+		item.Amount = &amount
+	}
+	return item
+}
+
+// ListReconciliationReports returns the latest reports for admins.
+func ListReconciliationReports(ctx context.Context, db *mongo.Database, limit int) ([]*models.ReconciliationReport, error) {
+	if limit < 1 || limit > maxReconciliationReportLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxReconciliationReportLimit)
+	}
+	return repository.ListReconciliationReports(ctx, db, int64(limit))
+}
+
+func GetReconciliationReport(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.ReconciliationReport, error) {
+	report, err := repository.GetReconciliationReportByID(ctx, db, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("reconciliation report not found")
+	}
+	return report, err
+}
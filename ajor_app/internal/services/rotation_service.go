@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// rotationOutcome describes what closing a cycle did, so notifications can be
+// sent once the database transaction has committed.
+type rotationOutcome struct {
+	contribution *models.Contribution
+	unpaid       []primitive.ObjectID
+	collector    primitive.ObjectID
+	payout       *models.Transaction
+}
+
+// RotateContributions closes every group contribution cycle whose deadline has
+// passed. A failure on one group is logged and does not stop the others.
+func RotateContributions(ctx context.Context, db *mongo.Database, notificationService *NotificationService, now time.Time) error {
+	contributions, err := repository.GetContributionsDueForRotation(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	for _, contribution := range contributions {
+		if err := RotateContribution(ctx, db, notificationService, contribution.ID, now); err != nil {
+			log.Printf("Failed to rotate contribution %s: %v", contribution.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// RotateContribution closes the current cycle of a group contribution. If
+// every member has paid for the cycle or been excused from it, the next member
+// in the payout schedule gets a pending payout of the whole pot, the deadline
+// moves to the next cycle and one cycle is taken off CycleCount. Otherwise
+// the cycle stays open and the members who haven't paid are charged the late
+// penalty and reminded.
+func RotateContribution(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID primitive.ObjectID, now time.Time) error {
+	var outcome *rotationOutcome
+	err := RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		var err error
+		outcome, err = closeCycle(sc, db, contributionID, now)
+		return err
+	})
+	if errors.Is(err, repository.ErrCycleAlreadyAdvanced) {
+		return nil
+	}
+	if errors.Is(err, ErrPayoutOrderNotAssigned) {
+		contribution, getErr := repository.GetContributionByID(ctx, db, contributionID)
+		if getErr != nil {
+			return getErr
+		}
+		n := &models.Notification{
+			UserID:  contribution.GroupAdmin,
+			Type:    "payout_order_required",
+			Title:   "Assign the Payout Order",
+			Message: fmt.Sprintf("Cycle %d of %s has closed, but no one can be paid until you assign the payout order.", currentCycle(contribution), contribution.Name),
+			Meta:    map[string]interface{}{"group": contribution.Name},
+		}
+		return notificationService.Create(ctx, n)
+	}
+	if err != nil || outcome == nil {
+		return err
+	}
+
+	contribution := outcome.contribution
+	if len(outcome.unpaid) > 0 {
+		for _, member := range outcome.unpaid {
+			if err := ChargeLatePenalty(ctx, db, notificationService, contribution, member, currentCycle(contribution)); err != nil {
+				log.Printf("Failed to charge late penalty to user %s for contribution %s: %v", member.Hex(), contribution.ID.Hex(), err)
+			}
+		}
+		return notifyUnpaidMembers(ctx, notificationService, contribution, outcome.unpaid)
+	}
+
+	n := &models.Notification{
+		UserID:  outcome.collector,
+		Type:    "payout_scheduled",
+		Title:   "Your Turn to Collect",
+		Message: fmt.Sprintf("It's your turn to collect %s from group: %s. The payout is awaiting approval.", outcome.payout.Amount, contribution.Name),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": outcome.payout.Amount, "cycle": currentCycle(contribution)},
+	}
+	if err := notificationService.Create(ctx, n); err != nil {
+		return err
+	}
+	notifyApprovers(ctx, db, notificationService, outcome.payout.ID, primitive.NilObjectID, models.Notification{
+		Type:    "payout_approval_required",
+		Title:   "Payout Awaiting Approval",
+		Message: fmt.Sprintf("Cycle %d of %s has closed. Approve the payout of %s to this cycle's collector.", currentCycle(contribution), contribution.Name, outcome.payout.Amount),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": outcome.payout.Amount, "transaction_id": outcome.payout.ID.Hex()},
+	})
+	return nil
+}
+
+func closeCycle(sc mongo.SessionContext, db *mongo.Database, contributionID primitive.ObjectID, now time.Time) (*rotationOutcome, error) {
+	contribution, err := repository.GetContributionByID(sc, db, contributionID)
+	if err != nil {
+		return nil, err
+	}
+	if contribution.Type != models.TypeGroupContribution || contribution.CycleCount <= 0 || contribution.CollectionDeadline.After(now) {
+		return nil, nil
+	}
+	members := contributionMembers(contribution)
+	if len(members) == 0 {
+		return nil, nil
+	}
+	window, err := ensureCycleWindow(sc, db, contribution, currentCycle(contribution))
+	if err != nil {
+		return nil, err
+	}
+	// Members can still pay on time until the grace period is over
+	if window.GraceUntil.After(now) {
+		return nil, nil
+	}
+
+	wallets, err := repository.GetUserWalletsByOwners(sc, db, members)
+	if err != nil {
+		return nil, err
+	}
+	walletByOwner := make(map[primitive.ObjectID]primitive.ObjectID, len(wallets))
+	for _, wallet := range wallets {
+		walletByOwner[wallet.OwnerID] = wallet.ID
+	}
+
+	waived, err := waivedMembers(sc, db, contribution.ID, window.Number)
+	if err != nil {
+		return nil, err
+	}
+	unpaid, err := unpaidMembers(sc, db, contribution, members, walletByOwner, waived)
+	if err != nil {
+		return nil, err
+	}
+	if len(unpaid) > 0 {
+		return &rotationOutcome{contribution: contribution, unpaid: unpaid}, nil
+	}
+
+	// Everyone has collected once: start a new round. Admin-assigned groups
+	// keep their order; the other strategies draw up a fresh one.
+	if len(contribution.YetToCollectMembers) == 0 {
+		clearSchedule := payoutOrder(contribution) != models.PayoutOrderAdminAssigned
+		if err := repository.ResetContributionRotation(sc, db, contribution.ID, members, clearSchedule); err != nil {
+			return nil, err
+		}
+		contribution.YetToCollectMembers = members
+		contribution.AlreadyCollectedMembers = nil
+		if clearSchedule {
+			contribution.PayoutSchedule = nil
+			contribution.PayoutBids = nil
+			contribution.DrawSeed = ""
+			contribution.DrawCommitment = ""
+		}
+	}
+
+	// The first cycle to close fixes the order if the admin hasn't already
+	if contribution.PayoutSchedule == nil {
+		if _, err := lockPayoutSchedule(sc, db, contribution, primitive.NilObjectID, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	collector, slot := nextCollector(contribution)
+	collectorWallet, ok := walletByOwner[collector]
+	if !ok {
+		return nil, fmt.Errorf("collector %s has no wallet", collector.Hex())
+	}
+	pot, kept, share := cyclePot(contribution, members, waived, slot)
+	payout := &models.Transaction{
+		FromWallet:     contribution.WalletID,
+		ToWallet:       collectorWallet,
+		Amount:         pot,
+		BidKept:        kept,
+		BidShare:       share,
+		Type:           models.TransactionPayout,
+		PaymentMethod:  models.PaymentWallet,
+		ContributionID: contribution.ID,
+	}
+	if err := createPayoutRequest(sc, db, contribution, payout, collector); err != nil {
+		return nil, err
+	}
+	if err := repository.AdjustBidPool(sc, db, contribution.ID, kept.Sub(share)); err != nil {
+		return nil, err
+	}
+
+	// The turn is used up as soon as it is assigned, so a payout still waiting
+	// for approval can't be handed to the same member again next cycle.
+	if err := repository.MarkMemberCollected(sc, db, contribution.ID, collector); err != nil {
+		return nil, err
+	}
+	next, err := ensureCycleWindow(sc, db, contribution, window.Number+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.AdvanceContributionCycle(sc, db, contribution.ID, contribution.CollectionDeadline, next.Number, next.DueAt); err != nil {
+		return nil, err
+	}
+	if err := repository.DecrementCycleCount(sc, db, contribution.ID); err != nil {
+		return nil, err
+	}
+	return &rotationOutcome{contribution: contribution, collector: collector, payout: payout}, nil
+}
+
+// unpaidMembers lists the members who haven't paid for the current cycle and
+// weren't excused from it.
+func unpaidMembers(ctx context.Context, db *mongo.Database, contribution *models.Contribution, members []primitive.ObjectID, walletByOwner map[primitive.ObjectID]primitive.ObjectID, waived map[primitive.ObjectID]bool) ([]primitive.ObjectID, error) {
+	since := contribution.CycleStartedAt
+	if since.IsZero() {
+		since = contribution.CreatedAt
+	}
+	payers, err := repository.GetContributionPayerWallets(ctx, db, contribution.ID, currentCycle(contribution), since)
+	if err != nil {
+		return nil, err
+	}
+	paid := make(map[primitive.ObjectID]bool, len(payers))
+	for _, walletID := range payers {
+		paid[walletID] = true
+	}
+	var unpaid []primitive.ObjectID
+	for _, member := range members {
+		if waived[member] {
+			continue
+		}
+		if walletID, ok := walletByOwner[member]; !ok || !paid[walletID] {
+			unpaid = append(unpaid, member)
+		}
+	}
+	return unpaid, nil
+}
+
+// waivedMembers returns the members excused from paying for a cycle.
+func waivedMembers(ctx context.Context, db *mongo.Database, contributionID primitive.ObjectID, cycle int) (map[primitive.ObjectID]bool, error) {
+	records, err := repository.GetMemberCycles(ctx, db, contributionID, primitive.NilObjectID, cycle)
+	if err != nil {
+		return nil, err
+	}
+	waived := make(map[primitive.ObjectID]bool)
+	for _, record := range records {
+		if record.Status == models.MemberCycleWaived {
+			waived[record.UserID] = true
+		}
+	}
+	return waived, nil
+}
+
+func notifyUnpaidMembers(ctx context.Context, notificationService *NotificationService, contribution *models.Contribution, unpaid []primitive.ObjectID) error {
+	for _, member := range unpaid {
+		n := &models.Notification{
+			UserID:  member,
+			Type:    "contribution_overdue",
+			Title:   "Contribution Overdue",
+			Message: fmt.Sprintf("Your contribution of %s to group %s is overdue. The payout is on hold until everyone has paid.", contribution.Amount, contribution.Name),
+			Meta:    map[string]interface{}{"group": contribution.Name, "amount": contribution.Amount, "cycle": currentCycle(contribution)},
+		}
+		if err := notificationService.Create(ctx, n); err != nil {
+			return err
+		}
+	}
+	n := &models.Notification{
+		UserID:  contribution.GroupAdmin,
+		Type:    "cycle_blocked",
+		Title:   "Payout On Hold",
+		Message: fmt.Sprintf("%d member(s) of %s have not paid for cycle %d, so this cycle's payout is on hold.", len(unpaid), contribution.Name, currentCycle(contribution)),
+		Meta:    map[string]interface{}{"group": contribution.Name, "unpaid": len(unpaid)},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// contributionMembers lists every member once, those still waiting to collect
+// first.
+func contributionMembers(contribution *models.Contribution) []primitive.ObjectID {
+	members := make([]primitive.ObjectID, 0, len(contribution.YetToCollectMembers)+len(contribution.AlreadyCollectedMembers))
+	for _, list := range [][]primitive.ObjectID{contribution.YetToCollectMembers, contribution.AlreadyCollectedMembers} {
+		for _, member := range list {
+			if !containsUser(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+	return members
+}
+
+// cyclePot is what a cycle's collector is paid: the contributions of every
+// member not excused from the cycle, less the bid kept back for the collector's
+// slot, plus the share of the bid pool paid with it. The round's last
+// collector bid for nothing, so their bid isn't kept and they are paid the
+// whole pool instead. A bid keeps back at most what the other payers paid in,
+// however many were excused.
+func cyclePot(contribution *models.Contribution, members []primitive.ObjectID, waived map[primitive.ObjectID]bool, slot models.PayoutSlot) (pot, kept, share money.Money) {
+	payers := len(members) - len(waived)
+	kept = money.New(0, contribution.Amount.Currency)
+	share = kept
+	switch {
+	case len(contribution.YetToCollectMembers) <= 1:
+		if !contribution.BidPool.IsZero() {
+			share = contribution.BidPool
+		}
+	case slot.Bid.IsPositive():
+		kept = slot.Bid
+		if limit := maxPayoutBid(contribution, payers); limit.LessThan(kept) {
+			kept = limit
+		}
+	}
+	return contribution.Amount.Times(int64(payers)).Sub(kept).Add(share), kept, share
+}
+
+// maxPayoutBid is the most a bid can keep back from a cycle that payers
+// members paid into: everything but the collector's own contribution.
+func maxPayoutBid(contribution *models.Contribution, payers int) money.Money {
+	if payers < 1 {
+		payers = 1
+	}
+	return contribution.Amount.Times(int64(payers - 1))
+}
+
+// currentCycle numbers cycles from 1. Contributions created before cycles were
+// tracked are on their first.
+func currentCycle(contribution *models.Contribution) int {
+	if contribution.CurrentCycle < 1 {
+		return 1
+	}
+	return contribution.CurrentCycle
+}
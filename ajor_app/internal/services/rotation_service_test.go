@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCyclePot(t *testing.T) {
+	a, b, c, d := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	members := []primitive.ObjectID{a, b, c, d}
+	tests := []struct {
+		name         string
+		yetToCollect []primitive.ObjectID
+		waived       []primitive.ObjectID
+		bid          int64
+		pool         int64
+		pot          int64
+		kept         int64
+		share        int64
+	}{
+		{name: "no bid", yetToCollect: members, pot: 400},
+		{name: "bid kept back", yetToCollect: members, bid: 150, pot: 250, kept: 150},
+		{name: "bid of everyone else's contributions", yetToCollect: members, bid: 300, pot: 100, kept: 300},
+		{name: "waivers lower what the bid keeps", yetToCollect: members, waived: []primitive.ObjectID{c, d}, bid: 300, pot: 100, kept: 100},
+		{name: "every other payer excused", yetToCollect: members, waived: []primitive.ObjectID{b, c, d}, bid: 300, pot: 100},
+		{name: "pool isn't paid before the last cycle", yetToCollect: members[1:], bid: 50, pool: 200, pot: 350, kept: 50},
+		{name: "last collector gets the pool", yetToCollect: members[3:], bid: 50, pool: 200, pot: 600, share: 200},
+		{name: "last collector of a requeued round", yetToCollect: members[3:], pool: -100, pot: 300, share: -100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contribution := &models.Contribution{
+				Amount:              money.FromKobo(100),
+				YetToCollectMembers: tt.yetToCollect,
+			}
+			if tt.pool != 0 {
+				contribution.BidPool = money.FromKobo(tt.pool)
+			}
+			waived := make(map[primitive.ObjectID]bool)
+			for _, member := range tt.waived {
+				waived[member] = true
+			}
+			pot, kept, share := cyclePot(contribution, members, waived, models.PayoutSlot{Bid: money.FromKobo(tt.bid)})
+			if pot.Kobo != tt.pot || kept.Kobo != tt.kept || share.Kobo != tt.share {
+				t.Errorf("got pot %d, kept %d, share %d; want %d, %d, %d", pot.Kobo, kept.Kobo, share.Kobo, tt.pot, tt.kept, tt.share)
+			}
+		})
+	}
+}
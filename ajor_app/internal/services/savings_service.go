@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// savingsSettlement describes a closed daily-savings month, so notifications
+// can be sent once the database transaction has committed.
+type savingsSettlement struct {
+	contribution *models.Contribution
+	month        int
+	fee          money.Money
+	paidOut      money.Money
+}
+
+// AssignCollector lets a saver pick the esusu collector who records their
+// daily deposits.
+func AssignCollector(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, saverID, collectorID primitive.ObjectID) error {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return err
+	}
+	if contribution.Type != models.TypeDailySavings {
+		return errors.New("only daily savings have a collector")
+	}
+	if contribution.GroupAdmin != saverID {
+		return errors.New("only the saver can assign a collector")
+	}
+	if err := validateCollector(db, saverID, collectorID); err != nil {
+		return err
+	}
+	if err := repository.SetContributionCollector(ctx, db, contributionID, collectorID); err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  collectorID,
+		Type:    "collector_assigned",
+		Title:   "New Saver",
+		Message: fmt.Sprintf("You are now the collector for %s's daily savings: %s", contribution.AdminUsername, contribution.Name),
+		Meta:    map[string]interface{}{"group": contribution.Name, "daily_amount": contribution.Amount},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+func validateCollector(db *mongo.Database, saverID, collectorID primitive.ObjectID) error {
+	if collectorID == saverID {
+		return errors.New("saver can't be their own collector")
+	}
+	if _, err := repository.GetUserByID(db.Collection("users"), collectorID); err != nil {
+		return errors.New("collector not found")
+	}
+	if _, err := repository.GetWalletByUserID(db, collectorID); err != nil {
+		return errors.New("collector wallet not found")
+	}
+	return nil
+}
+
+// RecordDeposit records a saver's deposit. Only their collector can record
+// one, and it must cover a whole number of days. A cash deposit is moved from
+// the collector's wallet, since the collector now holds the cash; any other
+// deposit is taken from the saver's wallet, and so can't cover more than the
+// days of the month so far that no deposit has covered yet.
+func RecordDeposit(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, collectorID primitive.ObjectID, amount money.Money, paymentMethod models.PaymentMethod) error {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return err
+	}
+	if contribution.Type != models.TypeDailySavings {
+		return errors.New("deposits can only be recorded for daily savings")
+	}
+	if contribution.CollectorID.IsZero() || contribution.CollectorID != collectorID {
+		return errors.New("only the saver's collector can record deposits")
+	}
+	if !amount.IsPositive() || !amount.SameCurrency(contribution.Amount) || amount.Kobo%contribution.Amount.Kobo != 0 {
+		return fmt.Errorf("deposit must be a multiple of the daily amount of %s", contribution.Amount)
+	}
+	days := amount.Kobo / contribution.Amount.Kobo
+
+	payer := contribution.GroupAdmin
+	if paymentMethod == models.PaymentCash {
+		payer = collectorID
+	} else {
+		paymentMethod = models.PaymentWallet
+	}
+	payerWallet, err := repository.GetWalletByUserID(db, payer)
+	if err != nil {
+		return errors.New("payer wallet not found")
+	}
+
+	now := time.Now()
+	window, err := EnsureCycleSchedule(ctx, db, contribution, now)
+	if err != nil {
+		return err
+	}
+	transaction := &models.Transaction{
+		FromWallet:     payerWallet.ID,
+		ToWallet:       contribution.WalletID,
+		Amount:         amount,
+		Type:           models.TransactionDeposit,
+		Date:           now,
+		PaymentMethod:  paymentMethod,
+		ContributionID: contributionID,
+		Cycle:          window.Number,
+	}
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if paymentMethod != models.PaymentCash {
+			// Deposits to the same savings are checked one at a time
+			if err := repository.LockContribution(sc, db, contributionID); err != nil {
+				return err
+			}
+			due, err := savingsDaysDue(sc, db, contribution, window, now)
+			if err != nil {
+				return err
+			}
+			if days > due {
+				return fmt.Errorf("a wallet deposit can only cover the %d day(s) due so far", due)
+			}
+		}
+		return executeTransfer(sc, db, transaction, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	n := &models.Notification{
+		UserID:  contribution.GroupAdmin,
+		Type:    "savings_deposit",
+		Title:   "Deposit Recorded",
+		Message: fmt.Sprintf("Your collector recorded a %s deposit of %s (%d day(s)) to %s", paymentMethod, amount, days, contribution.Name),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": amount, "days": days, "transaction_id": transaction.ID.Hex()},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// savingsDaysDue counts the days of the month up to and including now that
+// the month's deposits haven't covered yet.
+func savingsDaysDue(ctx context.Context, db *mongo.Database, contribution *models.Contribution, window *models.CycleWindow, now time.Time) (int64, error) {
+	deposits, err := repository.GetContributionCycleTransactions(ctx, db, contribution.ID, models.TransactionDeposit, window.Number)
+	if err != nil {
+		return 0, err
+	}
+	due := int64(now.Sub(window.OpensAt)/(24*time.Hour)) + 1
+	for _, deposit := range deposits {
+		due -= deposit.Amount.Kobo / contribution.Amount.Kobo
+	}
+	if due < 0 {
+		return 0, nil
+	}
+	return due, nil
+}
+
+// SettleDailySavings settles every daily-savings month that has ended. A
+// failure on one saver is logged and does not stop the others.
+func SettleDailySavings(ctx context.Context, db *mongo.Database, notificationService *NotificationService, now time.Time) error {
+	contributions, err := repository.GetDailySavingsDueForSettlement(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	for _, contribution := range contributions {
+		if err := SettleSavingsMonth(ctx, db, notificationService, contribution.ID, now); err != nil {
+			log.Printf("Failed to settle daily savings %s: %v", contribution.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// SettleSavingsMonth closes the current month of a daily savings. The
+// collector keeps one day's deposit as their fee and the rest of the month's
+// deposits are paid back to the saver's wallet.
+func SettleSavingsMonth(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID primitive.ObjectID, now time.Time) error {
+	var settlement *savingsSettlement
+	err := RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		var err error
+		settlement, err = settleSavingsMonth(sc, db, contributionID, now)
+		return err
+	})
+	if errors.Is(err, repository.ErrCycleAlreadyAdvanced) {
+		return nil
+	}
+	if err != nil || settlement == nil || !settlement.paidOut.Add(settlement.fee).IsPositive() {
+		return err
+	}
+
+	contribution := settlement.contribution
+	n := &models.Notification{
+		UserID:  contribution.GroupAdmin,
+		Type:    "savings_settled",
+		Title:   "Savings Paid Out",
+		Message: fmt.Sprintf("%s from month %d of %s has been paid to your wallet after a collector fee of %s.", settlement.paidOut, settlement.month, contribution.Name, settlement.fee),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": settlement.paidOut, "fee": settlement.fee},
+	}
+	if err := notificationService.Create(ctx, n); err != nil {
+		return err
+	}
+	if !settlement.fee.IsPositive() {
+		return nil
+	}
+	n = &models.Notification{
+		UserID:  contribution.CollectorID,
+		Type:    "collector_fee",
+		Title:   "Collector Fee Paid",
+		Message: fmt.Sprintf("Your fee of %s for collecting %s has been paid to your wallet.", settlement.fee, contribution.Name),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": settlement.fee},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+func settleSavingsMonth(sc mongo.SessionContext, db *mongo.Database, contributionID primitive.ObjectID, now time.Time) (*savingsSettlement, error) {
+	contribution, err := repository.GetContributionByID(sc, db, contributionID)
+	if err != nil {
+		return nil, err
+	}
+	if contribution.Type != models.TypeDailySavings || contribution.CollectionDeadline.After(now) {
+		return nil, nil
+	}
+	window, err := ensureCycleWindow(sc, db, contribution, currentCycle(contribution))
+	if err != nil {
+		return nil, err
+	}
+
+	deposits, err := repository.GetContributionCycleTransactions(sc, db, contribution.ID, models.TransactionDeposit, window.Number)
+	if err != nil {
+		return nil, err
+	}
+	total := money.New(0, contribution.Amount.Currency)
+	for _, deposit := range deposits {
+		total = total.Add(deposit.Amount)
+	}
+
+	settlement := &savingsSettlement{
+		contribution: contribution,
+		month:        window.Number,
+		fee:          money.New(0, total.Currency),
+		paidOut:      total,
+	}
+	// The customary fee is one day's deposit a month
+	if !contribution.CollectorID.IsZero() && total.IsPositive() {
+		settlement.fee = contribution.Amount
+		if total.LessThan(settlement.fee) {
+			settlement.fee = total
+		}
+		settlement.paidOut = total.Sub(settlement.fee)
+		if err := payFromSavings(sc, db, contribution, contribution.CollectorID, settlement.fee, models.TransactionCollectorFee, window.Number); err != nil {
+			return nil, err
+		}
+	}
+	if settlement.paidOut.IsPositive() {
+		if err := payFromSavings(sc, db, contribution, contribution.GroupAdmin, settlement.paidOut, models.TransactionSettlement, window.Number); err != nil {
+			return nil, err
+		}
+	}
+
+	next, err := ensureCycleWindow(sc, db, contribution, window.Number+1)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.AdvanceContributionCycle(sc, db, contribution.ID, contribution.CollectionDeadline, next.Number, next.DueAt); err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+func payFromSavings(sc mongo.SessionContext, db *mongo.Database, contribution *models.Contribution, userID primitive.ObjectID, amount money.Money, transactionType models.TransactionType, month int) error {
+	wallet, err := repository.GetWalletByUserID(db, userID)
+	if err != nil {
+		return fmt.Errorf("wallet of user %s not found", userID.Hex())
+	}
+	transaction := &models.Transaction{
+		FromWallet:     contribution.WalletID,
+		ToWallet:       wallet.ID,
+		Amount:         amount,
+		Type:           transactionType,
+		Date:           time.Now(),
+		PaymentMethod:  models.PaymentWallet,
+		ContributionID: contribution.ID,
+		Cycle:          month,
+	}
+	return executeTransfer(sc, db, transaction, true)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultStandingOrderRetries = 3
+	maxStandingOrderRetries     = 10
+	// standingOrderRetryInterval is how long to wait after a failed debit
+	// before trying again.
+	standingOrderRetryInterval = 6 * time.Hour
+	// standingOrderLease keeps other runs off an order while it is debited.
+	standingOrderLease = 15 * time.Minute
+)
+
+// SetStandingOrder turns a member's auto-debit for a group contribution on or
+// off. The first debit is taken on the due date of the earliest cycle they
+// haven't paid.
+func SetStandingOrder(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID, active bool, maxRetries int) (*models.StandingOrder, error) {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return nil, err
+	}
+	if contribution.Type != models.TypeGroupContribution {
+		return nil, errors.New("auto-debit is only available for group contributions")
+	}
+	if !containsUser(contributionMembers(contribution), userID) {
+		return nil, errors.New("user not in contribution")
+	}
+	if maxRetries < 0 || maxRetries > maxStandingOrderRetries {
+		return nil, fmt.Errorf("max retries must be between 0 and %d", maxStandingOrderRetries)
+	}
+	order := &models.StandingOrder{
+		ContributionID: contributionID,
+		UserID:         userID,
+		Active:         active,
+		MaxRetries:     maxRetries,
+	}
+	if active {
+		order.NextAttemptAt, err = nextStandingOrderAttempt(ctx, db, contribution, userID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repository.SaveStandingOrder(ctx, db, order)
+}
+
+func GetStandingOrder(ctx context.Context, db *mongo.Database, contributionID, userID primitive.ObjectID) (*models.StandingOrder, error) {
+	if _, err := GetContribution(ctx, db, contributionID, userID); err != nil {
+		return nil, err
+	}
+	order, err := repository.GetStandingOrder(ctx, db, contributionID, userID)
+	if err == mongo.ErrNoDocuments {
+		return &models.StandingOrder{ContributionID: contributionID, UserID: userID, MaxRetries: DefaultStandingOrderRetries}, nil
+	}
+	return order, err
+}
+
+// RunStandingOrders debits every standing order that is due. A failure on one
+// order is logged and does not stop the others.
+func RunStandingOrders(ctx context.Context, db *mongo.Database, notificationService *NotificationService, now time.Time) error {
+	orders, err := repository.GetDueStandingOrders(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if err := runStandingOrder(ctx, db, notificationService, order, now); err != nil {
+			log.Printf("Failed to run standing order %s: %v", order.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// runStandingOrder pays the member's contribution the same way as paying by
+// hand. After a failed debit it is retried until MaxRetries is used up; then
+// the order waits for the next cycle's due date.
+func runStandingOrder(ctx context.Context, db *mongo.Database, notificationService *NotificationService, order *models.StandingOrder, now time.Time) error {
+	claimed, err := repository.ClaimStandingOrder(ctx, db, order.ID, order.NextAttemptAt, now.Add(standingOrderLease))
+	if err != nil || !claimed {
+		return err
+	}
+	contribution, err := repository.GetContributionByID(ctx, db, order.ContributionID)
+	if err != nil {
+		return err
+	}
+	// The member has left the group since the order was set up
+	if !containsUser(contributionMembers(contribution), order.UserID) {
+		return repository.DeactivateStandingOrder(ctx, db, order.ContributionID, order.UserID)
+	}
+
+	_, window, debitErr := recordContribution(ctx, db, notificationService, contribution.ID, order.UserID, contribution.Amount, models.PaymentWallet)
+	if debitErr == nil || errors.Is(debitErr, ErrCycleAlreadyPaid) {
+		next, err := nextStandingOrderAttempt(ctx, db, contribution, order.UserID, now)
+		if err != nil {
+			return err
+		}
+		if err := repository.ScheduleStandingOrder(ctx, db, order.ID, 0, next, ""); err != nil {
+			return err
+		}
+		if debitErr != nil {
+			// Paid by hand since the order was scheduled
+			return nil
+		}
+		n := &models.Notification{
+			UserID:  order.UserID,
+			Type:    "auto_debit_success",
+			Title:   "Contribution Auto-Debited",
+			Message: fmt.Sprintf("%s was debited from your wallet for cycle %d of group %s.", contribution.Amount, window.Number, contribution.Name),
+			Meta:    map[string]interface{}{"group": contribution.Name, "amount": contribution.Amount, "cycle": window.Number},
+		}
+		return notificationService.Create(ctx, n)
+	}
+
+	log.Printf("Auto-debit of standing order %s failed: %v", order.ID.Hex(), debitErr)
+	reason := "an error occurred"
+	if errors.Is(debitErr, repository.ErrInsufficientFunds) {
+		reason = "your wallet balance was too low"
+	}
+	attempts := order.Attempts + 1
+	next := now.Add(standingOrderRetryInterval)
+	message := fmt.Sprintf("We couldn't debit %s for group %s because %s. We'll try again at %s.", contribution.Amount, contribution.Name, reason, next.Format("2006-01-02 15:04"))
+	if attempts > order.MaxRetries {
+		attempts = 0
+		next, err = nextDueDate(ctx, db, contribution, now)
+		if err != nil {
+			return err
+		}
+		message = fmt.Sprintf("We couldn't debit %s for group %s because %s, and have stopped retrying. Please pay this cycle yourself; auto-debit resumes on %s.", contribution.Amount, contribution.Name, reason, next.Format("2006-01-02"))
+	}
+	if err := repository.ScheduleStandingOrder(ctx, db, order.ID, attempts, next, debitErr.Error()); err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  order.UserID,
+		Type:    "auto_debit_failed",
+		Title:   "Auto-Debit Failed",
+		Message: message,
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": contribution.Amount, "next_attempt_at": next},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// nextStandingOrderAttempt returns the due date of the earliest cycle the
+// member hasn't paid, or of the next cycle if they are up to date. A due date
+// that has passed means now.
+func nextStandingOrderAttempt(ctx context.Context, db *mongo.Database, contribution *models.Contribution, userID primitive.ObjectID, now time.Time) (time.Time, error) {
+	userWallet, err := repository.GetWalletByUserID(db, userID)
+	if err != nil {
+		return time.Time{}, errors.New("user wallet not found")
+	}
+	window, err := attributeContributionCycle(ctx, db, contribution, userID, userWallet.ID, now)
+	if errors.Is(err, ErrCycleAlreadyPaid) {
+		return nextDueDate(ctx, db, contribution, now)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if due := dueDate(window); due.After(now) {
+		return due, nil
+	}
+	return now, nil
+}
+
+// nextDueDate returns the first cycle due date after now.
+func nextDueDate(ctx context.Context, db *mongo.Database, contribution *models.Contribution, now time.Time) (time.Time, error) {
+	open, err := EnsureCycleSchedule(ctx, db, contribution, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if due := dueDate(open); due.After(now) {
+		return due, nil
+	}
+	next, err := ensureCycleWindow(ctx, db, contribution, open.Number+1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return dueDate(next), nil
+}
+
+// dueDate is the start of the day a cycle is due, when its debit is taken.
+func dueDate(window *models.CycleWindow) time.Time {
+	y, m, d := window.DueAt.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, window.DueAt.Location())
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// sweepGrace leaves fundings and approvals alone while they are new, so
+	// webhooks and requests still in flight can finish.
+	sweepGrace = 15 * time.Minute
+	// DefaultPendingFundingTTL is how long a wallet funding may wait for its
+	// payment before it is abandoned.
+	DefaultPendingFundingTTL = 24 * time.Hour
+	// DefaultPayoutApprovalTTL is how long an approver has to vote on a
+	// payout before their approval is escalated, and again after that before
+	// it expires.
+	DefaultPayoutApprovalTTL = 72 * time.Hour
+)
+
+// SweepStaleTransactions settles wallet fundings the gateway has finished
+// with but whose webhook never came, fails those still unpaid after
+// fundingTTL, cancels payout approvals that can no longer be acted on, and
+// escalates or expires those not acted on within approvalTTL. A failure on
+// one item is logged and does not stop the others.
+func SweepStaleTransactions(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, now time.Time, fundingTTL, approvalTTL time.Duration) error {
+	fundings, err := repository.GetPendingFundings(ctx, db, now.Add(-sweepGrace))
+	if err != nil {
+		return err
+	}
+	for _, transaction := range fundings {
+		if err := sweepFunding(ctx, db, pg, notificationService, transaction, now, fundingTTL); err != nil {
+			log.Printf("Failed to sweep funding %s: %v", transaction.ID.Hex(), err)
+		}
+	}
+
+	approvals, err := repository.GetPendingApprovalsCreatedBefore(ctx, db, now.Add(-sweepGrace))
+	if err != nil {
+		return err
+	}
+	for _, approval := range approvals {
+		if err := sweepApproval(ctx, db, notificationService, approval); err != nil {
+			log.Printf("Failed to sweep approval %s: %v", approval.ID.Hex(), err)
+		}
+	}
+
+	overdue, err := repository.GetOverdueApprovals(ctx, db, now.Add(-approvalTTL))
+	if err != nil {
+		return err
+	}
+	for _, approval := range overdue {
+		if err := sweepOverdueApproval(ctx, db, notificationService, approval, now); err != nil {
+			log.Printf("Failed to sweep overdue approval %s: %v", approval.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// sweepFunding asks the gateway about a pending funding. A paid one is
+// credited as its webhook would have; one the gateway failed, or that is
+// still unpaid after fundingTTL, is failed. While the gateway is unreachable
+// nothing is failed, since the customer may have paid.
+func sweepFunding(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, transaction *models.Transaction, now time.Time, fundingTTL time.Duration) error {
+	expired := now.Sub(transaction.CreatedAt) >= fundingTTL
+	// Fundings started before gateway references were recorded can only
+	// expire
+	if transaction.GatewayReference != "" {
+		verified, err := pg.VerifyTransaction(ctx, transaction.GatewayReference)
+		switch {
+		case err != nil && (!expired || errors.Is(err, payment.ErrProviderUnavailable)):
+			return err
+		case err != nil:
+			log.Printf("Expiring funding %s the gateway can't verify: %v", transaction.TxRef, err)
+		case verified.Status == payment.ChargeSuccessful:
+			_, err := creditFunding(ctx, db, pg, notificationService, transaction, inboundCharge{
+				VerifyID: transaction.GatewayReference,
+				TxRef:    transaction.TxRef,
+				Amount:   verified.Amount,
+			})
+			return err
+		case verified.Status == payment.ChargeFailed:
+			return failFunding(ctx, db, notificationService, transaction, "was declined by the payment provider")
+		}
+	}
+	if !expired {
+		return nil
+	}
+	return failFunding(ctx, db, notificationService, transaction, "was not paid in time")
+}
+
+func failFunding(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, reason string) error {
+	err := repository.SettlePendingTransaction(ctx, db, transaction.ID, models.StatusFailed)
+	if errors.Is(err, repository.ErrTransactionNotPending) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Funding %s failed: it %s", transaction.TxRef, reason)
+	wallet, err := repository.GetWalletByID(db, transaction.ToWallet)
+	if err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  wallet.OwnerID,
+		Type:    "funding_failed",
+		Title:   "Wallet Funding Failed",
+		Message: fmt.Sprintf("Your wallet funding of %s %s. Nothing was credited; please try again.", transaction.Amount, reason),
+		Meta:    map[string]interface{}{"amount": transaction.Amount, "reference": transaction.TxRef},
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// sweepApproval cancels a pending payout approval that can no longer be
+// acted on. If the payout is already settled or gone only the approval is
+// cancelled; if the group or the recipient's wallet is gone the pending payout
+// is failed with its whole approval set. A missing approver only fails the
+// payout if the rest of the set can no longer reach its threshold. No money
+// has moved either way; a failed payout's recipient is requeued as
+// cancelPayout does, and told.
+func sweepApproval(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approval *models.Approval) error {
+	transaction, err := repository.GetTransactionByID(ctx, db, approval.TransactionID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	approverExists := true
+	var reason string
+	switch {
+	case transaction == nil:
+		reason = "the payout no longer exists"
+	case transaction.Status != models.StatusPending:
+		reason = fmt.Sprintf("the payout is already %s", transaction.Status)
+	default:
+		reason, approverExists, err = payoutBlocker(ctx, db, approval, transaction)
+		if err != nil || reason == "" {
+			return err
+		}
+	}
+	blocked := transaction != nil && transaction.Status == models.StatusPending
+	var failPayout bool
+	var requeue models.RequeuePosition
+
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		failPayout = blocked
+		if err := repository.CancelApproval(sc, db, approval.ID, reason); err != nil {
+			return err
+		}
+		if !blocked {
+			return nil
+		}
+		approvals, err := repository.GetApprovalsByTransaction(sc, db, transaction.ID)
+		if err != nil {
+			return err
+		}
+		// The rest of the approval set may still reach the threshold
+		// without a missing approver
+		if !approverExists && tallyVotes(approvals).Outcome != models.ApprovalRejected {
+			failPayout = false
+			return nil
+		}
+		if err := cancelPendingApprovals(sc, db, approvals, reason); err != nil {
+			return err
+		}
+		requeue, err = cancelPayout(sc, db, transaction, reason)
+		if errors.Is(err, repository.ErrTransactionNotPending) {
+			failPayout = false
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Cancelled approval %s: %s", approval.ID.Hex(), reason)
+
+	if approverExists {
+		n := &models.Notification{
+			UserID:  approval.ApproverID,
+			Type:    "payout_approval_cancelled",
+			Title:   "Payout Approval Cancelled",
+			Message: fmt.Sprintf("A payout awaiting your approval was cancelled because %s.", reason),
+			Meta:    map[string]interface{}{"approval_id": approval.ID.Hex(), "transaction_id": approval.TransactionID.Hex(), "reason": reason},
+		}
+		if err := notificationService.Create(ctx, n); err != nil {
+			return err
+		}
+	}
+	if !failPayout {
+		return nil
+	}
+	return notifyPayoutCancelled(ctx, db, notificationService, transaction, reason, requeue)
+}
+
+// cancelPayout fails a pending payout that can no longer be approved. A
+// rotation's collector didn't ask to be skipped, so they are put back at the
+// front of the queue, unless the group is gone; a requested payout never
+// took its recipient out of the queue. It returns where the recipient was
+// requeued.
+func cancelPayout(sc mongo.SessionContext, db *mongo.Database, transaction *models.Transaction, reason string) (models.RequeuePosition, error) {
+	requeue := models.RequeueNone
+	if transaction.RequestedBy.IsZero() {
+		requeue = models.RequeueFront
+		if _, err := repository.GetContributionByID(sc, db, transaction.ContributionID); err != nil {
+			if !errors.Is(err, repository.ErrContributionNotFound) {
+				return requeue, err
+			}
+			requeue = models.RequeueNone
+		}
+	}
+	recipient, err := rejectPayout(sc, db, transaction, reason, requeue)
+	if err != nil {
+		return requeue, err
+	}
+	if recipient == nil {
+		requeue = models.RequeueNone
+	}
+	return requeue, nil
+}
+
+func notifyPayoutCancelled(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, reason string, requeue models.RequeuePosition) error {
+	recipient, err := repository.GetWalletByID(db, transaction.ToWallet)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  recipient.OwnerID,
+		Type:    "payout_cancelled",
+		Title:   "Payout Cancelled",
+		Message: fmt.Sprintf("Your payout of %s was cancelled because %s.", transaction.Amount, reason),
+		Meta:    map[string]interface{}{"amount": transaction.Amount, "transaction_id": transaction.ID.Hex(), "reason": reason},
+	}
+	if requeue != models.RequeueNone {
+		n.Message += fmt.Sprintf(" You have been moved to the %s of the payout queue.", requeue)
+		n.Meta["requeue"] = requeue
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// sweepOverdueApproval escalates an approval its approver hasn't acted on in
+// time, or expires it if it was escalated and still hasn't been. An expired
+// approval no longer counts towards its payout's threshold; if the rest of
+// the set can no longer reach it, the payout fails and its recipient is
+// requeued as cancelPayout does.
+func sweepOverdueApproval(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approval *models.Approval, now time.Time) error {
+	if approval.EscalatedAt.IsZero() {
+		return escalateApproval(ctx, db, notificationService, approval, now)
+	}
+	return expireApproval(ctx, db, notificationService, approval)
+}
+
+// escalateApproval reminds the approver and tells the group admin, or the
+// system admins if the approver is the group admin.
+func escalateApproval(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approval *models.Approval, now time.Time) error {
+	contribution, err := repository.GetContributionByID(ctx, db, approval.ContributionID)
+	if err != nil {
+		return err
+	}
+	if err := repository.EscalateApproval(ctx, db, approval.ID, now); err != nil {
+		return err
+	}
+	log.Printf("Escalated overdue approval %s", approval.ID.Hex())
+
+	meta := map[string]interface{}{"approval_id": approval.ID.Hex(), "transaction_id": approval.TransactionID.Hex(), "group": contribution.Name}
+	n := &models.Notification{
+		UserID:  approval.ApproverID,
+		Type:    "payout_approval_overdue",
+		Title:   "Payout Approval Overdue",
+		Message: fmt.Sprintf("A payout from %s is still waiting for your approval. It will expire unless you or someone you delegate to acts on it.", contribution.Name),
+		Meta:    meta,
+	}
+	if err := notificationService.Create(ctx, n); err != nil {
+		log.Printf("Failed to remind approver %s: %v", approval.ApproverID.Hex(), err)
+	}
+	escalation := models.Notification{
+		Type:    "payout_approval_escalated",
+		Title:   "Payout Approval Escalated",
+		Message: fmt.Sprintf("An approver of a payout from %s hasn't acted on it in time.", contribution.Name),
+		Meta:    meta,
+	}
+	if contribution.GroupAdmin == approval.ApproverID {
+		notifyAdmins(ctx, db, notificationService, escalation)
+		return nil
+	}
+	escalation.UserID = contribution.GroupAdmin
+	return notificationService.Create(ctx, &escalation)
+}
+
+func expireApproval(ctx context.Context, db *mongo.Database, notificationService *NotificationService, approval *models.Approval) error {
+	const reason = "its approvals expired"
+	var failed *models.Transaction
+	var requeue models.RequeuePosition
+	err := RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		failed = nil
+		if err := repository.CancelApproval(sc, db, approval.ID, "the approval expired"); err != nil {
+			return err
+		}
+		approvals, err := repository.GetApprovalsByTransaction(sc, db, approval.TransactionID)
+		if err != nil {
+			return err
+		}
+		if tallyVotes(approvals).Outcome != models.ApprovalRejected {
+			return nil
+		}
+		if err := cancelPendingApprovals(sc, db, approvals, "the payout's approvals expired"); err != nil {
+			return err
+		}
+		transaction, err := repository.GetTransactionByID(sc, db, approval.TransactionID)
+		if err != nil {
+			return err
+		}
+		requeue, err = cancelPayout(sc, db, transaction, reason)
+		if errors.Is(err, repository.ErrTransactionNotPending) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		failed = transaction
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired approval %s", approval.ID.Hex())
+
+	n := &models.Notification{
+		UserID:  approval.ApproverID,
+		Type:    "payout_approval_expired",
+		Title:   "Payout Approval Expired",
+		Message: "A payout approval expired before it was acted on.",
+		Meta:    map[string]interface{}{"approval_id": approval.ID.Hex(), "transaction_id": approval.TransactionID.Hex()},
+	}
+	if err := notificationService.Create(ctx, n); err != nil {
+		return err
+	}
+	if failed == nil {
+		return nil
+	}
+	return notifyPayoutCancelled(ctx, db, notificationService, failed, reason, requeue)
+}
+
+// payoutBlocker says why a pending payout can never be approved, if it
+// can't, and whether its approver still exists.
+func payoutBlocker(ctx context.Context, db *mongo.Database, approval *models.Approval, transaction *models.Transaction) (string, bool, error) {
+	if _, err := repository.GetUserByID(db.Collection("users"), approval.ApproverID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return "the approver's account no longer exists", false, nil
+		}
+		return "", true, err
+	}
+	if _, err := repository.GetContributionByID(ctx, db, approval.ContributionID); err != nil {
+		if errors.Is(err, repository.ErrContributionNotFound) {
+			return "the contribution no longer exists", true, nil
+		}
+		return "", true, err
+	}
+	if _, err := repository.GetWalletByID(db, transaction.ToWallet); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "the recipient's wallet no longer exists", true, nil
+		}
+		return "", true, err
+	}
+	return "", true, nil
+}
@@ -4,57 +4,71 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RecordContribution(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, userID primitive.ObjectID, amount float64, paymentMethod models.PaymentMethod) error {
-	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+func RecordContribution(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, userID primitive.ObjectID, amount money.Money, paymentMethod models.PaymentMethod) error {
+	contribution, _, err := recordContribution(ctx, db, notificationService, contributionID, userID, amount, paymentMethod)
 	if err != nil {
 		return err
 	}
+	n := &models.Notification{
+		UserID:  userID,
+		Type:    "group_contribution",
+		Title:   "Group Contribution",
+		Message: "You contributed to group " + contribution.Name,
+		Meta:    map[string]interface{}{ "group": contribution.Name, "amount": amount },
+		ActionLink: "/ajo/groupTransactions?groupName=" + contribution.Name,
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// recordContribution pays a member's contribution from their wallet and
+// returns the cycle it paid for.
+func recordContribution(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, userID primitive.ObjectID, amount money.Money, paymentMethod models.PaymentMethod) (*models.Contribution, *models.CycleWindow, error) {
+	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
+	if err != nil {
+		return nil, nil, err
+	}
 	if !containsUser(contribution.YetToCollectMembers, userID) && !containsUser(contribution.AlreadyCollectedMembers, userID) {
-		return errors.New("user not in contribution")
+		return nil, nil, errors.New("user not in contribution")
+	}
+	if contribution.Type == models.TypeDailySavings {
+		return nil, nil, errors.New("daily savings deposits are recorded by the collector")
 	}
-	if amount != contribution.Amount {
-		return errors.New("contribution amount mismatch")
+	if !amount.Equal(contribution.Amount) {
+		return nil, nil, errors.New("contribution amount mismatch")
 	}
 
 	// Get wallets
 	var user models.User
 	err = db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
 	if err != nil {
-		return errors.New("user not found")
+		return nil, nil, errors.New("user not found")
 	}
 	userWallet, err := repository.GetWalletByUserID(db, user.ID)
 	if err != nil {
-		return errors.New("user wallet not found")
+		return nil, nil, errors.New("user wallet not found")
 	}
 	fmt.Println("Wallet ID from contribution:", contribution.WalletID.Hex())
 
 	groupWallet, err := repository.GetWalletByID(db, contribution.WalletID)
 	if err != nil {
-		return errors.New("group wallet not found")
+		return nil, nil, errors.New("group wallet not found")
 	}
 
-	// Check balance
-	if userWallet.Balance < amount {
-		return errors.New("insufficient balance")
-	}
-
-	// Update wallets
-	if err := repository.UpdateWalletBalance(db, userWallet.ID, amount, false); err != nil {
-		return err
-	}
-	if err := repository.UpdateWalletBalance(db, groupWallet.ID, amount, true); err != nil {
-		// Rollback
-		repository.UpdateWalletBalance(db, userWallet.ID, amount, true)
-		return err
+	now := time.Now()
+	window, err := attributeContributionCycle(ctx, db, contribution, userID, userWallet.ID, now)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	transaction := &models.Transaction{
@@ -62,46 +76,57 @@ func RecordContribution(ctx context.Context, db *mongo.Database, notificationSer
 		ToWallet:       groupWallet.ID,
 		Amount:         amount,
 		Type:           models.TransactionContribution,
-		Date:           time.Now(),
+		Date:           now,
 		PaymentMethod:  paymentMethod,
-		Status:         models.StatusSuccess,
 		ContributionID: contributionID,
+		Cycle:          window.Number,
 	}
-	if err := repository.CreateTransaction(ctx, db, transaction); err != nil {
-		// Rollback
-		repository.UpdateWalletBalance(db, userWallet.ID, amount, true)
-		repository.UpdateWalletBalance(db, groupWallet.ID, amount, false)
-		return err
+	record := &models.MemberCycle{
+		ContributionID: contributionID,
+		UserID:         userID,
+		Cycle:          window.Number,
+		Amount:         amount,
+		Status:         models.MemberCyclePaid,
+		PaidAt:         now,
 	}
-
-	// After successful transaction and before the late check
-	n := &models.Notification{
-		UserID:  userID,
-		Type:    "group_contribution",
-		Title:   "Group Contribution",
-		Message: "You contributed to group " + contribution.Name,
-		Meta:    map[string]interface{}{ "group": contribution.Name, "amount": amount },
-		ActionLink: "/ajo/groupTransactions?groupName=" + contribution.Name,
+	if now.After(window.GraceUntil) {
+		record.Status = models.MemberCycleLate
 	}
-	err = notificationService.Create(ctx, n)
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if err := executeTransfer(sc, db, transaction, true); err != nil {
+			return err
+		}
+		record.TransactionID = transaction.ID
+		return repository.RecordMemberCyclePayment(sc, db, record)
+	})
 	if err != nil {
-		return err
+		// Another payment for the same cycle got in first
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, nil, ErrCycleAlreadyPaid
+		}
+		return nil, nil, err
 	}
 
-	if time.Now().After(contribution.CollectionDeadline) {
-		n := &models.Notification{
-			UserID:  userID,
-			Type:    "late_contribution",
-			Title:   "Late Contribution",
-			Message: fmt.Sprintf("Late contribution recorded. Penalty applied: %.2f", contribution.PenaltyAmount),
-			Meta:    map[string]interface{}{ "penalty": contribution.PenaltyAmount, "group": contribution.Name },
+	// The payment has already gone through, so a penalty that can't be
+	// charged is logged rather than reported as a failed payment
+	if record.Status == models.MemberCycleLate {
+		if err := ChargeLatePenalty(ctx, db, notificationService, contribution, userID, window.Number); err != nil {
+			log.Printf("Failed to charge late penalty of user %s for contribution %s cycle %d: %v", userID.Hex(), contributionID.Hex(), window.Number, err)
 		}
-		return notificationService.Create(ctx, n)
 	}
-	return nil
+
+	// Pay off penalties from earlier cycles while the wallet has funds
+	if _, err := CollectArrears(ctx, db, contribution, userID); err != nil {
+		log.Printf("Failed to collect arrears of user %s for contribution %s: %v", userID.Hex(), contributionID.Hex(), err)
+	}
+	return contribution, window, nil
 }
 
-func RecordPayout(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, userID, groupAdminID primitive.ObjectID, amount float64, paymentMethod models.PaymentMethod) error {
+// RecordPayout requests a payout to a group's next collector by hand, for
+// groups the rotation doesn't pay out. It must be for the whole pot of the
+// current cycle, and the collector can't have another payout waiting for
+// approval.
+func RecordPayout(ctx context.Context, db *mongo.Database, notificationService *NotificationService, contributionID, userID, groupAdminID primitive.ObjectID, amount money.Money, paymentMethod models.PaymentMethod) error {
 	contribution, err := repository.GetContributionByID(ctx, db, contributionID)
 	if err != nil {
 		return err
@@ -111,9 +136,24 @@ func RecordPayout(ctx context.Context, db *mongo.Database, notificationService *
 		return errors.New("only group admin can record payouts")
 	}
 
+	if contribution.PayoutSchedule != nil || (contribution.Type == models.TypeGroupContribution && contribution.CycleCount > 0) {
+		return errors.New("payouts of this contribution are made by its rotation")
+	}
 	if !containsUser(contribution.YetToCollectMembers, userID) {
 		return errors.New("user not eligible for payout")
 	}
+	collector, slot := nextCollector(contribution)
+	if collector != userID {
+		return errors.New("user not eligible for payout: it is not their turn to collect")
+	}
+	waived, err := waivedMembers(ctx, db, contribution.ID, currentCycle(contribution))
+	if err != nil {
+		return err
+	}
+	pot, kept, share := cyclePot(contribution, contributionMembers(contribution), waived, slot)
+	if !amount.Equal(pot) {
+		return fmt.Errorf("payout amount must be the cycle's pot of %s", pot)
+	}
 
 	// Get wallets
 	var user models.User
@@ -121,7 +161,7 @@ func RecordPayout(ctx context.Context, db *mongo.Database, notificationService *
 	if err != nil {
 		return errors.New("user not found")
 	}
-	userWallet, err := repository.GetWalletByID(db, user.ID)
+	userWallet, err := repository.GetWalletByUserID(db, user.ID)
 	if err != nil {
 		return errors.New("user wallet not found")
 	}
@@ -131,48 +171,85 @@ func RecordPayout(ctx context.Context, db *mongo.Database, notificationService *
 	}
 
 	// Check balance
-	if groupWallet.Balance < amount {
+	if groupWallet.Balance.LessThan(amount) {
 		return errors.New("insufficient balance in group wallet")
 	}
 
-	// Create transaction (pending)
 	transaction := &models.Transaction{
 		FromWallet:     groupWallet.ID,
 		ToWallet:       userWallet.ID,
 		Amount:         amount,
 		Type:           models.TransactionPayout,
-		Date:           time.Now(),
 		PaymentMethod:  paymentMethod,
-		Status:         models.StatusPending,
 		ContributionID: contributionID,
-	}
-	if err := repository.CreateTransaction(ctx, db, transaction); err != nil {
-		return err
-	}
-
-	// Create approval
-	approval := &models.Approval{
-		TransactionID:  transaction.ID,
-		ApproverID:     groupAdminID,
-		Status:         models.ApprovalPending,
-		ContributionID: contributionID,
-	}
-	if err := repository.CreateApproval(ctx, db, approval); err != nil {
-		// Rollback: Delete transaction
-		db.Collection("transactions").DeleteOne(ctx, bson.M{"_id": transaction.ID})
+		RequestedBy:    groupAdminID,
+		BidKept:        kept,
+		BidShare:       share,
+	}
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		// Requests for the same group are checked one at a time
+		if err := repository.LockContribution(sc, db, contributionID); err != nil {
+			return err
+		}
+		pending, err := repository.HasPendingPayout(sc, db, contributionID, userWallet.ID)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return errors.New("user already has a payout pending approval")
+		}
+		if err := createPayoutRequest(sc, db, contribution, transaction, userID); err != nil {
+			return err
+		}
+		return repository.AdjustBidPool(sc, db, contributionID, kept.Sub(share))
+	})
+	if err != nil {
 		return err
 	}
+	notifyApprovers(ctx, db, notificationService, transaction.ID, groupAdminID, models.Notification{
+		Type:    "payout_approval_required",
+		Title:   "Payout Awaiting Approval",
+		Message: fmt.Sprintf("A payout of %s from %s is awaiting your approval.", amount, contribution.Name),
+		Meta:    map[string]interface{}{"group": contribution.Name, "amount": amount, "transaction_id": transaction.ID.Hex()},
+	})
 
 	n := &models.Notification{
 		UserID:  userID,
 		Type:    "payout_requested",
 		Title:   "Payout Requested",
-		Message: fmt.Sprintf("Payout of %.2f requested for contribution: %s", amount, contribution.Name),
+		Message: fmt.Sprintf("Payout of %s requested for contribution: %s", amount, contribution.Name),
 		Meta:    map[string]interface{}{ "amount": amount, "group": contribution.Name },
 	}
 	return notificationService.Create(ctx, n)
 }
 
+// createPayoutRequest stores a pending payout transaction to payee and its
+// approval set, one approval for each approver the group's approval policy
+// names. No money moves until enough of them approve.
+func createPayoutRequest(sc mongo.SessionContext, db *mongo.Database, contribution *models.Contribution, transaction *models.Transaction, payee primitive.ObjectID) error {
+	transaction.ID = primitive.NilObjectID
+	transaction.Status = models.StatusPending
+	transaction.Date = time.Now()
+	if err := repository.CreateTransaction(sc, db, transaction); err != nil {
+		return err
+	}
+
+	approvers, threshold := payoutApprovers(contribution, payee)
+	for _, approverID := range approvers {
+		approval := &models.Approval{
+			TransactionID:  transaction.ID,
+			ApproverID:     approverID,
+			Status:         models.ApprovalPending,
+			Threshold:      threshold,
+			ContributionID: transaction.ContributionID,
+		}
+		if err := repository.CreateApproval(sc, db, approval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // func GetUserTransactions(ctx context.Context, db *mongo.Database, userID, contributionID primitive.ObjectID) ([]*models.Transaction, error) {
 // 	return repository.GetUserTransactions(ctx, db, userID, contributionID)
 // }
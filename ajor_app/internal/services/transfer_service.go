@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RunInTransaction runs fn inside a MongoDB multi-document transaction so every
+// write it makes commits or aborts together. The driver retries fn on
+// TransientTransactionError and the commit on UnknownTransactionCommitResult.
+// Calls made while a transaction is already open join it instead of nesting.
+func RunInTransaction(ctx context.Context, db *mongo.Database, fn func(sc mongo.SessionContext) error) error {
+	if sc, ok := ctx.(mongo.SessionContext); ok {
+		return fn(sc)
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// ExecuteTransfer records a transaction and moves its money through the
+// ledger in one database transaction. A transaction that is already stored
+// (e.g. a pending payout) is settled in place, and only if it is still
+// pending: otherwise repository.ErrTransactionNotPending is returned and no
+// money moves, so racing settlements credit it once.
+func ExecuteTransfer(ctx context.Context, db *mongo.Database, transaction *models.Transaction) error {
+	isNew := transaction.ID.IsZero()
+	return RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		return executeTransfer(sc, db, transaction, isNew)
+	})
+}
+
+// executeTransfer must be told whether the transaction is new rather than
+// checking its ID, because a retried attempt sees the ID assigned by the
+// insert that was rolled back.
+func executeTransfer(sc mongo.SessionContext, db *mongo.Database, transaction *models.Transaction, isNew bool) error {
+	if isNew {
+		transaction.ID = primitive.NilObjectID
+		transaction.Status = models.StatusSuccess
+		if err := repository.CreateTransaction(sc, db, transaction); err != nil {
+			return err
+		}
+	} else {
+		if err := repository.SettlePendingTransaction(sc, db, transaction.ID, models.StatusSuccess); err != nil {
+			return err
+		}
+		transaction.Status = models.StatusSuccess
+	}
+	return repository.PostJournalEntry(sc, db, journalEntryForTransaction(transaction))
+}
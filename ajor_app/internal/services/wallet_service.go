@@ -2,19 +2,21 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // FundWallet initiates a funding request to the user's virtual account and updates the wallet balance upon success.
-func FundWallet(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, amount float64, pg payment.PaymentGateway) error {
+func FundWallet(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, amount money.Money, pg payment.PaymentGateway) error {
 	// Get user and wallet
 	user, err := repository.GetUserByID(db.Collection("users"), userID)
 	if err != nil {
@@ -34,7 +36,7 @@ func FundWallet(ctx context.Context, db *mongo.Database, userID primitive.Object
 		Email:        user.Email,
 		Amount:       amount,
 		TxRef:        txRef,
-		Currency:     "NGN",
+		Currency:     amount.Currency,
 		IsPermanent:  false,
 		Narration:    fmt.Sprintf("Fund wallet for %s", user.Username),
 		PhoneNumber:  user.Phone,
@@ -56,6 +58,8 @@ func FundWallet(ctx context.Context, db *mongo.Database, userID primitive.Object
 		Status:        models.StatusPending,
 		ContributionID: primitive.ObjectID{},
 		TxRef:         txRef,
+		// Lets the sweeper ask the gateway about the payment later
+		GatewayReference: transactionResponse.TransactionID,
 	}
 	if err := repository.CreateTransaction(ctx, db, transaction); err != nil {
 		return fmt.Errorf("failed to create transaction: %v", err)
@@ -64,25 +68,22 @@ func FundWallet(ctx context.Context, db *mongo.Database, userID primitive.Object
 	// Verify transaction (in real-world, this would be via webhook; here we simulate verification)
 	verifiedTx, err := pg.VerifyTransaction(ctx, transactionResponse.TransactionID)
 	if err != nil {
-		// Update transaction to failed
-		repository.UpdateTransactionStatus(ctx, db, transaction.ID, models.StatusFailed)
+		// Update transaction to failed, unless its webhook has settled it
+		repository.SettlePendingTransaction(ctx, db, transaction.ID, models.StatusFailed)
 		return fmt.Errorf("transaction verification failed: %v", err)
 	}
-	if verifiedTx.Status != "success" || verifiedTx.Amount != amount {
-		repository.UpdateTransactionStatus(ctx, db, transaction.ID, models.StatusFailed)
+	if verifiedTx.Status != payment.ChargeSuccessful || !verifiedTx.Amount.Equal(amount) {
+		repository.SettlePendingTransaction(ctx, db, transaction.ID, models.StatusFailed)
 		return fmt.Errorf("invalid transaction status or amount")
 	}
 
-	// Update wallet balance
-	if err := repository.UpdateWalletBalance(db, wallet.ID, amount, true); err != nil {
-		// Update transaction to failed (rollback attempt)
-		repository.UpdateTransactionStatus(ctx, db, transaction.ID, models.StatusFailed)
-		return fmt.Errorf("failed to update wallet balance: %v", err)
+	// The webhook may have credited the funding already
+	err = ExecuteTransfer(ctx, db, transaction)
+	if errors.Is(err, repository.ErrTransactionNotPending) {
+		return nil
 	}
-
-	// Update transaction to success
-	if err := repository.UpdateTransactionStatus(ctx, db, transaction.ID, models.StatusSuccess); err != nil {
-		return fmt.Errorf("failed to update transaction status: %v", err)
+	if err != nil {
+		return fmt.Errorf("failed to update wallet balance: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxWebhookAttempts is how often an event is tried before it is left
+	// for an admin to replay.
+	maxWebhookAttempts = 8
+	// webhookRetryBase is the wait after the first failed attempt; it
+	// doubles after each one.
+	webhookRetryBase = time.Minute
+	// webhookLease keeps other workers off an event while it is processed.
+	webhookLease = 5 * time.Minute
+
+	DefaultWebhookEventLimit = 50
+	maxWebhookEventLimit     = 200
+)
+
+var ErrInvalidWebhookPayload = errors.New("invalid webhook payload")
+
+// ReceiveWebhook stores a verified webhook for processing. It returns
+// repository.ErrDuplicateWebhookEvent if the provider already sent it.
+func ReceiveWebhook(ctx context.Context, db *mongo.Database, provider payment.Provider, body []byte) (*models.WebhookEvent, error) {
+	// Flutterwave and Paystack both send {"event": ..., "data": {"id": ...}}
+	var envelope struct {
+		Event string `json:"event"`
+		Data  struct {
+			ID interface{} `json:"id"`
+		} `json:"data"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&envelope); err != nil || envelope.Event == "" {
+		return nil, ErrInvalidWebhookPayload
+	}
+	event := &models.WebhookEvent{
+		Provider:  string(provider),
+		EventID:   webhookEventID(envelope.Event, envelope.Data.ID, body),
+		EventType: envelope.Event,
+		Payload:   string(body),
+	}
+	if err := repository.CreateWebhookEvent(ctx, db, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// webhookEventID identifies an event by its type and the ID of the charge or
+// transfer it is about. Events without an ID are identified by their body.
+func webhookEventID(eventType string, id interface{}, body []byte) string {
+	if id != nil && fmt.Sprint(id) != "" {
+		return fmt.Sprintf("%s:%v", eventType, id)
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ProcessWebhookEvents processes every event that is due, including retries.
+// A failure on one event is logged and does not stop the others.
+func ProcessWebhookEvents(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, now time.Time) error {
+	events, err := repository.GetDueWebhookEvents(ctx, db, now)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := ProcessWebhookEvent(ctx, db, pg, notificationService, event, now); err != nil {
+			log.Printf("Failed to process webhook event %s: %v", event.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// ProcessWebhookEvent acts on a pending event unless another worker got to it
+// first. An event that fails is retried with backoff until
+// maxWebhookAttempts, then marked failed. The event is updated in place with
+// the outcome, and the processing error, if any, is returned.
+func ProcessWebhookEvent(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, event *models.WebhookEvent, now time.Time) error {
+	claimed, err := repository.ClaimWebhookEvent(ctx, db, event.ID, event.NextAttemptAt, now.Add(webhookLease))
+	if err != nil || !claimed {
+		return err
+	}
+
+	event.Attempts++
+	result, processErr := handleWebhookEvent(ctx, db, pg, notificationService, event)
+	if processErr == nil {
+		event.Status = models.WebhookProcessed
+		event.Result = result
+		event.LastError = ""
+		return repository.CompleteWebhookEvent(ctx, db, event.ID, event.Attempts, result)
+	}
+
+	event.LastError = processErr.Error()
+	event.NextAttemptAt = now.Add(webhookRetryBase << (event.Attempts - 1))
+	if event.Attempts >= maxWebhookAttempts {
+		event.Status = models.WebhookFailed
+	}
+	if err := repository.ScheduleWebhookRetry(ctx, db, event.ID, event.Status, event.Attempts, event.NextAttemptAt, event.LastError); err != nil {
+		return err
+	}
+	return processErr
+}
+
+// ListWebhookEvents returns the latest events for admins, optionally only
+// those with a status or from a provider.
+func ListWebhookEvents(ctx context.Context, db *mongo.Database, status, provider string, limit int) ([]*models.WebhookEvent, error) {
+	switch models.WebhookEventStatus(status) {
+	case "", models.WebhookPending, models.WebhookProcessed, models.WebhookFailed:
+	default:
+		return nil, fmt.Errorf("invalid status %q", status)
+	}
+	if limit < 1 || limit > maxWebhookEventLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxWebhookEventLimit)
+	}
+	return repository.ListWebhookEvents(ctx, db, models.WebhookEventStatus(status), provider, int64(limit))
+}
+
+func GetWebhookEvent(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	event, err := repository.GetWebhookEventByID(ctx, db, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("webhook event not found")
+	}
+	return event, err
+}
+
+// ReplayWebhookEvent gives a failed event a fresh set of retries and
+// processes it straight away.
+func ReplayWebhookEvent(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, id primitive.ObjectID) (*models.WebhookEvent, error) {
+	now := time.Now()
+	event, err := repository.RequeueWebhookEvent(ctx, db, id, now)
+	if err == mongo.ErrNoDocuments {
+		if _, err := repository.GetWebhookEventByID(ctx, db, id); err != nil {
+			return nil, errors.New("webhook event not found")
+		}
+		return nil, errors.New("only failed webhook events can be replayed")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ProcessWebhookEvent(ctx, db, pg, notificationService, event, now); err != nil {
+		log.Printf("Replay of webhook event %s failed: %v", id.Hex(), err)
+	}
+	return event, nil
+}
+
+func handleWebhookEvent(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, event *models.WebhookEvent) (string, error) {
+	switch payment.Provider(event.Provider) {
+	case payment.ProviderFlutterwave:
+		return handleFlutterwaveEvent(ctx, db, pg, notificationService, []byte(event.Payload))
+	case payment.ProviderPaystack:
+		return handlePaystackEvent(ctx, db, pg, notificationService, []byte(event.Payload))
+	}
+	return "", fmt.Errorf("unknown payment provider %s", event.Provider)
+}
+
+func handleFlutterwaveEvent(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, body []byte) (string, error) {
+	var webhook struct {
+		Event string `json:"event"`
+		Data  struct {
+			ID        json.Number `json:"id"`
+			TxRef     string      `json:"tx_ref"`
+			Reference string      `json:"reference"`
+			Amount    json.Number `json:"amount"`
+			Currency  string      `json:"currency"`
+			Status    string      `json:"status"`
+			// Set on bank transfers into a virtual account
+			AccountNumber string `json:"account_number"`
+			OrderRef      string `json:"order_ref"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return "", ErrInvalidWebhookPayload
+	}
+
+	data := webhook.Data
+	switch {
+	case webhook.Event == "transfer.completed" && (data.Status == "SUCCESSFUL" || data.Status == "FAILED"):
+		transferID := payment.QualifiedID(payment.ProviderFlutterwave, data.ID.String())
+		return "withdrawal_updated", CompleteWithdrawal(ctx, db, pg, notificationService, data.Reference, transferID)
+	case webhook.Event == "charge.completed" && data.Status == "successful":
+		amount, err := money.Parse(data.Amount.String(), data.Currency)
+		if err != nil {
+			return "", fmt.Errorf("invalid amount %q", data.Amount)
+		}
+		return creditCharge(ctx, db, pg, notificationService, inboundCharge{
+			Provider:      payment.ProviderFlutterwave,
+			ID:            data.ID.String(),
+			VerifyID:      payment.QualifiedID(payment.ProviderFlutterwave, data.ID.String()),
+			TxRef:         data.TxRef,
+			Amount:        amount,
+			AccountNumber: data.AccountNumber,
+			AccountID:     data.OrderRef,
+		})
+	}
+	return "ignored", nil
+}
+
+// handlePaystackEvent handles Paystack events, whose amounts are in kobo.
+func handlePaystackEvent(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, body []byte) (string, error) {
+	var webhook struct {
+		Event string `json:"event"`
+		Data  struct {
+			ID        json.Number `json:"id"`
+			Reference string      `json:"reference"`
+			Amount    int64       `json:"amount"`
+			Currency  string      `json:"currency"`
+			Status    string      `json:"status"`
+			Channel   string      `json:"channel"`
+			// Says which dedicated account a bank transfer was paid into
+			Authorization struct {
+				ReceiverAccountNumber string `json:"receiver_bank_account_number"`
+			} `json:"authorization"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return "", ErrInvalidWebhookPayload
+	}
+
+	data := webhook.Data
+	switch webhook.Event {
+	case "charge.success":
+		if data.Status == "success" {
+			charge := inboundCharge{
+				Provider: payment.ProviderPaystack,
+				ID:       data.ID.String(),
+				// Paystack verifies charges by reference
+				VerifyID: payment.QualifiedID(payment.ProviderPaystack, data.Reference),
+				TxRef:    data.Reference,
+				Amount:   money.New(data.Amount, data.Currency),
+			}
+			if data.Channel == "dedicated_nuban" {
+				charge.AccountNumber = data.Authorization.ReceiverAccountNumber
+			}
+			return creditCharge(ctx, db, pg, notificationService, charge)
+		}
+	case "transfer.success", "transfer.failed", "transfer.reversed":
+		transferID := payment.QualifiedID(payment.ProviderPaystack, data.ID.String())
+		return "withdrawal_updated", CompleteWithdrawal(ctx, db, pg, notificationService, data.Reference, transferID)
+	}
+	return "ignored", nil
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withdrawalWebhookGrace is how long a withdrawal waits for its transfer
+// webhook before its status is fetched from the gateway instead.
+const withdrawalWebhookGrace = 30 * time.Minute
+
+// withdrawalUnknownTTL is how long a withdrawal whose transfer no gateway has
+// heard of stays pending before it is reversed. The transfer request may
+// have been lost before it reached the gateway.
+const withdrawalUnknownTTL = 24 * time.Hour
+
+// ResolveBankAccount looks up the name on a bank account so the user can check
+// it before adding it.
+func ResolveBankAccount(ctx context.Context, pg payment.PaymentGateway, bankCode, accountNumber string) (*payment.BankAccountDetails, error) {
+	bankCode = strings.TrimSpace(bankCode)
+	accountNumber = strings.TrimSpace(accountNumber)
+	if bankCode == "" {
+		return nil, errors.New("bank code is required")
+	}
+	// Nigerian (NUBAN) account numbers are 10 digits
+	if _, err := strconv.ParseUint(accountNumber, 10, 64); err != nil || len(accountNumber) != 10 {
+		return nil, errors.New("account number must be 10 digits")
+	}
+	details, err := pg.ResolveBankAccount(ctx, bankCode, accountNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bank account: %v", err)
+	}
+	return details, nil
+}
+
+// AddBankAccount adds a beneficiary under the name the bank has on record.
+func AddBankAccount(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, userID primitive.ObjectID, bankCode, accountNumber string) (*models.BankAccount, error) {
+	details, err := ResolveBankAccount(ctx, pg, bankCode, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	account := &models.BankAccount{
+		BankCode:      details.BankCode,
+		AccountNumber: details.AccountNumber,
+		AccountName:   details.AccountName,
+	}
+	if err := repository.AddBankAccount(ctx, db, userID, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func GetBankAccounts(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]models.BankAccount, error) {
+	user, err := repository.GetUserByID(db.Collection("users"), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.BankAccounts == nil {
+		return []models.BankAccount{}, nil
+	}
+	return user.BankAccounts, nil
+}
+
+func RemoveBankAccount(ctx context.Context, db *mongo.Database, userID, accountID primitive.ObjectID) error {
+	return repository.RemoveBankAccount(ctx, db, userID, accountID)
+}
+
+// Withdraw pays money from the user's wallet to one of their bank accounts.
+// The amount is held out of the wallet before the gateway is asked to
+// transfer it, and stays held until the transfer webhook settles or reverses
+// the withdrawal. The hold is only reversed straight away if the gateway
+// refuses the transfer; if the request's fate is unknown the withdrawal stays
+// pending and is later looked up by its TxRef.
+func Withdraw(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, userID, bankAccountID primitive.ObjectID, amount money.Money) (*models.Transaction, error) {
+	user, err := repository.GetUserByID(db.Collection("users"), userID)
+	if err != nil {
+		return nil, err
+	}
+	var account *models.BankAccount
+	for i := range user.BankAccounts {
+		if user.BankAccounts[i].ID == bankAccountID {
+			account = &user.BankAccounts[i]
+			break
+		}
+	}
+	if account == nil {
+		return nil, errors.New("bank account not found")
+	}
+	wallet, err := repository.GetWalletByUserID(db, userID)
+	if err != nil {
+		return nil, errors.New("user wallet not found")
+	}
+	if !amount.IsPositive() || !amount.SameCurrency(wallet.Balance) {
+		return nil, errors.New("amount must be positive and in the wallet's currency")
+	}
+
+	transaction := &models.Transaction{
+		FromWallet:    wallet.ID,
+		Amount:        amount,
+		Type:          models.TransactionWithdrawal,
+		Date:          time.Now(),
+		PaymentMethod: models.PaymentBankTransfer,
+		Status:        models.StatusPending,
+		// Paystack caps transfer references at 50 characters
+		TxRef:         "withdraw-" + primitive.NewObjectID().Hex(),
+		BankAccountID: account.ID,
+	}
+	err = RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		transaction.ID = primitive.NilObjectID
+		if err := repository.CreateTransaction(sc, db, transaction); err != nil {
+			return err
+		}
+		return repository.PostJournalEntry(sc, db, withdrawalEntry(transaction, "Withdrawal held",
+			models.LedgerLeg{Account: models.AccountWallet, WalletID: wallet.ID, Debit: amount},
+			models.LedgerLeg{Account: models.AccountWithdrawalsInTransit, Credit: amount},
+		))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := pg.Transfer(ctx, payment.TransferRequest{
+		BankCode:      account.BankCode,
+		AccountNumber: account.AccountNumber,
+		AccountName:   account.AccountName,
+		Amount:        amount,
+		Narration:     fmt.Sprintf("Ajor withdrawal for %s", user.Username),
+		Reference:     transaction.TxRef,
+	})
+	if errors.Is(err, payment.ErrRequestRejected) {
+		if reverseErr := settleWithdrawal(ctx, db, transaction, false); reverseErr != nil {
+			log.Printf("Failed to reverse withdrawal %s: %v", transaction.ID.Hex(), reverseErr)
+		}
+		return nil, fmt.Errorf("failed to initiate withdrawal: %v", err)
+	}
+	if err != nil {
+		// The gateway may have queued the transfer anyway
+		log.Printf("Withdrawal %s left pending, transfer request failed: %v", transaction.ID.Hex(), err)
+		return transaction, nil
+	}
+	if transfer.Status == payment.TransferFailed {
+		if err := settleWithdrawal(ctx, db, transaction, false); err != nil {
+			log.Printf("Failed to reverse withdrawal %s: %v", transaction.ID.Hex(), err)
+		}
+		return nil, fmt.Errorf("failed to initiate withdrawal: %s", transfer.Message)
+	}
+	transaction.GatewayReference = transfer.TransferID
+	transaction.GatewayStatus = string(transfer.Status)
+	transaction.GatewayMessage = transfer.Message
+	if err := repository.UpdateTransactionGateway(ctx, db, transaction.ID, transfer.TransferID, string(transfer.Status), transfer.Message); err != nil {
+		log.Printf("Failed to store gateway reference for withdrawal %s: %v", transaction.ID.Hex(), err)
+	}
+	return transaction, nil
+}
+
+// CompleteWithdrawal handles the gateway's notice that a withdrawal's
+// transfer has finished. The notice is only a prompt: the transfer is looked
+// up with the gateway before anything is settled. transferID may be empty if
+// the notice didn't carry one and the withdrawal has no gateway reference
+// either, in which case the transfer is looked up by the withdrawal's TxRef.
+func CompleteWithdrawal(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, reference, transferID string) error {
+	transaction, err := repository.GetTransactionByTxRef(ctx, db, reference)
+	if err != nil {
+		return fmt.Errorf("withdrawal %s not found", reference)
+	}
+	if transaction.Type != models.TransactionWithdrawal {
+		return fmt.Errorf("transaction %s is not a withdrawal", reference)
+	}
+	if transaction.Status != models.StatusPending {
+		return nil
+	}
+	return trackWithdrawal(ctx, db, pg, notificationService, transaction, transferID)
+}
+
+// SyncPendingWithdrawals follows up on withdrawals whose transfer webhook
+// hasn't arrived within withdrawalWebhookGrace, including those whose
+// transfer request failed before the gateway gave it an ID. One that no
+// gateway has heard of after withdrawalUnknownTTL is reversed. A failure on
+// one withdrawal is logged and does not stop the others.
+func SyncPendingWithdrawals(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, now time.Time) error {
+	transactions, err := repository.GetPendingWithdrawals(ctx, db, now.Add(-withdrawalWebhookGrace))
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		err := trackWithdrawal(ctx, db, pg, notificationService, transaction, "")
+		if errors.Is(err, payment.ErrNotFound) && transaction.GatewayReference == "" && transaction.CreatedAt.Before(now.Add(-withdrawalUnknownTTL)) {
+			err = finishWithdrawal(ctx, db, notificationService, transaction, false, "The transfer never reached the payment provider.")
+		}
+		if err != nil {
+			log.Printf("Failed to check withdrawal %s: %v", transaction.ID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// trackWithdrawal records the gateway's status for a withdrawal's transfer
+// and settles the withdrawal once the transfer has succeeded or failed. The
+// transfer is fetched by transferID, or the withdrawal's gateway reference,
+// or failing both by its TxRef. A transfer that doesn't match the withdrawal
+// is never settled against it.
+func trackWithdrawal(ctx context.Context, db *mongo.Database, pg payment.PaymentGateway, notificationService *NotificationService, transaction *models.Transaction, transferID string) error {
+	if transferID == "" {
+		transferID = transaction.GatewayReference
+	}
+	var transfer *payment.TransferResponse
+	var err error
+	if transferID != "" {
+		transfer, err = pg.GetTransfer(ctx, transferID)
+	} else {
+		transfer, err = pg.GetTransferByReference(ctx, transaction.TxRef)
+	}
+	if err != nil {
+		return err
+	}
+	if transfer.Reference != transaction.TxRef {
+		return fmt.Errorf("transfer %s belongs to %s, not withdrawal %s", transfer.TransferID, transfer.Reference, transaction.TxRef)
+	}
+	if !transfer.Amount.Equal(transaction.Amount) {
+		return fmt.Errorf("transfer %s is for %s %s but withdrawal %s is for %s %s", transfer.TransferID, transfer.Amount, transfer.Amount.Currency, transaction.TxRef, transaction.Amount, transaction.Amount.Currency)
+	}
+	if err := repository.UpdateTransactionGateway(ctx, db, transaction.ID, transfer.TransferID, string(transfer.Status), transfer.Message); err != nil {
+		return err
+	}
+	if !transfer.Status.IsFinal() {
+		return nil
+	}
+	reason := ""
+	if transfer.Message != "" {
+		reason = "Reason: " + transfer.Message
+	}
+	return finishWithdrawal(ctx, db, notificationService, transaction, transfer.Status == payment.TransferSuccessful, reason)
+}
+
+// finishWithdrawal settles a withdrawal and tells its owner how it ended.
+// reason, if any, is appended to a failure notice.
+func finishWithdrawal(ctx context.Context, db *mongo.Database, notificationService *NotificationService, transaction *models.Transaction, successful bool, reason string) error {
+	err := settleWithdrawal(ctx, db, transaction, successful)
+	if errors.Is(err, repository.ErrTransactionNotPending) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	wallet, err := repository.GetWalletByID(db, transaction.FromWallet)
+	if err != nil {
+		return err
+	}
+	n := &models.Notification{
+		UserID:  wallet.OwnerID,
+		Type:    "withdrawal_successful",
+		Title:   "Withdrawal Successful",
+		Message: fmt.Sprintf("%s has been sent to your bank account.", transaction.Amount),
+		Meta:    map[string]interface{}{"amount": transaction.Amount, "reference": transaction.TxRef},
+	}
+	if !successful {
+		n.Type = "withdrawal_failed"
+		n.Title = "Withdrawal Failed"
+		n.Message = fmt.Sprintf("Your withdrawal of %s could not be completed and has been returned to your wallet.", transaction.Amount)
+		if reason != "" {
+			n.Message += " " + reason
+		}
+	}
+	return notificationService.Create(ctx, n)
+}
+
+// settleWithdrawal closes a pending withdrawal: held money is paid out to the
+// gateway, or returned to the wallet if the transfer failed.
+func settleWithdrawal(ctx context.Context, db *mongo.Database, transaction *models.Transaction, successful bool) error {
+	status := models.StatusSuccess
+	entry := withdrawalEntry(transaction, "Withdrawal paid out",
+		models.LedgerLeg{Account: models.AccountWithdrawalsInTransit, Debit: transaction.Amount},
+		models.LedgerLeg{Account: models.AccountGatewayClearing, Credit: transaction.Amount},
+	)
+	if !successful {
+		status = models.StatusFailed
+		entry = withdrawalEntry(transaction, "Withdrawal reversed",
+			models.LedgerLeg{Account: models.AccountWithdrawalsInTransit, Debit: transaction.Amount},
+			models.LedgerLeg{Account: models.AccountWallet, WalletID: transaction.FromWallet, Credit: transaction.Amount},
+		)
+	}
+	return RunInTransaction(ctx, db, func(sc mongo.SessionContext) error {
+		if err := repository.SettlePendingTransaction(sc, db, transaction.ID, status); err != nil {
+			return err
+		}
+		entry.ID = primitive.NilObjectID
+		return repository.PostJournalEntry(sc, db, entry)
+	})
+}
+
+func withdrawalEntry(transaction *models.Transaction, description string, from, to models.LedgerLeg) *models.JournalEntry {
+	return &models.JournalEntry{
+		TransactionID: transaction.ID,
+		Description:   description,
+		Legs:          []models.LedgerLeg{from, to},
+	}
+}
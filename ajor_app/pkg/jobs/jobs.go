@@ -8,6 +8,7 @@ import (
 	"github.com/Gerard-007/ajor_app/internal/models"
 	"github.com/Gerard-007/ajor_app/internal/repository"
 	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -68,4 +69,76 @@ func ProcessCollections(db *mongo.Database, notificationService *services.Notifi
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// ReconcileLedger finishes journal entries interrupted mid-transfer and checks
+// every wallet balance against its postings.
+func ReconcileLedger(db *mongo.Database) error {
+	ctx := context.Background()
+
+	if err := services.RecoverPendingJournalEntries(ctx, db); err != nil {
+		return err
+	}
+
+	mismatches, err := services.ReconcileAllWallets(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		log.Printf("Wallet %s out of balance: stored %s, ledger %s", m.WalletID.Hex(), m.StoredBalance, m.LedgerBalance)
+	}
+	return nil
+}
+
+// RotateContributions closes group contribution cycles whose deadline has
+// passed and queues the payout for whoever is next in line.
+func RotateContributions(db *mongo.Database, notificationService *services.NotificationService) error {
+	return services.RotateContributions(context.Background(), db, notificationService, time.Now())
+}
+
+// AdvanceCycleSchedules opens the next collection cycle of every running
+// contribution once the current one is due.
+func AdvanceCycleSchedules(db *mongo.Database) error {
+	return services.AdvanceCycleSchedules(context.Background(), db, time.Now())
+}
+
+// SettleDailySavings pays savers back what they deposited in a month that has
+// ended, less their collector's fee.
+func SettleDailySavings(db *mongo.Database, notificationService *services.NotificationService) error {
+	return services.SettleDailySavings(context.Background(), db, notificationService, time.Now())
+}
+
+// RunGoalAutoDebits takes the scheduled debits of savings goals that are due.
+func RunGoalAutoDebits(db *mongo.Database, notificationService *services.NotificationService) error {
+	return services.RunGoalAutoDebits(context.Background(), db, notificationService, time.Now())
+}
+
+// RunStandingOrders auto-debits members' contributions on their due dates and
+// retries debits that failed.
+func RunStandingOrders(db *mongo.Database, notificationService *services.NotificationService) error {
+	return services.RunStandingOrders(context.Background(), db, notificationService, time.Now())
+}
+
+// SyncPendingWithdrawals settles withdrawals whose transfer webhook never
+// arrived by asking the gateway for the transfer's status.
+func SyncPendingWithdrawals(db *mongo.Database, pg payment.PaymentGateway, notificationService *services.NotificationService) error {
+	return services.SyncPendingWithdrawals(context.Background(), db, pg, notificationService, time.Now())
+}
+
+// ProcessWebhookEvents retries webhook events that failed to process when
+// they arrived.
+func ProcessWebhookEvents(db *mongo.Database, pg payment.PaymentGateway, notificationService *services.NotificationService) error {
+	return services.ProcessWebhookEvents(context.Background(), db, pg, notificationService, time.Now())
+}
+
+// ReconcileSettlements checks yesterday's gateway charges against our
+// funding transactions and stores the report for finance.
+func ReconcileSettlements(db *mongo.Database, pg payment.PaymentGateway, notificationService *services.NotificationService) error {
+	return services.RunDailyReconciliation(context.Background(), db, pg, notificationService, time.Now())
+}
+
+// SweepStaleTransactions settles or expires wallet fundings left pending and
+// cancels, escalates or expires payout approvals left pending.
+func SweepStaleTransactions(db *mongo.Database, pg payment.PaymentGateway, notificationService *services.NotificationService, fundingTTL, approvalTTL time.Duration) error {
+	return services.SweepStaleTransactions(context.Background(), db, pg, notificationService, time.Now(), fundingTTL, approvalTTL)
+}
@@ -0,0 +1,211 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+const NGN = "NGN"
+
+// Money is an amount in minor units (kobo for NGN) plus its ISO 4217 currency.
+// It is stored in MongoDB as {amount: <int64 minor units>, currency: "NGN"} and
+// encoded in JSON as a decimal number in major units (e.g. 1500.50) so API
+// clients keep seeing naira.
+type Money struct {
+	Kobo     int64
+	Currency string
+}
+
+func New(kobo int64, currency string) Money {
+	if currency == "" {
+		currency = NGN
+	}
+	return Money{Kobo: kobo, Currency: currency}
+}
+
+// FromKobo returns a naira amount from kobo.
+func FromKobo(kobo int64) Money {
+	return New(kobo, NGN)
+}
+
+// FromNaira returns a whole naira amount.
+func FromNaira(naira int64) Money {
+	return New(naira*100, NGN)
+}
+
+// FromFloat converts a major-unit float, rounding to the nearest kobo. It is
+// only meant for values that arrive as floats, such as legacy documents.
+func FromFloat(amount float64, currency string) Money {
+	return New(int64(math.Round(amount*100)), currency)
+}
+
+// Parse reads a decimal amount in major units ("1500", "1500.5", "1500.50")
+// without going through float64. More than two decimal places is an error.
+func Parse(s string, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+	if !r.IsInt() {
+		return Money{}, fmt.Errorf("amount %q has more than two decimal places", s)
+	}
+	if !r.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q is out of range", s)
+	}
+	return New(r.Num().Int64(), currency), nil
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return NGN
+	}
+	return m.Currency
+}
+
+func (m Money) SameCurrency(o Money) bool {
+	return m.currency() == o.currency()
+}
+
+// mustMatch panics if o is in another currency: adding or comparing naira
+// with dollars is a bug, not something callers can recover from.
+func (m Money) mustMatch(o Money, op string) {
+	if !m.SameCurrency(o) {
+		panic(fmt.Sprintf("money: %s of %s and %s amounts", op, m.currency(), o.currency()))
+	}
+}
+
+// Add panics if o is in another currency.
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o, "Add")
+	return New(m.Kobo+o.Kobo, m.currency())
+}
+
+// Sub panics if o is in another currency.
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o, "Sub")
+	return New(m.Kobo-o.Kobo, m.currency())
+}
+
+func (m Money) Neg() Money {
+	return New(-m.Kobo, m.currency())
+}
+
+// Times multiplies the amount by a whole number, e.g. a contribution by the
+// number of members.
+func (m Money) Times(n int64) Money {
+	return New(m.Kobo*n, m.currency())
+}
+
+func (m Money) Equal(o Money) bool {
+	return m.Kobo == o.Kobo && m.SameCurrency(o)
+}
+
+// LessThan panics if o is in another currency.
+func (m Money) LessThan(o Money) bool {
+	m.mustMatch(o, "LessThan")
+	return m.Kobo < o.Kobo
+}
+
+func (m Money) IsZero() bool {
+	return m.Kobo == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Kobo > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Kobo < 0
+}
+
+// Float64 returns the amount in major units for APIs that insist on floats.
+func (m Money) Float64() float64 {
+	return float64(m.Kobo) / 100
+}
+
+// String formats the amount in major units with two decimals, e.g. "1500.50".
+func (m Money) String() string {
+	kobo := m.Kobo
+	sign := ""
+	if kobo < 0 {
+		sign = "-"
+		kobo = -kobo
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, kobo/100, kobo%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a number or a numeric string in major units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s, m.currency())
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+type bsonMoney struct {
+	Amount   int64  `bson:"amount"`
+	Currency string `bson:"currency"`
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(bsonMoney{Amount: m.Kobo, Currency: m.currency()})
+}
+
+// UnmarshalBSONValue reads the {amount, currency} document and, for documents
+// written before amounts were stored in kobo, a bare naira number.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var v bsonMoney
+		if err := bson.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*m = New(v.Amount, v.Currency)
+	case bsontype.Double:
+		f, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return errors.New("invalid legacy double amount")
+		}
+		*m = FromFloat(f, NGN)
+	case bsontype.Int32:
+		i, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return errors.New("invalid legacy int32 amount")
+		}
+		*m = FromNaira(int64(i))
+	case bsontype.Int64:
+		i, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return errors.New("invalid legacy int64 amount")
+		}
+		*m = FromNaira(i)
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into money", t)
+	}
+	return nil
+}
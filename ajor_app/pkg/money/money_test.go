@@ -0,0 +1,143 @@
+package money_test
+
+import (
+	"testing"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		kobo    int64
+		wantErr bool
+	}{
+		{in: "1500", kobo: 150000},
+		{in: "1500.5", kobo: 150050},
+		{in: "1500.50", kobo: 150050},
+		{in: " 0.07 ", kobo: 7},
+		{in: "1.230", kobo: 123},
+		{in: "-20.25", kobo: -2025},
+		{in: "-0.01", kobo: -1},
+		{in: "0.001", wantErr: true},
+		{in: "19.999", wantErr: true},
+		{in: "92233720368547758.07", kobo: 9223372036854775807},
+		{in: "92233720368547758.08", wantErr: true},
+		{in: "-92233720368547758.08", kobo: -9223372036854775808},
+		{in: "1000000000000000000000", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "12.3.4", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := money.Parse(tt.in, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if want := money.FromKobo(tt.kobo); !got.Equal(want) {
+			t.Errorf("Parse(%q) = %v %s, want %v NGN", tt.in, got, got.Currency, want)
+		}
+	}
+}
+
+func TestFromFloatRounds(t *testing.T) {
+	tests := []struct {
+		in   float64
+		kobo int64
+	}{
+		{in: 0.1 + 0.2, kobo: 30},
+		{in: 19.99, kobo: 1999},
+		{in: 1500.5, kobo: 150050},
+		{in: 0.004, kobo: 0},
+		{in: 0.006, kobo: 1},
+		{in: -5.5, kobo: -550},
+	}
+	for _, tt := range tests {
+		if got := money.FromFloat(tt.in, money.NGN); got.Kobo != tt.kobo {
+			t.Errorf("FromFloat(%v) = %d kobo, want %d", tt.in, got.Kobo, tt.kobo)
+		}
+	}
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+	ngn := money.FromNaira(10)
+	usd := money.New(1000, "USD")
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"Add", func() { ngn.Add(usd) }},
+		{"Sub", func() { usd.Sub(ngn) }},
+		{"LessThan", func() { ngn.LessThan(usd) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of NGN and USD didn't panic", tt.name)
+				}
+			}()
+			tt.fn()
+		})
+	}
+
+	// The zero value is naira
+	if got := (money.Money{}).Add(ngn); !got.Equal(ngn) {
+		t.Errorf("zero value plus %v = %v", ngn, got)
+	}
+	if ngn.Equal(money.New(ngn.Kobo, "USD")) {
+		t.Error("NGN and USD amounts compared equal")
+	}
+}
+
+func TestUnmarshalBSONValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  interface{}
+		want    money.Money
+		wantErr bool
+	}{
+		{name: "document", stored: bson.M{"amount": int64(150050), "currency": "NGN"}, want: money.FromKobo(150050)},
+		{name: "document in USD", stored: bson.M{"amount": int64(999), "currency": "USD"}, want: money.New(999, "USD")},
+		{name: "document without currency", stored: bson.M{"amount": int64(5)}, want: money.FromKobo(5)},
+		{name: "legacy double", stored: 1500.5, want: money.FromKobo(150050)},
+		{name: "legacy double with float error", stored: 0.1 + 0.2, want: money.FromKobo(30)},
+		{name: "legacy negative double", stored: -12.75, want: money.FromKobo(-1275)},
+		{name: "legacy int32", stored: int32(200), want: money.FromNaira(200)},
+		{name: "legacy int64", stored: int64(3000000000), want: money.FromNaira(3000000000)},
+		{name: "null", stored: nil, want: money.Money{}},
+		{name: "string", stored: "1500", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(bson.M{"amount": tt.stored})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc struct {
+				Amount money.Money `bson:"amount"`
+			}
+			err = bson.Unmarshal(raw, &doc)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decoded %v, want an error", doc.Amount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Amount != tt.want {
+				t.Errorf("decoded %+v, want %+v", doc.Amount, tt.want)
+			}
+		})
+	}
+}
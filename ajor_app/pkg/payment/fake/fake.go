@@ -0,0 +1,556 @@
+// Package fake is an in-process PaymentGateway for local development and
+// tests. It stands in for Flutterwave: it keeps virtual accounts, charges and
+// transfers in memory, hands out predictable IDs, and signs the webhooks it
+// sends the way Flutterwave does, so they pass our /webhook/flutterwave
+// endpoint unchanged.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operation names a PaymentGateway method, for injecting failures.
+type Operation string
+
+const (
+	OpCreateVirtualAccount     Operation = "CreateVirtualAccount"
+	OpGetVirtualAccount        Operation = "GetVirtualAccount"
+	OpDeactivateVirtualAccount Operation = "DeactivateVirtualAccount"
+	OpFundVirtualAccount       Operation = "FundVirtualAccount"
+	OpVerifyTransaction        Operation = "VerifyTransaction"
+	OpResolveBankAccount       Operation = "ResolveBankAccount"
+	OpTransfer                 Operation = "Transfer"
+	OpGetTransfer              Operation = "GetTransfer"
+	OpGetTransferByReference   Operation = "GetTransferByReference"
+	OpListCharges              Operation = "ListCharges"
+	OpGetBalance               Operation = "GetBalance"
+)
+
+const bankName = "Fake Bank"
+
+// Gateway is a fake Flutterwave. The zero value is not usable; use New.
+type Gateway struct {
+	// Secret signs webhooks, as the Flutterwave secret key does.
+	Secret string
+	// WebhookURL receives a signed webhook for every completed charge and
+	// transfer. No webhooks are sent if it is empty.
+	WebhookURL string
+	// Client sends webhooks; http.DefaultClient if nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	seq       int
+	latency   time.Duration
+	failNext  map[Operation][]error
+	outages   map[Operation]error
+	accounts  map[string]*account
+	charges   map[string]*charge
+	transfers map[string]*payment.TransferResponse
+	// names holds the bank accounts ResolveBankAccount knows, by bank code
+	// and account number
+	names map[string]string
+}
+
+type account struct {
+	payment.VirtualAccount
+	TxRef  string
+	Email  string
+	Active bool
+}
+
+type charge struct {
+	payment.TransactionResponse
+	FlwRef        string
+	Email         string
+	PaymentType   string
+	AccountID     string
+	AccountNumber string
+	CreatedAt     time.Time
+}
+
+// New returns an empty fake gateway that signs webhooks with secret.
+func New(secret, webhookURL string) *Gateway {
+	return &Gateway{
+		Secret:     secret,
+		WebhookURL: webhookURL,
+		failNext:   make(map[Operation][]error),
+		outages:    make(map[Operation]error),
+		accounts:   make(map[string]*account),
+		charges:    make(map[string]*charge),
+		transfers:  make(map[string]*payment.TransferResponse),
+		names:      make(map[string]string),
+	}
+}
+
+// FailNext makes the next call to op fail with err. Calls queue up, so
+// FailNext twice fails the next two calls. A nil err means the provider is
+// unavailable.
+func (g *Gateway) FailNext(op Operation, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failNext[op] = append(g.failNext[op], orUnavailable(err))
+}
+
+// Fail makes every call to op fail with err until Recover is called. A nil
+// err means the provider is unavailable.
+func (g *Gateway) Fail(op Operation, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.outages[op] = orUnavailable(err)
+}
+
+// Recover undoes Fail and drops any failures queued with FailNext.
+func (g *Gateway) Recover(op Operation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.outages, op)
+	delete(g.failNext, op)
+}
+
+// SetLatency delays every call by d, or until its context is done.
+func (g *Gateway) SetLatency(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.latency = d
+}
+
+// AddBankAccount registers the name on a bank account for
+// ResolveBankAccount. Accounts that aren't registered resolve to a made-up
+// name.
+func (g *Gateway) AddBankAccount(bankCode, accountNumber, accountName string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.names[bankCode+"/"+accountNumber] = accountName
+}
+
+func orUnavailable(err error) error {
+	if err == nil {
+		return fmt.Errorf("%w: fake outage", payment.ErrProviderUnavailable)
+	}
+	return err
+}
+
+// call waits out the latency and returns the failure injected for op, if
+// any.
+func (g *Gateway) call(ctx context.Context, op Operation) error {
+	g.mu.Lock()
+	latency := g.latency
+	err := g.outages[op]
+	if queued := g.failNext[op]; err == nil && len(queued) > 0 {
+		err, g.failNext[op] = queued[0], queued[1:]
+	}
+	g.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", payment.ErrProviderUnavailable, ctx.Err())
+		}
+	}
+	return err
+}
+
+// nextID returns the next ID; callers hold g.mu. IDs are numeric, like
+// Flutterwave's, and count up from 1 across everything the gateway creates.
+func (g *Gateway) nextID() int {
+	g.seq++
+	return g.seq
+}
+
+func (g *Gateway) CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount money.Money) (*payment.VirtualAccount, error) {
+	if err := g.call(ctx, OpCreateVirtualAccount); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := g.nextID()
+	a := &account{
+		VirtualAccount: payment.VirtualAccount{
+			AccountNumber: fmt.Sprintf("99%08d", id),
+			AccountID:     fmt.Sprintf("URF_FAKE_%d", id),
+			BankName:      bankName,
+		},
+		TxRef:  fmt.Sprintf("ajor-%s-%d", ownerID.Hex(), id),
+		Email:  email,
+		Active: true,
+	}
+	g.accounts[a.AccountID] = a
+	va := a.VirtualAccount
+	return &va, nil
+}
+
+func (g *Gateway) GetVirtualAccount(ctx context.Context, accountID string) (*payment.VirtualAccount, error) {
+	if err := g.call(ctx, OpGetVirtualAccount); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	a, ok := g.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("virtual account %s not found", accountID)
+	}
+	va := a.VirtualAccount
+	return &va, nil
+}
+
+func (g *Gateway) DeactivateVirtualAccount(ctx context.Context, accountID string) error {
+	if err := g.call(ctx, OpDeactivateVirtualAccount); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	a, ok := g.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("virtual account %s not found", accountID)
+	}
+	a.Active = false
+	return nil
+}
+
+// FundVirtualAccount starts a payment that stays pending until PayCharge is
+// called, as a real one waits for the customer to pay.
+func (g *Gateway) FundVirtualAccount(ctx context.Context, accountID string, req payment.FundingRequest) (*payment.TransactionResponse, error) {
+	if err := g.call(ctx, OpFundVirtualAccount); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	a, ok := g.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("virtual account %s not found", accountID)
+	}
+	id := g.nextID()
+	c := &charge{
+		TransactionResponse: payment.TransactionResponse{
+			TransactionID: strconv.Itoa(id),
+			TxRef:         req.TxRef,
+			Status:        payment.ChargePending,
+			Amount:        req.Amount,
+		},
+		FlwRef:        fmt.Sprintf("FLW-FAKE-%d", id),
+		Email:         req.Email,
+		PaymentType:   "card",
+		AccountID:     a.AccountID,
+		AccountNumber: a.AccountNumber,
+		CreatedAt:     time.Now(),
+	}
+	g.charges[c.TransactionID] = c
+	response := c.TransactionResponse
+	return &response, nil
+}
+
+func (g *Gateway) VerifyTransaction(ctx context.Context, transactionID string) (*payment.TransactionResponse, error) {
+	if err := g.call(ctx, OpVerifyTransaction); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c, ok := g.charges[transactionID]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", transactionID)
+	}
+	response := c.TransactionResponse
+	return &response, nil
+}
+
+func (g *Gateway) ResolveBankAccount(ctx context.Context, bankCode, accountNumber string) (*payment.BankAccountDetails, error) {
+	if err := g.call(ctx, OpResolveBankAccount); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	name, ok := g.names[bankCode+"/"+accountNumber]
+	if !ok {
+		name = "FAKE ACCOUNT " + accountNumber
+	}
+	return &payment.BankAccountDetails{
+		BankCode:      bankCode,
+		AccountNumber: accountNumber,
+		AccountName:   name,
+	}, nil
+}
+
+// Transfer queues a transfer, which stays pending until CompleteTransfer is
+// called.
+func (g *Gateway) Transfer(ctx context.Context, req payment.TransferRequest) (*payment.TransferResponse, error) {
+	if err := g.call(ctx, OpTransfer); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	transfer := &payment.TransferResponse{
+		TransferID: strconv.Itoa(g.nextID()),
+		Reference:  req.Reference,
+		Status:     payment.TransferPending,
+		Amount:     req.Amount,
+		Fee:        money.New(0, req.Amount.Currency),
+		Message:    "Transfer Queued Successfully",
+	}
+	g.transfers[transfer.TransferID] = transfer
+	response := *transfer
+	return &response, nil
+}
+
+func (g *Gateway) GetTransfer(ctx context.Context, transferID string) (*payment.TransferResponse, error) {
+	if err := g.call(ctx, OpGetTransfer); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	transfer, ok := g.transfers[transferID]
+	if !ok {
+		return nil, fmt.Errorf("transfer %s not found", transferID)
+	}
+	response := *transfer
+	return &response, nil
+}
+
+func (g *Gateway) GetTransferByReference(ctx context.Context, reference string) (*payment.TransferResponse, error) {
+	if err := g.call(ctx, OpGetTransferByReference); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, transfer := range g.transfers {
+		if transfer.Reference == reference {
+			response := *transfer
+			return &response, nil
+		}
+	}
+	return nil, fmt.Errorf("transfer %s: %w", reference, payment.ErrNotFound)
+}
+
+// ListCharges returns the charges created from from up to to, oldest first.
+func (g *Gateway) ListCharges(ctx context.Context, from, to time.Time) ([]payment.Charge, error) {
+	if err := g.call(ctx, OpListCharges); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var charges []payment.Charge
+	for _, c := range g.charges {
+		if c.CreatedAt.Before(from) || !c.CreatedAt.Before(to) {
+			continue
+		}
+		charges = append(charges, payment.Charge{
+			ID:        c.TransactionID,
+			TxRef:     c.TxRef,
+			Status:    c.Status,
+			Amount:    c.Amount,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+	sort.Slice(charges, func(i, j int) bool { return charges[i].CreatedAt.Before(charges[j].CreatedAt) })
+	return charges, nil
+}
+
+// GetBalance returns the successful charges in a currency less the
+// transfers paid out of it, fees included.
+func (g *Gateway) GetBalance(ctx context.Context, currency string) (money.Money, error) {
+	if err := g.call(ctx, OpGetBalance); err != nil {
+		return money.Money{}, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	balance := money.New(0, currency)
+	for _, c := range g.charges {
+		if c.Status == payment.ChargeSuccessful && c.Amount.SameCurrency(balance) {
+			balance = balance.Add(c.Amount)
+		}
+	}
+	for _, t := range g.transfers {
+		if t.Status == payment.TransferSuccessful && t.Amount.SameCurrency(balance) {
+			balance = balance.Sub(t.Amount).Sub(t.Fee)
+		}
+	}
+	return balance, nil
+}
+
+// VerifyWebhookSignature checks webhooks the way FlutterwaveGateway does, so
+// the fake can be registered in its place.
+func (g *Gateway) VerifyWebhookSignature(header http.Header, body []byte) error {
+	signature := header.Get("verif-hash")
+	if signature == "" {
+		return errors.New("missing verif-hash header")
+	}
+	if !hmac.Equal([]byte(signature), []byte(payment.SignFlutterwaveWebhook(g.Secret, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// PayCharge completes a pending payment started with FundVirtualAccount and
+// sends its charge.completed webhook.
+func (g *Gateway) PayCharge(ctx context.Context, transactionID string, successful bool) error {
+	g.mu.Lock()
+	c, ok := g.charges[transactionID]
+	if !ok {
+		g.mu.Unlock()
+		return fmt.Errorf("transaction %s not found", transactionID)
+	}
+	if c.Status != payment.ChargePending {
+		g.mu.Unlock()
+		return fmt.Errorf("transaction %s is already %s", transactionID, c.Status)
+	}
+	c.Status = payment.ChargeFailed
+	if successful {
+		c.Status = payment.ChargeSuccessful
+	}
+	event := chargeEvent(c)
+	g.mu.Unlock()
+	return g.SendWebhook(ctx, event)
+}
+
+// SimulateIncomingTransfer pays amount into a virtual account by bank
+// transfer and sends the charge.completed webhook for it. Like Flutterwave,
+// the webhook carries the tx_ref the virtual account was created with. The
+// charge is kept even if the webhook can't be delivered.
+func (g *Gateway) SimulateIncomingTransfer(ctx context.Context, accountNumber string, amount money.Money) (*payment.TransactionResponse, error) {
+	g.mu.Lock()
+	var a *account
+	for _, candidate := range g.accounts {
+		if candidate.AccountNumber == accountNumber {
+			a = candidate
+			break
+		}
+	}
+	if a == nil || !a.Active {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("no active virtual account %s", accountNumber)
+	}
+	id := g.nextID()
+	c := &charge{
+		TransactionResponse: payment.TransactionResponse{
+			TransactionID: strconv.Itoa(id),
+			TxRef:         a.TxRef,
+			Status:        payment.ChargeSuccessful,
+			Amount:        amount,
+		},
+		FlwRef:        fmt.Sprintf("FLW-FAKE-%d", id),
+		Email:         a.Email,
+		PaymentType:   "bank_transfer",
+		AccountID:     a.AccountID,
+		AccountNumber: a.AccountNumber,
+		CreatedAt:     time.Now(),
+	}
+	g.charges[c.TransactionID] = c
+	event := chargeEvent(c)
+	response := c.TransactionResponse
+	g.mu.Unlock()
+	return &response, g.SendWebhook(ctx, event)
+}
+
+// CompleteTransfer finishes a pending transfer and sends its
+// transfer.completed webhook. message explains a failure.
+func (g *Gateway) CompleteTransfer(ctx context.Context, transferID string, successful bool, message string) error {
+	g.mu.Lock()
+	transfer, ok := g.transfers[transferID]
+	if !ok {
+		g.mu.Unlock()
+		return fmt.Errorf("transfer %s not found", transferID)
+	}
+	if transfer.Status.IsFinal() {
+		g.mu.Unlock()
+		return fmt.Errorf("transfer %s is already %s", transferID, transfer.Status)
+	}
+	transfer.Status = payment.TransferFailed
+	if successful {
+		transfer.Status = payment.TransferSuccessful
+	}
+	transfer.Message = message
+	event := transferEvent(transfer)
+	g.mu.Unlock()
+	return g.SendWebhook(ctx, event)
+}
+
+// Event is a webhook payload in Flutterwave's shape.
+type Event struct {
+	Event string                 `json:"event"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// chargeEvent uses Flutterwave's charge statuses.
+func chargeEvent(c *charge) Event {
+	status := "failed"
+	if c.Status == payment.ChargeSuccessful {
+		status = "successful"
+	}
+	return Event{Event: "charge.completed", Data: map[string]interface{}{
+		"id":             json.Number(c.TransactionID),
+		"tx_ref":         c.TxRef,
+		"flw_ref":        c.FlwRef,
+		"amount":         c.Amount,
+		"currency":       c.Amount.Currency,
+		"status":         status,
+		"payment_type":   c.PaymentType,
+		"order_ref":      c.AccountID,
+		"account_number": c.AccountNumber,
+		"customer":       map[string]string{"email": c.Email},
+	}}
+}
+
+// transferEvent uses Flutterwave's upper-case transfer statuses.
+func transferEvent(t *payment.TransferResponse) Event {
+	status := "FAILED"
+	if t.Status == payment.TransferSuccessful {
+		status = "SUCCESSFUL"
+	}
+	return Event{Event: "transfer.completed", Data: map[string]interface{}{
+		"id":               json.Number(t.TransferID),
+		"reference":        t.Reference,
+		"amount":           t.Amount,
+		"fee":              t.Fee,
+		"currency":         t.Amount.Currency,
+		"status":           status,
+		"complete_message": t.Message,
+	}}
+}
+
+// SendWebhook posts a signed event to WebhookURL. It does nothing if
+// WebhookURL is empty, and fails if the endpoint doesn't answer 2xx.
+func (g *Gateway) SendWebhook(ctx context.Context, event Event) error {
+	if g.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("verif-hash", payment.SignFlutterwaveWebhook(g.Secret, body))
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %d", event.Event, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+)
+
+// Registry returns a payment registry with the gateway in Flutterwave's
+// place, so IDs and webhooks are handled exactly as Flutterwave's are.
+func (g *Gateway) Registry() *payment.Registry {
+	// A registry with a single configured provider can't fail to build
+	registry, _ := payment.NewRegistry(
+		map[payment.Provider]payment.PaymentGateway{payment.ProviderFlutterwave: g},
+		[]payment.Provider{payment.ProviderFlutterwave},
+		payment.ProviderFlutterwave,
+	)
+	return registry
+}
+
+// Handler lets a developer play the customer and the bank against a running
+// server:
+//
+//	POST /virtual-accounts/{number}/transfers  {"amount": 5000, "currency": "NGN"}
+//	POST /charges/{id}/pay                     {"successful": true}
+//	POST /transfers/{id}/complete              {"successful": false, "message": "..."}
+//
+// IDs may be given as stored, with their "flutterwave:" prefix.
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /virtual-accounts/{number}/transfers", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Amount   json.Number `json:"amount"`
+			Currency string      `json:"currency"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		amount, err := money.Parse(req.Amount.String(), req.Currency)
+		if err != nil || !amount.IsPositive() {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid amount"})
+			return
+		}
+		charge, err := g.SimulateIncomingTransfer(r.Context(), r.PathValue("number"), amount)
+		if charge == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		response := map[string]interface{}{"transaction_id": charge.TransactionID, "amount": charge.Amount}
+		if err != nil {
+			response["webhook_error"] = err.Error()
+		}
+		writeJSON(w, http.StatusCreated, response)
+	})
+	mux.HandleFunc("POST /charges/{id}/pay", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Successful bool `json:"successful"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		if err := g.PayCharge(r.Context(), rawID(r.PathValue("id")), req.Successful); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "completed"})
+	})
+	mux.HandleFunc("POST /transfers/{id}/complete", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Successful bool   `json:"successful"`
+			Message    string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+			return
+		}
+		if err := g.CompleteTransfer(r.Context(), rawID(r.PathValue("id")), req.Successful, req.Message); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "completed"})
+	})
+	return mux
+}
+
+// rawID strips the provider prefix the registry adds to IDs.
+func rawID(id string) string {
+	return strings.TrimPrefix(id, string(payment.ProviderFlutterwave)+":")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -3,15 +3,20 @@ package payment
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -28,7 +33,7 @@ type createVirtualAccountRequest struct {
 	PhoneNumber  string   `json:"phone"`
 	BVN          string   `json:"bvn,omitempty"`
 	TxRef        string   `json:"tx_ref"`
-	Amount       *float64 `json:"amount,omitempty"`
+	Amount       *money.Money `json:"amount,omitempty"`
 }
 
 type createVirtualAccountResponse struct {
@@ -56,8 +61,8 @@ type deactivateVirtualAccountRequest struct {
 }
 
 type fundVirtualAccountRequest struct {
-	TxRef       string  `json:"tx_ref"`
-	Amount      float64 `json:"amount"`
+	TxRef       string      `json:"tx_ref"`
+	Amount      money.Money `json:"amount"`
 	Currency    string  `json:"currency"`
 	Email       string  `json:"email"`
 	PhoneNumber string  `json:"phone_number"`
@@ -80,12 +85,109 @@ type verifyTransactionResponse struct {
 	Data    struct {
 		ID            int     `json:"id"`
 		TxRef         string  `json:"tx_ref"`
-		Amount        float64 `json:"amount"`
+		Amount        money.Money `json:"amount"`
 		Currency      string  `json:"currency"`
 		Status        string  `json:"status"`
 	} `json:"data"`
 }
 
+type listTransactionsResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    []struct {
+		ID        int         `json:"id"`
+		TxRef     string      `json:"tx_ref"`
+		Amount    money.Money `json:"amount"`
+		Currency  string      `json:"currency"`
+		Status    string      `json:"status"`
+		CreatedAt time.Time   `json:"created_at"`
+	} `json:"data"`
+	Meta struct {
+		PageInfo struct {
+			TotalPages int `json:"total_pages"`
+		} `json:"page_info"`
+	} `json:"meta"`
+}
+
+type balanceResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Currency         string      `json:"currency"`
+		AvailableBalance money.Money `json:"available_balance"`
+	} `json:"data"`
+}
+
+type resolveAccountRequest struct {
+	AccountNumber string `json:"account_number"`
+	AccountBank   string `json:"account_bank"`
+}
+
+type resolveAccountResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		AccountNumber string `json:"account_number"`
+		AccountName   string `json:"account_name"`
+	} `json:"data"`
+}
+
+type transferRequest struct {
+	AccountBank   string      `json:"account_bank"`
+	AccountNumber string      `json:"account_number"`
+	Amount        money.Money `json:"amount"`
+	Currency      string      `json:"currency"`
+	DebitCurrency string      `json:"debit_currency"`
+	Narration     string      `json:"narration"`
+	Reference     string      `json:"reference"`
+}
+
+type flutterwaveTransfer struct {
+	ID              int         `json:"id"`
+	AccountNumber   string      `json:"account_number"`
+	BankCode        string      `json:"bank_code"`
+	FullName        string      `json:"full_name"`
+	Currency        string      `json:"currency"`
+	Amount          money.Money `json:"amount"`
+	Fee             money.Money `json:"fee"`
+	Status          string      `json:"status"`
+	Reference       string      `json:"reference"`
+	Narration       string      `json:"narration"`
+	CompleteMessage string      `json:"complete_message"`
+}
+
+type transferResponse struct {
+	Status  string             `json:"status"`
+	Message string             `json:"message"`
+	Data    flutterwaveTransfer `json:"data"`
+}
+
+type transfersResponse struct {
+	Status  string                `json:"status"`
+	Message string                `json:"message"`
+	Data    []flutterwaveTransfer `json:"data"`
+}
+
+// toTransferResponse maps Flutterwave's NEW/PENDING/SUCCESSFUL/FAILED onto
+// our transfer statuses.
+func (t flutterwaveTransfer) toTransferResponse() *TransferResponse {
+	status := TransferPending
+	switch t.Status {
+	case "SUCCESSFUL":
+		status = TransferSuccessful
+	case "FAILED":
+		status = TransferFailed
+	}
+	return &TransferResponse{
+		TransferID: fmt.Sprintf("%d", t.ID),
+		Reference:  t.Reference,
+		Status:     status,
+		Amount:     money.New(t.Amount.Kobo, t.Currency),
+		Fee:        money.New(t.Fee.Kobo, t.Currency),
+		Message:    t.CompleteMessage,
+	}
+}
+
 func NewFlutterwaveGateway() *FlutterwaveGateway {
 	apiKey := os.Getenv("FLW_SECRET_KEY")
 	if apiKey == "" {
@@ -98,12 +200,12 @@ func NewFlutterwaveGateway() *FlutterwaveGateway {
 	}
 }
 
-func (f *FlutterwaveGateway) CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount float64) (*VirtualAccount, error) {
+func (f *FlutterwaveGateway) CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount money.Money) (*VirtualAccount, error) {
 	url := f.BaseURL + "/virtual-account-numbers"
 	txRef := fmt.Sprintf("ajor-%s-%d", ownerID.Hex(), time.Now().Unix())
 
-	var amountPtr *float64
-	if amount > 0 {
+	var amountPtr *money.Money
+	if amount.IsPositive() {
 		amountPtr = &amount
 	}
 
@@ -134,7 +236,7 @@ func (f *FlutterwaveGateway) CreateVirtualAccount(ctx context.Context, ownerID p
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -144,7 +246,7 @@ func (f *FlutterwaveGateway) CreateVirtualAccount(ctx context.Context, ownerID p
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp.StatusCode, respBody)
 	}
 
 	var response createVirtualAccountResponse
@@ -177,7 +279,7 @@ func (f *FlutterwaveGateway) GetVirtualAccount(ctx context.Context, accountID st
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -187,7 +289,7 @@ func (f *FlutterwaveGateway) GetVirtualAccount(ctx context.Context, accountID st
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp.StatusCode, respBody)
 	}
 
 	var response getVirtualAccountResponse
@@ -226,7 +328,7 @@ func (f *FlutterwaveGateway) DeactivateVirtualAccount(ctx context.Context, accou
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -236,7 +338,7 @@ func (f *FlutterwaveGateway) DeactivateVirtualAccount(ctx context.Context, accou
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+		return statusError(resp.StatusCode, respBody)
 	}
 
 	var response struct {
@@ -283,7 +385,7 @@ func (f *FlutterwaveGateway) FundVirtualAccount(ctx context.Context, accountID s
 
 	resp, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -293,7 +395,7 @@ func (f *FlutterwaveGateway) FundVirtualAccount(ctx context.Context, accountID s
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp.StatusCode, respBody)
 	}
 
 	var response fundVirtualAccountResponse
@@ -307,7 +409,8 @@ func (f *FlutterwaveGateway) FundVirtualAccount(ctx context.Context, accountID s
 
 	return &TransactionResponse{
 		TransactionID: response.Data.TransactionID,
-		Status:        "pending",
+		TxRef:         req.TxRef,
+		Status:        ChargePending,
 		Amount:        req.Amount,
 	}, nil
 }
@@ -326,7 +429,7 @@ func (f *FlutterwaveGateway) VerifyTransaction(ctx context.Context, transactionI
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -336,7 +439,7 @@ func (f *FlutterwaveGateway) VerifyTransaction(ctx context.Context, transactionI
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp.StatusCode, respBody)
 	}
 
 	var response verifyTransactionResponse
@@ -350,13 +453,330 @@ func (f *FlutterwaveGateway) VerifyTransaction(ctx context.Context, transactionI
 
 	return &TransactionResponse{
 		TransactionID: fmt.Sprintf("%d", response.Data.ID),
-		Status:        response.Data.Status,
-		Amount:        response.Data.Amount,
+		TxRef:         response.Data.TxRef,
+		Status:        flutterwaveChargeStatus(response.Data.Status),
+		Amount:        money.New(response.Data.Amount.Kobo, response.Data.Currency),
+	}, nil
+}
+
+// flutterwaveChargeStatus maps Flutterwave's charge statuses onto ours.
+func flutterwaveChargeStatus(status string) string {
+	switch status {
+	case "successful":
+		return ChargeSuccessful
+	case "failed":
+		return ChargeFailed
+	}
+	return ChargePending
+}
+
+// ListCharges pages through the transactions Flutterwave has on the days
+// from and to fall on, and keeps those created in between.
+func (f *FlutterwaveGateway) ListCharges(ctx context.Context, from, to time.Time) ([]Charge, error) {
+	var charges []Charge
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/transactions?from=%s&to=%s&page=%d", f.BaseURL, from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"), page)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+f.APIKey)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError(resp.StatusCode, respBody)
+		}
+
+		var response listTransactionsResponse
+		if err := json.Unmarshal(respBody, &response); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		if response.Status != "success" {
+			return nil, fmt.Errorf("failed to list transactions: %s", response.Message)
+		}
+
+		for _, t := range response.Data {
+			if t.CreatedAt.Before(from) || !t.CreatedAt.Before(to) {
+				continue
+			}
+			charges = append(charges, Charge{
+				ID:        fmt.Sprintf("%d", t.ID),
+				TxRef:     t.TxRef,
+				Status:    flutterwaveChargeStatus(t.Status),
+				Amount:    money.New(t.Amount.Kobo, t.Currency),
+				CreatedAt: t.CreatedAt,
+			})
+		}
+		if page >= response.Meta.PageInfo.TotalPages {
+			return charges, nil
+		}
+	}
+}
+
+// GetBalance returns the available balance of our Flutterwave wallet.
+func (f *FlutterwaveGateway) GetBalance(ctx context.Context, currency string) (money.Money, error) {
+	url := fmt.Sprintf("%s/balances/%s", f.BaseURL, currency)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+f.APIKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return money.Money{}, statusError(resp.StatusCode, respBody)
+	}
+
+	var response balanceResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return money.Money{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Status != "success" {
+		return money.Money{}, fmt.Errorf("failed to get balance: %s", response.Message)
+	}
+
+	return money.New(response.Data.AvailableBalance.Kobo, currency), nil
+}
+
+func (f *FlutterwaveGateway) ResolveBankAccount(ctx context.Context, bankCode, accountNumber string) (*BankAccountDetails, error) {
+	url := f.BaseURL + "/accounts/resolve"
+
+	payload := resolveAccountRequest{
+		AccountNumber: accountNumber,
+		AccountBank:   bankCode,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+f.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, respBody)
+	}
+
+	var response resolveAccountResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, fmt.Errorf("failed to resolve bank account: %s", response.Message)
+	}
+
+	return &BankAccountDetails{
+		BankCode:      bankCode,
+		AccountNumber: response.Data.AccountNumber,
+		AccountName:   response.Data.AccountName,
 	}, nil
 }
 
-func (f *FlutterwaveGateway) Transfer(ctx context.Context, fromWalletID, toWalletID primitive.ObjectID, amount float64, reference string) error {
-	// Placeholder: Implement Flutterwave transfer API
-	// https://developer.flutterwave.com/reference/endpoints/transfers
-	return errors.New("transfer not implemented")
-}
\ No newline at end of file
+// Transfer queues a payout to a bank account. Flutterwave reports the outcome
+// later on the transfer.completed webhook.
+func (f *FlutterwaveGateway) Transfer(ctx context.Context, req TransferRequest) (*TransferResponse, error) {
+	url := f.BaseURL + "/transfers"
+
+	payload := transferRequest{
+		AccountBank:   req.BankCode,
+		AccountNumber: req.AccountNumber,
+		Amount:        req.Amount,
+		Currency:      req.Amount.Currency,
+		DebitCurrency: req.Amount.Currency,
+		Narration:     req.Narration,
+		Reference:     req.Reference,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+f.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, respBody)
+	}
+
+	var response transferResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, fmt.Errorf("failed to initiate transfer: %s", response.Message)
+	}
+
+	return response.Data.toTransferResponse(), nil
+}
+
+// GetTransfer fetches the current status of a transfer, for checking a
+// webhook's claim or following up on one that never arrived.
+func (f *FlutterwaveGateway) GetTransfer(ctx context.Context, transferID string) (*TransferResponse, error) {
+	url := fmt.Sprintf("%s/transfers/%s", f.BaseURL, transferID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+f.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, respBody)
+	}
+
+	var response transferResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, fmt.Errorf("failed to get transfer: %s", response.Message)
+	}
+
+	return response.Data.toTransferResponse(), nil
+}
+
+// GetTransferByReference searches the transfers for the one made with our
+// reference.
+func (f *FlutterwaveGateway) GetTransferByReference(ctx context.Context, reference string) (*TransferResponse, error) {
+	endpoint := fmt.Sprintf("%s/transfers?reference=%s", f.BaseURL, url.QueryEscape(reference))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+f.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, respBody)
+	}
+
+	var response transfersResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if response.Status != "success" {
+		return nil, fmt.Errorf("failed to list transfers: %s", response.Message)
+	}
+
+	for _, transfer := range response.Data {
+		if transfer.Reference == reference {
+			return transfer.toTransferResponse(), nil
+		}
+	}
+	return nil, fmt.Errorf("transfer %s: %w", reference, ErrNotFound)
+}
+
+// VerifyWebhookSignature checks the verif-hash header, the hex HMAC-SHA256 of
+// the body keyed with our secret key.
+func (f *FlutterwaveGateway) VerifyWebhookSignature(header http.Header, body []byte) error {
+	signature := header.Get("verif-hash")
+	if signature == "" {
+		return errors.New("missing signature header")
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignFlutterwaveWebhook(f.APIKey, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// SignFlutterwaveWebhook returns the verif-hash of a webhook body.
+func SignFlutterwaveWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -2,10 +2,41 @@ package payment
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/Gerard-007/ajor_app/pkg/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrProviderUnavailable marks errors where the provider couldn't be reached
+// or failed on its side, as opposed to rejecting the request.
+var ErrProviderUnavailable = errors.New("payment provider unavailable")
+
+// ErrRequestRejected marks errors where the provider answered and refused the
+// request, so nothing was done with it.
+var ErrRequestRejected = errors.New("payment request rejected")
+
+// ErrNotFound marks lookups of something the provider has no record of.
+var ErrNotFound = errors.New("not found at payment provider")
+
+// statusError describes a non-200 response. 5xx responses mean the provider
+// is having trouble rather than rejecting the request. A timeout or conflict
+// doesn't say whether the request was acted on, so it is neither.
+func statusError(statusCode int, body []byte) error {
+	switch {
+	case statusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: unexpected status code: %d, body: %s", ErrProviderUnavailable, statusCode, string(body))
+	case statusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %w: unexpected status code: %d, body: %s", ErrRequestRejected, ErrNotFound, statusCode, string(body))
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusConflict:
+		return fmt.Errorf("unexpected status code: %d, body: %s", statusCode, string(body))
+	}
+	return fmt.Errorf("%w: unexpected status code: %d, body: %s", ErrRequestRejected, statusCode, string(body))
+}
+
 type VirtualAccount struct {
 	AccountNumber string
 	AccountID     string
@@ -14,7 +45,7 @@ type VirtualAccount struct {
 
 type FundingRequest struct {
 	Email        string
-	Amount       float64
+	Amount       money.Money
 	TxRef        string
 	Currency     string
 	IsPermanent  bool
@@ -22,16 +53,99 @@ type FundingRequest struct {
 	PhoneNumber  string
 }
 
+// Charge statuses, as VerifyTransaction reports them whatever the provider
+// calls them.
+const (
+	ChargePending    = "pending"
+	ChargeSuccessful = "success"
+	ChargeFailed     = "failed"
+)
+
+// TransactionResponse is the gateway's view of a charge. TxRef is the
+// reference the charge was made with.
 type TransactionResponse struct {
 	TransactionID string
+	TxRef         string
 	Status        string
-	Amount        float64
+	Amount        money.Money
+}
+
+// Charge is a payment into the platform as the gateway lists it. ID is the
+// gateway's own ID for the charge, which inbound bank transfers are recorded
+// under; TxRef is the reference it was made with.
+type Charge struct {
+	ID        string
+	TxRef     string
+	Status    string
+	Amount    money.Money
+	CreatedAt time.Time
+}
+
+// BankAccountDetails is a bank account as the bank knows it, used to show a
+// user whose account they are about to pay before they add it.
+type BankAccountDetails struct {
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+}
+
+// TransferRequest pays money out of the platform to a bank account. Reference
+// is ours and comes back on the transfer webhook.
+type TransferRequest struct {
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+	Amount        money.Money
+	Narration     string
+	Reference     string
+}
+
+type TransferStatus string
+
+// Transfers start pending and end successful or failed; the gateway reports
+// the outcome asynchronously.
+const (
+	TransferPending    TransferStatus = "pending"
+	TransferSuccessful TransferStatus = "successful"
+	TransferFailed     TransferStatus = "failed"
+)
+
+// TransferResponse is the gateway's view of a transfer. Message explains a
+// failure when the gateway gives a reason.
+type TransferResponse struct {
+	TransferID string
+	Reference  string
+	Status     TransferStatus
+	Amount     money.Money
+	Fee        money.Money
+	Message    string
+}
+
+func (s TransferStatus) IsFinal() bool {
+	return s == TransferSuccessful || s == TransferFailed
 }
 
 type PaymentGateway interface {
-	CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount float64) (*VirtualAccount, error)
+	CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount money.Money) (*VirtualAccount, error)
 	GetVirtualAccount(ctx context.Context, accountID string) (*VirtualAccount, error)
 	DeactivateVirtualAccount(ctx context.Context, accountID string) error
 	FundVirtualAccount(ctx context.Context, accountID string, req FundingRequest) (*TransactionResponse, error)
 	VerifyTransaction(ctx context.Context, transactionID string) (*TransactionResponse, error)
-}
\ No newline at end of file
+	ResolveBankAccount(ctx context.Context, bankCode, accountNumber string) (*BankAccountDetails, error)
+	Transfer(ctx context.Context, req TransferRequest) (*TransferResponse, error)
+	GetTransfer(ctx context.Context, transferID string) (*TransferResponse, error)
+	// GetTransferByReference finds a transfer by the reference it was
+	// requested with, for when its ID never came back. It fails with
+	// ErrNotFound if the provider has no such transfer.
+	GetTransferByReference(ctx context.Context, reference string) (*TransferResponse, error)
+	// ListCharges returns the charges created from from up to to, whatever
+	// their status.
+	ListCharges(ctx context.Context, from, to time.Time) ([]Charge, error)
+	// GetBalance returns the money the gateway holds for us in a currency.
+	GetBalance(ctx context.Context, currency string) (money.Money, error)
+}
+
+// WebhookVerifier checks that a webhook request was signed by the provider.
+type WebhookVerifier interface {
+	VerifyWebhookSignature(header http.Header, body []byte) error
+}
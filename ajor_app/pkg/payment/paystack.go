@@ -0,0 +1,387 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PaystackGateway implements PaymentGateway with Paystack. Unlike
+// Flutterwave, Paystack takes and returns amounts in kobo.
+type PaystackGateway struct {
+	SecretKey string
+	BaseURL   string
+	// PreferredBank is the bank slug dedicated virtual accounts are opened
+	// with, e.g. "wema-bank".
+	PreferredBank string
+}
+
+// paystackResponse is the envelope of every Paystack response.
+type paystackResponse struct {
+	Status  bool            `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type paystackCustomer struct {
+	CustomerCode string `json:"customer_code"`
+}
+
+type paystackDedicatedAccount struct {
+	ID            int    `json:"id"`
+	AccountNumber string `json:"account_number"`
+	Bank          struct {
+		Name string `json:"name"`
+	} `json:"bank"`
+}
+
+type paystackTransaction struct {
+	ID               int       `json:"id"`
+	Reference        string    `json:"reference"`
+	Amount           int64     `json:"amount"`
+	Currency         string    `json:"currency"`
+	Status           string    `json:"status"`
+	AuthorizationURL string    `json:"authorization_url"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type paystackBalance struct {
+	Currency string `json:"currency"`
+	Balance  int64  `json:"balance"`
+}
+
+// paystackPageSize is how many transactions ListCharges asks for at a time.
+const paystackPageSize = 100
+
+type paystackResolvedAccount struct {
+	AccountNumber string `json:"account_number"`
+	AccountName   string `json:"account_name"`
+}
+
+type paystackRecipient struct {
+	RecipientCode string `json:"recipient_code"`
+}
+
+type paystackTransfer struct {
+	ID        int    `json:"id"`
+	Reference string `json:"reference"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Status    string `json:"status"`
+}
+
+func NewPaystackGateway(secretKey string) *PaystackGateway {
+	preferredBank := os.Getenv("PAYSTACK_PREFERRED_BANK")
+	if preferredBank == "" {
+		preferredBank = "wema-bank"
+	}
+	return &PaystackGateway{
+		SecretKey:     secretKey,
+		BaseURL:       "https://api.paystack.co",
+		PreferredBank: preferredBank,
+	}
+}
+
+// do sends a request to Paystack and decodes the data of a successful
+// response into out.
+func (p *PaystackGateway) do(ctx context.Context, method, path string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.SecretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to send request: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError(resp.StatusCode, respBody)
+	}
+
+	var response paystackResponse
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !response.Status {
+		return errors.New(response.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// CreateVirtualAccount opens a dedicated virtual account for a Paystack
+// customer, creating the customer first. Dedicated accounts are always
+// permanent and take any amount, so isPermanent and amount are ignored.
+func (p *PaystackGateway) CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount money.Money) (*VirtualAccount, error) {
+	var customer paystackCustomer
+	err := p.do(ctx, http.MethodPost, "/customer", map[string]interface{}{
+		"email":    email,
+		"phone":    phone,
+		"metadata": map[string]string{"owner_id": ownerID.Hex()},
+	}, &customer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer: %w", err)
+	}
+
+	var account paystackDedicatedAccount
+	err = p.do(ctx, http.MethodPost, "/dedicated_account", map[string]string{
+		"customer":       customer.CustomerCode,
+		"preferred_bank": p.PreferredBank,
+	}, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create virtual account: %w", err)
+	}
+
+	return &VirtualAccount{
+		AccountNumber: account.AccountNumber,
+		BankName:      account.Bank.Name,
+		AccountID:     strconv.Itoa(account.ID),
+	}, nil
+}
+
+func (p *PaystackGateway) GetVirtualAccount(ctx context.Context, accountID string) (*VirtualAccount, error) {
+	var account paystackDedicatedAccount
+	if err := p.do(ctx, http.MethodGet, "/dedicated_account/"+url.PathEscape(accountID), nil, &account); err != nil {
+		return nil, fmt.Errorf("failed to get virtual account: %w", err)
+	}
+	return &VirtualAccount{
+		AccountNumber: account.AccountNumber,
+		BankName:      account.Bank.Name,
+		AccountID:     strconv.Itoa(account.ID),
+	}, nil
+}
+
+func (p *PaystackGateway) DeactivateVirtualAccount(ctx context.Context, accountID string) error {
+	if err := p.do(ctx, http.MethodDelete, "/dedicated_account/"+url.PathEscape(accountID), nil, nil); err != nil {
+		return fmt.Errorf("failed to deactivate virtual account: %w", err)
+	}
+	return nil
+}
+
+// FundVirtualAccount starts a card or bank payment. The returned
+// TransactionID is our reference, which is what Paystack verifies by.
+func (p *PaystackGateway) FundVirtualAccount(ctx context.Context, accountID string, req FundingRequest) (*TransactionResponse, error) {
+	var transaction paystackTransaction
+	err := p.do(ctx, http.MethodPost, "/transaction/initialize", map[string]interface{}{
+		"email":     req.Email,
+		"amount":    req.Amount.Kobo,
+		"currency":  req.Amount.Currency,
+		"reference": req.TxRef,
+		"metadata":  map[string]string{"narration": req.Narration},
+	}, &transaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate funding: %w", err)
+	}
+	return &TransactionResponse{
+		TransactionID: req.TxRef,
+		TxRef:         req.TxRef,
+		Status:        ChargePending,
+		Amount:        req.Amount,
+	}, nil
+}
+
+func (p *PaystackGateway) VerifyTransaction(ctx context.Context, transactionID string) (*TransactionResponse, error) {
+	var transaction paystackTransaction
+	if err := p.do(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(transactionID), nil, &transaction); err != nil {
+		return nil, fmt.Errorf("failed to verify transaction: %w", err)
+	}
+	return &TransactionResponse{
+		TransactionID: transaction.Reference,
+		TxRef:         transaction.Reference,
+		Status:        paystackChargeStatus(transaction.Status),
+		Amount:        money.New(transaction.Amount, transaction.Currency),
+	}, nil
+}
+
+// paystackChargeStatus maps Paystack's transaction statuses onto ours.
+func paystackChargeStatus(status string) string {
+	switch status {
+	case "success":
+		return ChargeSuccessful
+	case "failed", "abandoned", "reversed":
+		return ChargeFailed
+	}
+	return ChargePending
+}
+
+// ListCharges pages through the transactions created from from up to to.
+// Charges are identified by Paystack's numeric ID, which inbound transfers
+// are recorded under, rather than the reference VerifyTransaction takes.
+func (p *PaystackGateway) ListCharges(ctx context.Context, from, to time.Time) ([]Charge, error) {
+	var charges []Charge
+	for page := 1; ; page++ {
+		query := url.Values{
+			"from":    {from.UTC().Format(time.RFC3339)},
+			"to":      {to.UTC().Format(time.RFC3339)},
+			"perPage": {strconv.Itoa(paystackPageSize)},
+			"page":    {strconv.Itoa(page)},
+		}
+		var transactions []paystackTransaction
+		if err := p.do(ctx, http.MethodGet, "/transaction?"+query.Encode(), nil, &transactions); err != nil {
+			return nil, fmt.Errorf("failed to list transactions: %w", err)
+		}
+		for _, t := range transactions {
+			if t.CreatedAt.Before(from) || !t.CreatedAt.Before(to) {
+				continue
+			}
+			charges = append(charges, Charge{
+				ID:        strconv.Itoa(t.ID),
+				TxRef:     t.Reference,
+				Status:    paystackChargeStatus(t.Status),
+				Amount:    money.New(t.Amount, t.Currency),
+				CreatedAt: t.CreatedAt,
+			})
+		}
+		if len(transactions) < paystackPageSize {
+			return charges, nil
+		}
+	}
+}
+
+func (p *PaystackGateway) GetBalance(ctx context.Context, currency string) (money.Money, error) {
+	var balances []paystackBalance
+	if err := p.do(ctx, http.MethodGet, "/balance", nil, &balances); err != nil {
+		return money.Money{}, fmt.Errorf("failed to get balance: %w", err)
+	}
+	for _, b := range balances {
+		if b.Currency == currency {
+			return money.New(b.Balance, currency), nil
+		}
+	}
+	return money.New(0, currency), nil
+}
+
+func (p *PaystackGateway) ResolveBankAccount(ctx context.Context, bankCode, accountNumber string) (*BankAccountDetails, error) {
+	query := url.Values{"account_number": {accountNumber}, "bank_code": {bankCode}}
+	var account paystackResolvedAccount
+	if err := p.do(ctx, http.MethodGet, "/bank/resolve?"+query.Encode(), nil, &account); err != nil {
+		return nil, fmt.Errorf("failed to resolve bank account: %w", err)
+	}
+	return &BankAccountDetails{
+		BankCode:      bankCode,
+		AccountNumber: account.AccountNumber,
+		AccountName:   account.AccountName,
+	}, nil
+}
+
+// Transfer pays a bank account through a transfer recipient, which Paystack
+// needs before it can send money. The outcome comes later on the
+// transfer.success, transfer.failed or transfer.reversed webhook.
+func (p *PaystackGateway) Transfer(ctx context.Context, req TransferRequest) (*TransferResponse, error) {
+	var recipient paystackRecipient
+	err := p.do(ctx, http.MethodPost, "/transferrecipient", map[string]string{
+		"type":           "nuban",
+		"name":           req.AccountName,
+		"account_number": req.AccountNumber,
+		"bank_code":      req.BankCode,
+		"currency":       req.Amount.Currency,
+	}, &recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer recipient: %w", err)
+	}
+
+	var transfer paystackTransfer
+	err = p.do(ctx, http.MethodPost, "/transfer", map[string]interface{}{
+		"source":    "balance",
+		"amount":    req.Amount.Kobo,
+		"currency":  req.Amount.Currency,
+		"recipient": recipient.RecipientCode,
+		"reference": req.Reference,
+		"reason":    req.Narration,
+	}, &transfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate transfer: %w", err)
+	}
+	return transfer.toTransferResponse(), nil
+}
+
+func (p *PaystackGateway) GetTransfer(ctx context.Context, transferID string) (*TransferResponse, error) {
+	var transfer paystackTransfer
+	if err := p.do(ctx, http.MethodGet, "/transfer/"+url.PathEscape(transferID), nil, &transfer); err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	return transfer.toTransferResponse(), nil
+}
+
+func (p *PaystackGateway) GetTransferByReference(ctx context.Context, reference string) (*TransferResponse, error) {
+	var transfer paystackTransfer
+	if err := p.do(ctx, http.MethodGet, "/transfer/verify/"+url.PathEscape(reference), nil, &transfer); err != nil {
+		return nil, fmt.Errorf("failed to verify transfer: %w", err)
+	}
+	return transfer.toTransferResponse(), nil
+}
+
+// toTransferResponse maps Paystack's transfer statuses onto ours. A transfer
+// that was reversed, abandoned, blocked or rejected never reached the bank.
+func (t paystackTransfer) toTransferResponse() *TransferResponse {
+	status := TransferPending
+	switch t.Status {
+	case "success":
+		status = TransferSuccessful
+	case "failed", "reversed", "abandoned", "blocked", "rejected":
+		status = TransferFailed
+	}
+	return &TransferResponse{
+		TransferID: strconv.Itoa(t.ID),
+		Reference:  t.Reference,
+		Status:     status,
+		Amount:     money.New(t.Amount, t.Currency),
+		Fee:        money.New(0, t.Currency),
+	}
+}
+
+// VerifyWebhookSignature checks the x-paystack-signature header, the hex
+// HMAC-SHA512 of the body keyed with our secret key.
+func (p *PaystackGateway) VerifyWebhookSignature(header http.Header, body []byte) error {
+	signature := header.Get("x-paystack-signature")
+	if signature == "" {
+		return errors.New("missing signature header")
+	}
+	mac := hmac.New(sha512.New, []byte(p.SecretKey))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
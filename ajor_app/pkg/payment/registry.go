@@ -0,0 +1,328 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Provider string
+
+const (
+	ProviderFlutterwave Provider = "flutterwave"
+	ProviderPaystack    Provider = "paystack"
+)
+
+// providerCooldown is how long a provider that failed on its side is passed
+// over for new virtual accounts, payments and transfers.
+const providerCooldown = 5 * time.Minute
+
+// Registry is a PaymentGateway that spreads work over the configured
+// providers. New virtual accounts, transfers and account lookups go to the
+// first provider in order that isn't cooling down after an outage. Every ID
+// the registry hands out is prefixed with its provider ("paystack:123"), so
+// later calls about a virtual account, payment or transfer go back to the
+// provider that owns it; IDs without a prefix predate the registry and belong
+// to the default provider.
+type Registry struct {
+	gateways map[Provider]PaymentGateway
+	order    []Provider
+	// legacy owns IDs stored without a provider prefix
+	legacy Provider
+
+	mu        sync.Mutex
+	downUntil map[Provider]time.Time
+}
+
+// NewRegistry builds a registry that prefers providers in the given order.
+func NewRegistry(gateways map[Provider]PaymentGateway, order []Provider, legacy Provider) (*Registry, error) {
+	if len(order) == 0 {
+		return nil, errors.New("no payment provider configured")
+	}
+	for _, p := range order {
+		if gateways[p] == nil {
+			return nil, fmt.Errorf("payment provider %s is not configured", p)
+		}
+	}
+	return &Registry{
+		gateways:  gateways,
+		order:     order,
+		legacy:    legacy,
+		downUntil: make(map[Provider]time.Time),
+	}, nil
+}
+
+// NewRegistryFromEnv configures every provider that has a secret key
+// (FLW_SECRET_KEY, PAYSTACK_SECRET_KEY). PAYMENT_PROVIDERS sets the order of
+// preference, e.g. "paystack,flutterwave"; by default Flutterwave comes first.
+func NewRegistryFromEnv() *Registry {
+	gateways := make(map[Provider]PaymentGateway)
+	if os.Getenv("FLW_SECRET_KEY") != "" {
+		gateways[ProviderFlutterwave] = NewFlutterwaveGateway()
+	}
+	if key := os.Getenv("PAYSTACK_SECRET_KEY"); key != "" {
+		gateways[ProviderPaystack] = NewPaystackGateway(key)
+	}
+
+	var order []Provider
+	if env := os.Getenv("PAYMENT_PROVIDERS"); env != "" {
+		for _, name := range strings.Split(env, ",") {
+			order = append(order, Provider(strings.TrimSpace(name)))
+		}
+	} else {
+		for _, p := range []Provider{ProviderFlutterwave, ProviderPaystack} {
+			if gateways[p] != nil {
+				order = append(order, p)
+			}
+		}
+	}
+
+	registry, err := NewRegistry(gateways, order, ProviderFlutterwave)
+	if err != nil {
+		log.Fatalf("Failed to configure payment providers: %v", err)
+	}
+	log.Printf("Payment providers: %v", order)
+	return registry
+}
+
+// Gateway returns a configured provider's own gateway, e.g. to check the
+// signature of its webhooks.
+func (r *Registry) Gateway(p Provider) (PaymentGateway, bool) {
+	gateway, ok := r.gateways[p]
+	return gateway, ok
+}
+
+// QualifiedID prefixes a provider's ID with the provider, as the registry
+// does for every ID it returns.
+func QualifiedID(p Provider, id string) string {
+	return string(p) + ":" + id
+}
+
+// route finds the provider that owns an ID and the provider's own ID.
+func (r *Registry) route(id string) (Provider, PaymentGateway, string, error) {
+	p, raw := r.legacy, id
+	if prefix, rest, ok := strings.Cut(id, ":"); ok {
+		if _, known := r.gateways[Provider(prefix)]; known {
+			p, raw = Provider(prefix), rest
+		}
+	}
+	gateway, ok := r.gateways[p]
+	if !ok {
+		return "", nil, "", fmt.Errorf("payment provider %s is not configured", p)
+	}
+	return p, gateway, raw, nil
+}
+
+// preferred returns the providers in order of preference, with those cooling
+// down after an outage moved to the back.
+func (r *Registry) preferred() []Provider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var up, down []Provider
+	for _, p := range r.order {
+		if now.Before(r.downUntil[p]) {
+			down = append(down, p)
+		} else {
+			up = append(up, p)
+		}
+	}
+	return append(up, down...)
+}
+
+// observe puts a provider in cooldown when it failed on its side.
+func (r *Registry) observe(p Provider, err error) {
+	if !errors.Is(err, ErrProviderUnavailable) {
+		return
+	}
+	r.mu.Lock()
+	r.downUntil[p] = time.Now().Add(providerCooldown)
+	r.mu.Unlock()
+	log.Printf("Payment provider %s unavailable, failing over for %s: %v", p, providerCooldown, err)
+}
+
+// failover runs fn on each provider in order of preference until one does not
+// fail on its side, and returns the provider that answered.
+func (r *Registry) failover(fn func(gateway PaymentGateway) error) (Provider, error) {
+	var err error
+	for _, p := range r.preferred() {
+		err = fn(r.gateways[p])
+		r.observe(p, err)
+		if !errors.Is(err, ErrProviderUnavailable) {
+			return p, err
+		}
+	}
+	return "", err
+}
+
+func (r *Registry) CreateVirtualAccount(ctx context.Context, ownerID primitive.ObjectID, email, phone, narration string, isPermanent bool, bvn string, amount money.Money) (*VirtualAccount, error) {
+	var va *VirtualAccount
+	p, err := r.failover(func(gateway PaymentGateway) error {
+		var err error
+		va, err = gateway.CreateVirtualAccount(ctx, ownerID, email, phone, narration, isPermanent, bvn, amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	va.AccountID = QualifiedID(p, va.AccountID)
+	return va, nil
+}
+
+func (r *Registry) GetVirtualAccount(ctx context.Context, accountID string) (*VirtualAccount, error) {
+	p, gateway, raw, err := r.route(accountID)
+	if err != nil {
+		return nil, err
+	}
+	va, err := gateway.GetVirtualAccount(ctx, raw)
+	r.observe(p, err)
+	if err != nil {
+		return nil, err
+	}
+	va.AccountID = QualifiedID(p, va.AccountID)
+	return va, nil
+}
+
+func (r *Registry) DeactivateVirtualAccount(ctx context.Context, accountID string) error {
+	p, gateway, raw, err := r.route(accountID)
+	if err != nil {
+		return err
+	}
+	err = gateway.DeactivateVirtualAccount(ctx, raw)
+	r.observe(p, err)
+	return err
+}
+
+// FundVirtualAccount uses the provider of the wallet's virtual account.
+func (r *Registry) FundVirtualAccount(ctx context.Context, accountID string, req FundingRequest) (*TransactionResponse, error) {
+	p, gateway, raw, err := r.route(accountID)
+	if err != nil {
+		return nil, err
+	}
+	response, err := gateway.FundVirtualAccount(ctx, raw, req)
+	r.observe(p, err)
+	if err != nil {
+		return nil, err
+	}
+	// Some payment pages only get an ID once the customer pays
+	if response.TransactionID != "" {
+		response.TransactionID = QualifiedID(p, response.TransactionID)
+	}
+	return response, nil
+}
+
+func (r *Registry) VerifyTransaction(ctx context.Context, transactionID string) (*TransactionResponse, error) {
+	p, gateway, raw, err := r.route(transactionID)
+	if err != nil {
+		return nil, err
+	}
+	response, err := gateway.VerifyTransaction(ctx, raw)
+	r.observe(p, err)
+	if err != nil {
+		return nil, err
+	}
+	response.TransactionID = QualifiedID(p, response.TransactionID)
+	return response, nil
+}
+
+func (r *Registry) ResolveBankAccount(ctx context.Context, bankCode, accountNumber string) (*BankAccountDetails, error) {
+	var details *BankAccountDetails
+	_, err := r.failover(func(gateway PaymentGateway) error {
+		var err error
+		details, err = gateway.ResolveBankAccount(ctx, bankCode, accountNumber)
+		return err
+	})
+	return details, err
+}
+
+// Transfer sends money with the preferred provider. It is never retried with
+// another provider: a provider that failed to answer may still have queued
+// the transfer, and retrying elsewhere could pay the money out twice.
+func (r *Registry) Transfer(ctx context.Context, req TransferRequest) (*TransferResponse, error) {
+	p := r.preferred()[0]
+	response, err := r.gateways[p].Transfer(ctx, req)
+	r.observe(p, err)
+	if err != nil {
+		return nil, err
+	}
+	response.TransferID = QualifiedID(p, response.TransferID)
+	return response, nil
+}
+
+func (r *Registry) GetTransfer(ctx context.Context, transferID string) (*TransferResponse, error) {
+	p, gateway, raw, err := r.route(transferID)
+	if err != nil {
+		return nil, err
+	}
+	response, err := gateway.GetTransfer(ctx, raw)
+	r.observe(p, err)
+	if err != nil {
+		return nil, err
+	}
+	response.TransferID = QualifiedID(p, response.TransferID)
+	return response, nil
+}
+
+// GetTransferByReference asks every configured provider for the transfer,
+// since the reference doesn't say which one it was sent to. It only reports
+// ErrNotFound if every provider answered that it has no such transfer.
+func (r *Registry) GetTransferByReference(ctx context.Context, reference string) (*TransferResponse, error) {
+	var lastErr error
+	for _, p := range r.order {
+		response, err := r.gateways[p].GetTransferByReference(ctx, reference)
+		r.observe(p, err)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", p, err)
+			continue
+		}
+		response.TransferID = QualifiedID(p, response.TransferID)
+		return response, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("transfer %s: %w", reference, ErrNotFound)
+}
+
+// ListCharges lists the charges of every configured provider, with their IDs
+// qualified like any other.
+func (r *Registry) ListCharges(ctx context.Context, from, to time.Time) ([]Charge, error) {
+	var charges []Charge
+	for _, p := range r.order {
+		list, err := r.gateways[p].ListCharges(ctx, from, to)
+		r.observe(p, err)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, c := range list {
+			c.ID = QualifiedID(p, c.ID)
+			charges = append(charges, c)
+		}
+	}
+	return charges, nil
+}
+
+// GetBalance adds up what every configured provider holds.
+func (r *Registry) GetBalance(ctx context.Context, currency string) (money.Money, error) {
+	total := money.New(0, currency)
+	for _, p := range r.order {
+		balance, err := r.gateways[p].GetBalance(ctx, currency)
+		r.observe(p, err)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("%s: %w", p, err)
+		}
+		total = total.Add(balance)
+	}
+	return total, nil
+}
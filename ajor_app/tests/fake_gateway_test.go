@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"github.com/Gerard-007/ajor_app/pkg/payment"
+	"github.com/Gerard-007/ajor_app/pkg/payment/fake"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// webhookRecorder is a webhook endpoint that checks signatures the way the
+// real Flutterwave gateway does and keeps the events it accepts.
+func webhookRecorder(t *testing.T, secret string) (*httptest.Server, *[]fake.Event) {
+	t.Helper()
+	verifier := &payment.FlutterwaveGateway{APIKey: secret}
+	var events []fake.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.VerifyWebhookSignature(r.Header, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event fake.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events = append(events, event)
+	}))
+	t.Cleanup(server.Close)
+	return server, &events
+}
+
+func TestFakeGatewayWebhooks(t *testing.T) {
+	ctx := context.Background()
+	server, events := webhookRecorder(t, "secret")
+	gateway := fake.New("secret", server.URL)
+	pg := gateway.Registry()
+
+	va, err := pg.CreateVirtualAccount(ctx, primitive.NewObjectID(), "ada@example.com", "", "", true, "", money.Money{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if va.AccountID != "flutterwave:URF_FAKE_1" || va.AccountNumber != "9900000001" {
+		t.Fatalf("unexpected virtual account %+v", va)
+	}
+	if _, err := gateway.SimulateIncomingTransfer(ctx, va.AccountNumber, money.FromNaira(5000)); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, err := pg.Transfer(ctx, payment.TransferRequest{Amount: money.FromNaira(2000), Reference: "withdraw-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != payment.TransferPending {
+		t.Fatalf("new transfer is %s, want pending", transfer.Status)
+	}
+	if err := gateway.CompleteTransfer(ctx, "3", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	transfer, err = pg.GetTransfer(ctx, transfer.TransferID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != payment.TransferSuccessful {
+		t.Fatalf("completed transfer is %s, want successful", transfer.Status)
+	}
+	byReference, err := pg.GetTransferByReference(ctx, "withdraw-1")
+	if err != nil || byReference.TransferID != transfer.TransferID {
+		t.Fatalf("transfer by reference: %+v, %v", byReference, err)
+	}
+	if _, err := pg.GetTransferByReference(ctx, "withdraw-2"); !errors.Is(err, payment.ErrNotFound) {
+		t.Fatalf("unknown reference: got %v, want not found", err)
+	}
+
+	if len(*events) != 2 {
+		t.Fatalf("got %d webhooks, want 2", len(*events))
+	}
+	charge, payout := (*events)[0], (*events)[1]
+	if charge.Event != "charge.completed" || charge.Data["status"] != "successful" || charge.Data["account_number"] != va.AccountNumber || charge.Data["amount"] != 5000.0 {
+		t.Errorf("unexpected charge webhook %+v", charge)
+	}
+	if payout.Event != "transfer.completed" || payout.Data["status"] != "SUCCESSFUL" || payout.Data["reference"] != "withdraw-1" {
+		t.Errorf("unexpected transfer webhook %+v", payout)
+	}
+}
+
+func TestFakeGatewayFailures(t *testing.T) {
+	ctx := context.Background()
+	gateway := fake.New("secret", "")
+	pg := gateway.Registry()
+	req := payment.TransferRequest{Amount: money.FromNaira(100), Reference: "withdraw-1"}
+
+	declined := errors.New("insufficient balance")
+	gateway.FailNext(fake.OpTransfer, nil)
+	gateway.FailNext(fake.OpTransfer, declined)
+	if _, err := pg.Transfer(ctx, req); !errors.Is(err, payment.ErrProviderUnavailable) {
+		t.Fatalf("first transfer: got %v, want provider unavailable", err)
+	}
+	if _, err := pg.Transfer(ctx, req); !errors.Is(err, declined) {
+		t.Fatalf("second transfer: got %v, want %v", err, declined)
+	}
+	if _, err := pg.Transfer(ctx, req); err != nil {
+		t.Fatalf("third transfer: %v", err)
+	}
+
+	gateway.Fail(fake.OpResolveBankAccount, declined)
+	for i := 0; i < 2; i++ {
+		if _, err := pg.ResolveBankAccount(ctx, "044", "0123456789"); !errors.Is(err, declined) {
+			t.Fatalf("resolve during outage: got %v, want %v", err, declined)
+		}
+	}
+	gateway.Recover(fake.OpResolveBankAccount)
+	gateway.AddBankAccount("044", "0123456789", "ADA OBI")
+	details, err := pg.ResolveBankAccount(ctx, "044", "0123456789")
+	if err != nil || details.AccountName != "ADA OBI" {
+		t.Fatalf("resolve after recovery: %+v, %v", details, err)
+	}
+
+	gateway.SetLatency(time.Hour)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := pg.GetTransfer(timeout, "flutterwave:1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow call: got %v, want deadline exceeded", err)
+	}
+}
+
+func TestFakeGatewayChargesAndBalance(t *testing.T) {
+	ctx := context.Background()
+	gateway := fake.New("secret", "")
+	pg := gateway.Registry()
+
+	va, err := pg.CreateVirtualAccount(ctx, primitive.NewObjectID(), "ada@example.com", "", "", true, "", money.Money{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now()
+	inbound, err := gateway.SimulateIncomingTransfer(ctx, va.AccountNumber, money.FromNaira(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.FundVirtualAccount(ctx, va.AccountID, payment.FundingRequest{Amount: money.FromNaira(1000), TxRef: "fund-1"}); err != nil {
+		t.Fatal(err)
+	}
+	transfer, err := pg.Transfer(ctx, payment.TransferRequest{Amount: money.FromNaira(2000), Reference: "withdraw-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gateway.CompleteTransfer(ctx, rawFakeID(transfer.TransferID), true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	charges, err := pg.ListCharges(ctx, from, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charges) != 2 {
+		t.Fatalf("got %d charges, want 2", len(charges))
+	}
+	if charges[0].ID != "flutterwave:"+inbound.TransactionID || charges[0].Status != payment.ChargeSuccessful {
+		t.Errorf("unexpected inbound charge %+v", charges[0])
+	}
+	if charges[1].TxRef != "fund-1" || charges[1].Status != payment.ChargePending || !charges[1].Amount.Equal(money.FromNaira(1000)) {
+		t.Errorf("unexpected funding charge %+v", charges[1])
+	}
+	if later, err := pg.ListCharges(ctx, time.Now().Add(time.Second), time.Now().Add(time.Hour)); err != nil || len(later) != 0 {
+		t.Errorf("charges after the window: %+v, %v", later, err)
+	}
+
+	balance, err := pg.GetBalance(ctx, money.NGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balance.Equal(money.FromNaira(3000)) {
+		t.Errorf("balance is %s, want 3000.00", balance)
+	}
+}
+
+// rawFakeID strips the provider prefix the registry adds to fake IDs.
+func rawFakeID(id string) string {
+	return strings.TrimPrefix(id, "flutterwave:")
+}
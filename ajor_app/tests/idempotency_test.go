@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/middleware"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// idempotentRouter serves the Idempotency middleware in front of handlers that
+// count how often they run. /slow blocks until release is closed.
+func idempotentRouter(t *testing.T, db *mongo.Database, runs *int32, started chan<- struct{}, release <-chan struct{}) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID().Hex()
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", userID) }, middleware.Idempotency(db))
+	router.POST("/ok", func(c *gin.Context) {
+		n := atomic.AddInt32(runs, 1)
+		c.JSON(http.StatusCreated, gin.H{"run": n})
+	})
+	router.POST("/other", func(c *gin.Context) {
+		atomic.AddInt32(runs, 1)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.POST("/fail", func(c *gin.Context) {
+		atomic.AddInt32(runs, 1)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "gateway down"})
+	})
+	router.POST("/slow", func(c *gin.Context) {
+		atomic.AddInt32(runs, 1)
+		started <- struct{}{}
+		<-release
+		c.JSON(http.StatusOK, gin.H{"done": true})
+	})
+	return router
+}
+
+func sendIdempotent(router *gin.Engine, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	if err := repository.EnsureIdempotencyIndexes(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("replays a 2xx", func(t *testing.T) {
+		var runs int32
+		router := idempotentRouter(t, db, &runs, nil, nil)
+		first := sendIdempotent(router, "/ok", "replay", `{"amount": 100}`)
+		second := sendIdempotent(router, "/ok", "replay", `{"amount": 100}`)
+		if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+			t.Fatalf("got %d and %d, want 201 twice", first.Code, second.Code)
+		}
+		if second.Body.String() != first.Body.String() {
+			t.Errorf("replayed %q, want %q", second.Body.String(), first.Body.String())
+		}
+		if first.Header().Get(middleware.IdempotentReplayHeader) != "" || second.Header().Get(middleware.IdempotentReplayHeader) != "true" {
+			t.Errorf("only the retry should be marked replayed")
+		}
+		if runs != 1 {
+			t.Errorf("handler ran %d times, want 1", runs)
+		}
+	})
+
+	t.Run("rejects a key reused for another request", func(t *testing.T) {
+		var runs int32
+		router := idempotentRouter(t, db, &runs, nil, nil)
+		sendIdempotent(router, "/ok", "reused", `{"amount": 100}`)
+		tests := []struct {
+			path string
+			body string
+		}{
+			{"/ok", `{"amount": 200}`},
+			{"/other", `{"amount": 100}`},
+		}
+		for _, tt := range tests {
+			if w := sendIdempotent(router, tt.path, "reused", tt.body); w.Code != http.StatusUnprocessableEntity {
+				t.Errorf("POST %s %s: got %d, want 422", tt.path, tt.body, w.Code)
+			}
+		}
+		if runs != 1 {
+			t.Errorf("handler ran %d times, want 1", runs)
+		}
+	})
+
+	t.Run("holds the key while the request is in flight", func(t *testing.T) {
+		var runs int32
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		router := idempotentRouter(t, db, &runs, started, release)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- sendIdempotent(router, "/slow", "in-flight", `{}`) }()
+		<-started
+		if w := sendIdempotent(router, "/slow", "in-flight", `{}`); w.Code != http.StatusConflict {
+			t.Errorf("retry in flight: got %d, want 409", w.Code)
+		}
+		close(release)
+		if w := <-done; w.Code != http.StatusOK {
+			t.Fatalf("first request: got %d, want 200", w.Code)
+		}
+		if w := sendIdempotent(router, "/slow", "in-flight", `{}`); w.Header().Get(middleware.IdempotentReplayHeader) != "true" {
+			t.Errorf("retry after completion: got %d without a replay", w.Code)
+		}
+		if runs != 1 {
+			t.Errorf("handler ran %d times, want 1", runs)
+		}
+	})
+
+	t.Run("takes over a lease that ran out", func(t *testing.T) {
+		var runs int32
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		router := idempotentRouter(t, db, &runs, started, release)
+
+		done := make(chan *httptest.ResponseRecorder, 2)
+		go func() { done <- sendIdempotent(router, "/slow", "stale", `{}`) }()
+		<-started
+		// The first request stalls past its lease
+		_, err := db.Collection("idempotency_keys").UpdateOne(ctx, bson.M{"key": "stale"}, bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Second)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { done <- sendIdempotent(router, "/slow", "stale", `{}`) }()
+		<-started
+		close(release)
+		<-done
+		<-done
+		if runs != 2 {
+			t.Errorf("handler ran %d times, want 2", runs)
+		}
+	})
+
+	t.Run("releases the key after a 5xx", func(t *testing.T) {
+		var runs int32
+		router := idempotentRouter(t, db, &runs, nil, nil)
+		for i := 0; i < 2; i++ {
+			w := sendIdempotent(router, "/fail", "server-error", `{}`)
+			if w.Code != http.StatusBadGateway || w.Header().Get(middleware.IdempotentReplayHeader) != "" {
+				t.Errorf("attempt %d: got %d, want a fresh 502", i+1, w.Code)
+			}
+		}
+		if runs != 2 {
+			t.Errorf("handler ran %d times, want 2", runs)
+		}
+		count, err := db.Collection("idempotency_keys").CountDocuments(ctx, bson.M{"key": "server-error"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d records left for a failed request, want 0", count)
+		}
+	})
+}
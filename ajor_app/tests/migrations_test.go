@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMigrateMoneyFields(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	migrated := bson.M{"amount": int64(70000), "currency": "NGN"}
+	docs := map[string]bson.M{
+		"wallets":       {"balance": 1500.5},
+		"contributions": {"amount": int32(200), "penalty_amount": 0.1 + 0.2},
+		"transactions":  {"amount": migrated},
+		"journal_entries": {"legs": bson.A{
+			bson.M{"account": "wallet", "debit": 12.34, "credit": 0.0},
+			bson.M{"account": "gateway_clearing", "debit": int32(0), "credit": int64(12)},
+		}},
+	}
+	ids := make(map[string]interface{}, len(docs))
+	for collection, doc := range docs {
+		result, err := db.Collection(collection).InsertOne(ctx, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[collection] = result.InsertedID
+	}
+
+	// Running it again must leave migrated amounts alone
+	for i := 0; i < 2; i++ {
+		if err := repository.MigrateMoneyFields(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kobo := func(n int64) bson.M { return bson.M{"amount": n, "currency": "NGN"} }
+	tests := []struct {
+		collection string
+		field      string
+		want       interface{}
+	}{
+		{"wallets", "balance", kobo(150050)},
+		{"contributions", "amount", kobo(20000)},
+		{"contributions", "penalty_amount", kobo(30)},
+		{"transactions", "amount", migrated},
+	}
+	for _, tt := range tests {
+		var doc bson.M
+		if err := db.Collection(tt.collection).FindOne(ctx, bson.M{"_id": ids[tt.collection]}).Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if got := normalize(doc[tt.field]); !equalDocs(got, tt.want.(bson.M)) {
+			t.Errorf("%s.%s = %v, want %v", tt.collection, tt.field, got, tt.want)
+		}
+	}
+
+	var entry struct {
+		Legs []struct {
+			Debit  money.Money `bson:"debit"`
+			Credit money.Money `bson:"credit"`
+		} `bson:"legs"`
+	}
+	if err := db.Collection("journal_entries").FindOne(ctx, bson.M{"_id": ids["journal_entries"]}).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]money.Money{
+		{money.FromKobo(1234), money.FromKobo(0)},
+		{money.FromKobo(0), money.FromNaira(12)},
+	}
+	for i, leg := range entry.Legs {
+		if leg.Debit != want[i][0] || leg.Credit != want[i][1] {
+			t.Errorf("leg %d = %v/%v, want %v/%v", i, leg.Debit, leg.Credit, want[i][0], want[i][1])
+		}
+	}
+	var raw bson.M
+	if err := db.Collection("journal_entries").FindOne(ctx, bson.M{"legs.debit": bson.M{"$type": "number"}}).Decode(&raw); err != mongo.ErrNoDocuments {
+		t.Errorf("journal entry left with a number amount: %v", raw)
+	}
+}
+
+// normalize turns a decoded embedded document into a bson.M.
+func normalize(v interface{}) bson.M {
+	switch d := v.(type) {
+	case bson.M:
+		return d
+	case bson.D:
+		return d.Map()
+	}
+	return nil
+}
+
+func equalDocs(a, b bson.M) bool {
+	return len(a) == len(b) && a["amount"] == b["amount"] && a["currency"] == b["currency"]
+}
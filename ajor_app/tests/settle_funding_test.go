@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/internal/services"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestConcurrentSettlesCreditOnce settles one pending funding from many
+// goroutines at once, as the inline settle, the webhook, its retry and the
+// sweeper may. Multi-document transactions need MONGODB_TEST_URI to point at
+// a replica set.
+func TestConcurrentSettlesCreditOnce(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	// Collections can't be created inside a transaction on older servers
+	for _, name := range []string{"transactions", "journal_entries", "wallets"} {
+		if err := db.CreateCollection(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wallet := &models.Wallet{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   primitive.NewObjectID(),
+		Type:      models.WalletTypeUser,
+		Balance:   money.FromNaira(0),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := repository.CreateWallet(db, wallet); err != nil {
+		t.Fatal(err)
+	}
+	funding := &models.Transaction{
+		ToWallet:      wallet.ID,
+		Amount:        money.FromNaira(5000),
+		Type:          models.TransactionWallet,
+		Date:          time.Now(),
+		PaymentMethod: models.PaymentBankTransfer,
+		Status:        models.StatusPending,
+		TxRef:         "fund-wallet-test",
+	}
+	if err := repository.CreateTransaction(ctx, db, funding); err != nil {
+		t.Fatal(err)
+	}
+
+	const settlers = 10
+	var mu sync.Mutex
+	var settled, skipped int
+	var wg sync.WaitGroup
+	for i := 0; i < settlers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transaction := *funding
+			err := services.ExecuteTransfer(ctx, db, &transaction)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				settled++
+			case errors.Is(err, repository.ErrTransactionNotPending):
+				skipped++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if settled != 1 || skipped != settlers-1 {
+		t.Errorf("expected 1 settle and %d skipped, got %d and %d", settlers-1, settled, skipped)
+	}
+	stored, err := repository.GetWalletByID(db, wallet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.FromNaira(5000); !stored.Balance.Equal(want) {
+		t.Errorf("expected balance %s, got %s", want, stored.Balance)
+	}
+	entries, err := repository.GetJournalEntriesByTransaction(ctx, db, funding.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 journal entry, got %d", len(entries))
+	}
+}
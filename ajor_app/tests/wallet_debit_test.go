@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gerard-007/ajor_app/internal/models"
+	"github.com/Gerard-007/ajor_app/internal/repository"
+	"github.com/Gerard-007/ajor_app/pkg/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to the MongoDB named by MONGODB_TEST_URI and returns a
+// throwaway database that is dropped when the test finishes.
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("ajor_app_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	return db
+}
+
+func TestConcurrentDebitsNeverOverdraw(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	const (
+		workers = 50
+		debits  = 100
+	)
+	wallet := &models.Wallet{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   primitive.NewObjectID(),
+		Type:      models.WalletTypeUser,
+		Balance:   money.FromNaira(1000),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := repository.CreateWallet(db, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	// 5000 debits of 30 naira against 1000 naira: only 33 can succeed
+	amount := money.FromNaira(30)
+	var mu sync.Mutex
+	var succeeded, rejected int
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < debits; j++ {
+				err := repository.DebitWallet(ctx, db, wallet.ID, amount, primitive.NewObjectID())
+				mu.Lock()
+				switch {
+				case err == nil:
+					succeeded++
+				case errors.Is(err, repository.ErrInsufficientFunds):
+					rejected++
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := repository.GetWalletByID(db, wallet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Balance.IsNegative() {
+		t.Fatalf("wallet overdrawn: balance %s", stored.Balance)
+	}
+	if succeeded != 33 {
+		t.Errorf("expected 33 debits to succeed, got %d", succeeded)
+	}
+	if succeeded+rejected != workers*debits {
+		t.Errorf("expected %d debits to finish, got %d", workers*debits, succeeded+rejected)
+	}
+	if want := money.FromNaira(10); !stored.Balance.Equal(want) {
+		t.Errorf("expected balance %s, got %s", want, stored.Balance)
+	}
+}
+
+func TestDebitIsIdempotentPerEntry(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	wallet := &models.Wallet{
+		ID:      primitive.NewObjectID(),
+		OwnerID: primitive.NewObjectID(),
+		Type:    models.WalletTypeUser,
+		Balance: money.FromNaira(100),
+	}
+	if err := repository.CreateWallet(db, wallet); err != nil {
+		t.Fatal(err)
+	}
+
+	entryID := primitive.NewObjectID()
+	for i := 0; i < 3; i++ {
+		if err := repository.DebitWallet(ctx, db, wallet.ID, money.FromNaira(60), entryID); err != nil {
+			t.Fatalf("debit %d: %v", i, err)
+		}
+	}
+	stored, err := repository.GetWalletByID(db, wallet.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.FromNaira(40); !stored.Balance.Equal(want) {
+		t.Errorf("expected balance %s, got %s", want, stored.Balance)
+	}
+
+	err = repository.DebitWallet(ctx, db, wallet.ID, money.FromNaira(60), primitive.NewObjectID())
+	if !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+}